@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// adaptiveInterval is how often the controller re-evaluates its settings
+const adaptiveInterval = 15 * time.Second
+
+// AdaptiveController tunes the batch size, COPY threshold and number of in-flight workers
+// toward MigrationConfig.CopyTargetRowsPerSec, based on the insert throughput and latency
+// measured over each interval. Batch size and COPY threshold stay within
+// CopyMinThreshold..CopyMaxThreshold, workers within 1..WorkerCount.
+// All methods are safe to call on a nil *AdaptiveController, which keeps the static settings.
+type AdaptiveController struct {
+	targetRowsPerSec float64
+	minSize          int
+	maxSize          int
+	maxWorkers       int
+
+	mu            sync.Mutex
+	cond          *sync.Cond
+	batchSize     int
+	copyThreshold int
+	workers       int // in-flight worker limit
+	inFlight      int
+
+	// Current measurement window
+	windowStart   time.Time
+	windowRows    int64
+	windowBatch   int64
+	windowLatency time.Duration
+	// Per-row insert cost (seconds) by method, exponentially smoothed
+	rowCost map[string]float64
+
+	// Previous window, to detect rising latency
+	lastRowsPerSec float64
+	lastLatency    time.Duration
+
+	decisions *prometheus.CounterVec
+}
+
+// NewAdaptiveController creates a controller starting from the configured settings
+func NewAdaptiveController(config MigrationConfig) *AdaptiveController {
+	c := &AdaptiveController{
+		targetRowsPerSec: float64(config.CopyTargetRowsPerSec),
+		minSize:          config.CopyMinThreshold,
+		maxSize:          config.CopyMaxThreshold,
+		maxWorkers:       max(config.WorkerCount, 1),
+		workers:          max(config.WorkerCount, 1),
+		windowStart:      time.Now(),
+		rowCost:          make(map[string]float64),
+		decisions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "migration_adaptive_decisions_total",
+			Help: "Adaptive controller decisions, by action.",
+		}, []string{"action"}),
+	}
+	if c.maxSize < c.minSize {
+		c.maxSize = c.minSize
+	}
+	c.batchSize = c.clamp(config.BatchSize)
+	c.copyThreshold = c.clamp(config.CopyThreshold)
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// clamp bounds a batch size or COPY threshold to the configured range
+func (c *AdaptiveController) clamp(n int) int {
+	return max(c.minSize, min(c.maxSize, n))
+}
+
+// BatchSize returns the number of documents to read per batch, or fallback without a controller
+func (c *AdaptiveController) BatchSize(fallback int) int {
+	if c == nil {
+		return fallback
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.batchSize
+}
+
+// CopyThreshold returns the minimum batch size for COPY, or fallback without a controller
+func (c *AdaptiveController) CopyThreshold(fallback int) int {
+	if c == nil {
+		return fallback
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.copyThreshold
+}
+
+// Acquire blocks until the worker may process a batch under the current in-flight limit.
+// It returns false if ctx is cancelled first.
+func (c *AdaptiveController) Acquire(ctx context.Context) bool {
+	if c == nil {
+		return ctx.Err() == nil
+	}
+	stop := context.AfterFunc(ctx, func() {
+		c.mu.Lock()
+		c.cond.Broadcast()
+		c.mu.Unlock()
+	})
+	defer stop()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.inFlight >= c.workers {
+		if ctx.Err() != nil {
+			return false
+		}
+		c.cond.Wait()
+	}
+	if ctx.Err() != nil {
+		return false
+	}
+	c.inFlight++
+	return true
+}
+
+// Release returns a slot taken by Acquire
+func (c *AdaptiveController) Release() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.inFlight--
+	c.cond.Signal()
+	c.mu.Unlock()
+}
+
+// Observe records a successful insert of rows rows using method, and re-evaluates the
+// settings once per adaptiveInterval
+func (c *AdaptiveController) Observe(method string, rows int, latency time.Duration) {
+	if c == nil || rows == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.windowRows += int64(rows)
+	c.windowBatch++
+	c.windowLatency += latency
+
+	cost := latency.Seconds() / float64(rows)
+	if previous, ok := c.rowCost[method]; ok {
+		c.rowCost[method] = 0.8*previous + 0.2*cost
+	} else {
+		c.rowCost[method] = cost
+	}
+
+	if elapsed := time.Since(c.windowStart); elapsed >= adaptiveInterval {
+		c.adjust(elapsed)
+	}
+}
+
+// adjust applies one control step; called with c.mu held
+func (c *AdaptiveController) adjust(elapsed time.Duration) {
+	rowsPerSec := float64(c.windowRows) / elapsed.Seconds()
+	avgLatency := c.windowLatency / time.Duration(c.windowBatch)
+	latencyRising := c.lastLatency > 0 && avgLatency > c.lastLatency*3/2 && rowsPerSec <= c.lastRowsPerSec
+
+	action := "hold"
+	switch {
+	case rowsPerSec < c.targetRowsPerSec*0.9 && latencyRising:
+		// More work in flight only made each batch slower: the database is saturated
+		if c.workers > 1 {
+			c.workers--
+			action = "reduce_workers"
+		} else if c.batchSize > c.minSize {
+			c.batchSize = c.clamp(c.batchSize * 4 / 5)
+			action = "shrink_batch"
+		}
+	case rowsPerSec < c.targetRowsPerSec*0.9:
+		if c.workers < c.maxWorkers {
+			c.workers++
+			c.cond.Broadcast()
+			action = "add_worker"
+		} else if c.batchSize < c.maxSize {
+			c.batchSize = c.clamp(c.batchSize * 5 / 4)
+			action = "grow_batch"
+		}
+	case rowsPerSec > c.targetRowsPerSec*1.1:
+		// Ahead of target: give the database some headroom back
+		if c.workers > 1 {
+			c.workers--
+			action = "reduce_workers"
+		} else if c.batchSize > c.minSize {
+			c.batchSize = c.clamp(c.batchSize * 4 / 5)
+			action = "shrink_batch"
+		}
+	}
+
+	// Move the COPY threshold toward whichever method is cheaper per row
+	copyCost, haveCopy := c.rowCost[insertMethodCopy]
+	rowsCost, haveRows := c.rowCost[insertMethodRows]
+	thresholdChange := ""
+	if haveCopy && haveRows {
+		if copyCost < rowsCost && c.copyThreshold > c.minSize {
+			c.copyThreshold = c.clamp(c.copyThreshold * 4 / 5)
+			thresholdChange = "lower_copy_threshold"
+		} else if copyCost > rowsCost && c.copyThreshold < c.maxSize {
+			c.copyThreshold = c.clamp(c.copyThreshold * 5 / 4)
+			thresholdChange = "raise_copy_threshold"
+		}
+	}
+
+	c.decisions.WithLabelValues(action).Inc()
+	if thresholdChange != "" {
+		c.decisions.WithLabelValues(thresholdChange).Inc()
+		action += ", " + thresholdChange
+	}
+	log.Printf("⚙️  Adaptive: %.0f rows/s (target %.0f), avg insert latency %v → %s: batch size %d, COPY threshold %d, workers %d/%d",
+		rowsPerSec, c.targetRowsPerSec, avgLatency.Round(time.Millisecond), action,
+		c.batchSize, c.copyThreshold, c.workers, c.maxWorkers)
+
+	c.lastRowsPerSec = rowsPerSec
+	c.lastLatency = avgLatency
+	c.windowStart = time.Now()
+	c.windowRows = 0
+	c.windowBatch = 0
+	c.windowLatency = 0
+}
+
+// Collectors returns the Prometheus collectors exporting the controller state
+func (c *AdaptiveController) Collectors() []prometheus.Collector {
+	if c == nil {
+		return nil
+	}
+	gauge := func(name, help string, value func() float64) prometheus.Collector {
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: name, Help: help}, func() float64 {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			return value()
+		})
+	}
+	return []prometheus.Collector{
+		c.decisions,
+		gauge("migration_adaptive_batch_size", "Documents read per batch, as set by the adaptive controller.",
+			func() float64 { return float64(c.batchSize) }),
+		gauge("migration_adaptive_copy_threshold", "Minimum batch size for COPY, as set by the adaptive controller.",
+			func() float64 { return float64(c.copyThreshold) }),
+		gauge("migration_adaptive_workers", "In-flight worker limit, as set by the adaptive controller.",
+			func() float64 { return float64(c.workers) }),
+		gauge("migration_adaptive_target_rows_per_second", "Insert throughput the adaptive controller steers toward.",
+			func() float64 { return c.targetRowsPerSec }),
+		gauge("migration_adaptive_rows_per_second", "Insert throughput measured over the last adaptive interval.",
+			func() float64 { return c.lastRowsPerSec }),
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ASN is a 32-bit autonomous system number
+type ASN uint32
+
+// String returns the asplain display form stored in AsnRegistries.Number, e.g. "AS13335"
+func (a ASN) String() string {
+	return fmt.Sprintf("AS%d", uint32(a))
+}
+
+// ParseASN parses a single AS number in asplain ("13335", "AS13335", "ASN13335") or asdot
+// ("AS1.10") notation. Text after the number, as in "AS13335 CLOUDFLARENET", is returned as
+// the description.
+func ParseASN(value string) (ASN, string, error) {
+	first, last, description, err := ParseASNRange(value)
+	if err != nil {
+		return 0, "", err
+	}
+	if first != last {
+		return 0, "", fmt.Errorf("%q is a range of AS numbers, not one", strings.TrimSpace(value))
+	}
+	return first, description, nil
+}
+
+// ParseASNRange parses an AS number or an inclusive range such as "AS64512-AS65534", followed by
+// an optional description
+func ParseASNRange(value string) (first, last ASN, description string, err error) {
+	trimmed := strings.TrimSpace(value)
+	first, rest, err := parseASNumber(trimmed)
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("invalid ASN %q: %w", trimmed, err)
+	}
+
+	last = first
+	rest = strings.TrimSpace(rest)
+	if after, ok := strings.CutPrefix(rest, "-"); ok {
+		// A dash followed by anything but a number starts the description
+		if number, remainder, err := parseASNumber(strings.TrimSpace(after)); err == nil {
+			if number < first {
+				return 0, 0, "", fmt.Errorf("invalid ASN range %q", trimmed)
+			}
+			last, rest = number, remainder
+		}
+	}
+	return first, last, strings.Trim(rest, " \t,;:|-()[]"), nil
+}
+
+// parseASNumber parses the AS number at the start of s and returns the rest of s
+func parseASNumber(s string) (ASN, string, error) {
+	// "ASN" has to be checked before "AS", which would leave the "N" behind
+	upper := strings.ToUpper(s)
+	if strings.HasPrefix(upper, "ASN") {
+		s = s[3:]
+	} else if strings.HasPrefix(upper, "AS") {
+		s = s[2:]
+	}
+	s = strings.TrimLeft(s, " ")
+
+	end := 0
+	for end < len(s) && (s[end] >= '0' && s[end] <= '9' || s[end] == '.') {
+		end++
+	}
+	if end < len(s) && isASNWordByte(s[end]) {
+		return 0, "", fmt.Errorf("no AS number")
+	}
+	number, rest := s[:end], s[end:]
+
+	var asn uint64
+	if high, low, isDot := strings.Cut(number, "."); isDot {
+		// asdot: the high and low 16 bits of the number
+		h, err := strconv.ParseUint(high, 10, 16)
+		if err != nil {
+			return 0, "", fmt.Errorf("invalid asdot number %q", number)
+		}
+		l, err := strconv.ParseUint(low, 10, 16)
+		if err != nil {
+			return 0, "", fmt.Errorf("invalid asdot number %q", number)
+		}
+		asn = h<<16 | l
+	} else {
+		var err error
+		if asn, err = strconv.ParseUint(number, 10, 32); err != nil {
+			if number == "" {
+				return 0, "", fmt.Errorf("no AS number")
+			}
+			return 0, "", fmt.Errorf("AS number %q is out of range", number)
+		}
+	}
+	if asn == 0 {
+		return 0, "", fmt.Errorf("AS0 is reserved")
+	}
+	return ASN(asn), rest, nil
+}
+
+// isASNWordByte reports whether b continues a word, so "AS13335X" is not read as AS13335
+func isASNWordByte(b byte) bool {
+	return b >= 'A' && b <= 'Z' || b >= 'a' && b <= 'z' || b >= '0' && b <= '9' || b == '_'
+}
@@ -0,0 +1,107 @@
+package main
+
+import "testing"
+
+func TestParseASN(t *testing.T) {
+	tests := []struct {
+		value       string
+		want        ASN
+		description string
+		wantErr     bool
+	}{
+		{value: "13335", want: 13335},
+		{value: "AS13335", want: 13335},
+		{value: "as13335", want: 13335},
+		{value: "ASN13335", want: 13335},
+		{value: "AS 13335", want: 13335},
+		{value: "  AS13335  ", want: 13335},
+		{value: "AS13335 CLOUDFLARENET", want: 13335, description: "CLOUDFLARENET"},
+		{value: "AS13335, Cloudflare, Inc.", want: 13335, description: "Cloudflare, Inc."},
+		{value: "AS13335 - Cloudflare", want: 13335, description: "Cloudflare"},
+		{value: "AS13335 (Cloudflare)", want: 13335, description: "Cloudflare"},
+
+		// asdot: the high and low 16 bits
+		{value: "AS1.10", want: 65546},
+		{value: "1.10", want: 65546},
+		{value: "AS65535.65535", want: 4294967295},
+		{value: "AS1.65536", wantErr: true},
+		{value: "AS65536.1", wantErr: true},
+		{value: "AS1.", wantErr: true},
+		{value: "AS.1", wantErr: true},
+		{value: "AS1.2.3", wantErr: true},
+
+		// 32-bit range, AS0 reserved
+		{value: "AS4294967295", want: 4294967295},
+		{value: "AS4294967296", wantErr: true},
+		{value: "AS99999999999999999999", wantErr: true},
+		{value: "AS0", wantErr: true},
+		{value: "0.0", wantErr: true},
+
+		// The number has to end on a word boundary
+		{value: "AS13335X", wantErr: true},
+		{value: "AS13335_1", wantErr: true},
+		{value: "N123", wantErr: true},
+		{value: "ASX123", wantErr: true},
+		{value: "", wantErr: true},
+		{value: "AS", wantErr: true},
+		{value: "-5", wantErr: true},
+
+		// Ranges are not single AS numbers
+		{value: "AS64512-AS65534", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, description, err := ParseASN(tt.value)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseASN(%q) = %d, %q, want an error", tt.value, got, description)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseASN(%q): %v", tt.value, err)
+			continue
+		}
+		if got != tt.want || description != tt.description {
+			t.Errorf("ParseASN(%q) = %d, %q, want %d, %q", tt.value, got, description, tt.want, tt.description)
+		}
+	}
+}
+
+func TestParseASNRange(t *testing.T) {
+	tests := []struct {
+		value       string
+		first, last ASN
+		description string
+		wantErr     bool
+	}{
+		{value: "AS13335", first: 13335, last: 13335},
+		{value: "AS64512-AS65534", first: 64512, last: 65534},
+		{value: "64512 - 65534 private use", first: 64512, last: 65534, description: "private use"},
+		{value: "AS1.0-AS1.10", first: 65536, last: 65546},
+		{value: "AS64512-AS64512", first: 64512, last: 64512},
+		{value: "AS65534-AS64512", wantErr: true},
+	}
+	for _, tt := range tests {
+		first, last, description, err := ParseASNRange(tt.value)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseASNRange(%q) = %d-%d, want an error", tt.value, first, last)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseASNRange(%q): %v", tt.value, err)
+			continue
+		}
+		if first != tt.first || last != tt.last || description != tt.description {
+			t.Errorf("ParseASNRange(%q) = %d-%d, %q, want %d-%d, %q",
+				tt.value, first, last, description, tt.first, tt.last, tt.description)
+		}
+	}
+}
+
+func TestASNString(t *testing.T) {
+	if got := ASN(4294967295).String(); got != "AS4294967295" {
+		t.Errorf("String() = %q, want %q", got, "AS4294967295")
+	}
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// MigrationProgress represents the current migration state
+type MigrationProgress struct {
+	MigrationName   string    `json:"migration_name"`
+	LastProcessedID string    `json:"last_processed_id"`
+	ProcessedCount  int64     `json:"processed_count"`
+	TotalCount      int64     `json:"total_count"`
+	StartTime       time.Time `json:"start_time"`
+	LastUpdateTime  time.Time `json:"last_update_time"`
+	ResumeToken     string    `json:"resume_token,omitempty"`  // change stream resume token (extended JSON), sync mode only
+	RulesVersion    string    `json:"rules_version,omitempty"` // normalization rule set of the last committed batch
+}
+
+// CheckpointStore persists migration progress per named migration
+type CheckpointStore interface {
+	// Load returns the stored progress for a migration, or nil if none has been recorded yet
+	Load(ctx context.Context, migrationName string) (*MigrationProgress, error)
+	// Save records the progress for progress.MigrationName, replacing any previous value
+	Save(ctx context.Context, progress MigrationProgress) error
+}
+
+// NewCheckpointStore returns the checkpoint store selected by the migration configuration
+func NewCheckpointStore(config MigrationConfig, postgresClient *PostgreSQLClient) (CheckpointStore, error) {
+	if config.CheckpointFile != "" {
+		log.Printf("Using file checkpoint store: %s", config.CheckpointFile)
+		return NewFileCheckpointStore(config.CheckpointFile), nil
+	}
+	log.Println("Using PostgreSQL checkpoint store (MigrationCheckpoints)")
+	return NewPostgresCheckpointStore(postgresClient.db)
+}
+
+// PostgresCheckpointStore keeps checkpoints in the "MigrationCheckpoints" table next to the migrated data
+type PostgresCheckpointStore struct {
+	db *sql.DB
+}
+
+// NewPostgresCheckpointStore creates the checkpoint table if needed and returns a store backed by it
+func NewPostgresCheckpointStore(db *sql.DB) (*PostgresCheckpointStore, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if _, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS "MigrationCheckpoints" (
+			"Name" text PRIMARY KEY,
+			"LastProcessedId" text NOT NULL,
+			"ProcessedCount" bigint NOT NULL DEFAULT 0,
+			"TotalCount" bigint NOT NULL DEFAULT 0,
+			"StartTime" timestamptz NOT NULL,
+			"LastUpdateTime" timestamptz NOT NULL
+		)`); err != nil {
+		return nil, fmt.Errorf("failed to create MigrationCheckpoints table: %w", err)
+	}
+	if _, err := db.ExecContext(ctx, `ALTER TABLE "MigrationCheckpoints" ADD COLUMN IF NOT EXISTS "ResumeToken" text`); err != nil {
+		return nil, fmt.Errorf("failed to add MigrationCheckpoints.ResumeToken column: %w", err)
+	}
+	if _, err := db.ExecContext(ctx, `ALTER TABLE "MigrationCheckpoints" ADD COLUMN IF NOT EXISTS "RulesVersion" text`); err != nil {
+		return nil, fmt.Errorf("failed to add MigrationCheckpoints.RulesVersion column: %w", err)
+	}
+
+	return &PostgresCheckpointStore{db: db}, nil
+}
+
+// Load returns the stored progress for a migration
+func (s *PostgresCheckpointStore) Load(ctx context.Context, migrationName string) (*MigrationProgress, error) {
+	progress := MigrationProgress{MigrationName: migrationName}
+	err := s.db.QueryRowContext(ctx, `
+		SELECT "LastProcessedId","ProcessedCount","TotalCount","StartTime","LastUpdateTime",COALESCE("ResumeToken",''),COALESCE("RulesVersion",'')
+		FROM "MigrationCheckpoints" WHERE "Name" = $1`, migrationName).Scan(
+		&progress.LastProcessedID,
+		&progress.ProcessedCount,
+		&progress.TotalCount,
+		&progress.StartTime,
+		&progress.LastUpdateTime,
+		&progress.ResumeToken,
+		&progress.RulesVersion,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load checkpoint %s: %w", migrationName, err)
+	}
+	return &progress, nil
+}
+
+// Save upserts the progress for a migration
+func (s *PostgresCheckpointStore) Save(ctx context.Context, progress MigrationProgress) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO "MigrationCheckpoints" ("Name","LastProcessedId","ProcessedCount","TotalCount","StartTime","LastUpdateTime","ResumeToken","RulesVersion")
+		VALUES ($1,$2,$3,$4,$5,$6,NULLIF($7,''),NULLIF($8,''))
+		ON CONFLICT ("Name") DO UPDATE SET
+			"LastProcessedId" = EXCLUDED."LastProcessedId",
+			"ProcessedCount" = EXCLUDED."ProcessedCount",
+			"TotalCount" = EXCLUDED."TotalCount",
+			"StartTime" = EXCLUDED."StartTime",
+			"LastUpdateTime" = EXCLUDED."LastUpdateTime",
+			"ResumeToken" = EXCLUDED."ResumeToken",
+			"RulesVersion" = COALESCE(EXCLUDED."RulesVersion", "MigrationCheckpoints"."RulesVersion")`,
+		progress.MigrationName,
+		progress.LastProcessedID,
+		progress.ProcessedCount,
+		progress.TotalCount,
+		progress.StartTime,
+		progress.LastUpdateTime,
+		progress.ResumeToken,
+		progress.RulesVersion,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save checkpoint %s: %w", progress.MigrationName, err)
+	}
+	return nil
+}
+
+// FileCheckpointStore keeps checkpoints for all migrations in a single JSON file
+type FileCheckpointStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileCheckpointStore returns a store backed by the JSON file at path
+func NewFileCheckpointStore(path string) *FileCheckpointStore {
+	return &FileCheckpointStore{path: path}
+}
+
+// Load returns the stored progress for a migration
+func (s *FileCheckpointStore) Load(ctx context.Context, migrationName string) (*MigrationProgress, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all, err := s.readAll()
+	if err != nil {
+		return nil, err
+	}
+	progress, ok := all[migrationName]
+	if !ok {
+		return nil, nil
+	}
+	return &progress, nil
+}
+
+// Save records the progress for a migration, rewriting the file atomically
+func (s *FileCheckpointStore) Save(ctx context.Context, progress MigrationProgress) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all, err := s.readAll()
+	if err != nil {
+		return err
+	}
+	all[progress.MigrationName] = progress
+
+	data, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoints: %w", err)
+	}
+
+	// Write to a temp file and rename so a crash never leaves a truncated checkpoint
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create checkpoint temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write checkpoint file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync checkpoint file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close checkpoint file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to replace checkpoint file: %w", err)
+	}
+	return nil
+}
+
+// readAll reads every checkpoint in the file; a missing file means no checkpoints
+func (s *FileCheckpointStore) readAll() (map[string]MigrationProgress, error) {
+	all := make(map[string]MigrationProgress)
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return all, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint file: %w", err)
+	}
+	if len(data) == 0 {
+		return all, nil
+	}
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint file %s: %w", s.path, err)
+	}
+	return all, nil
+}
+
+// pendingBatch is a batch that has been handed to the workers but not yet folded into the checkpoint
+type pendingBatch struct {
+	position string
+	count    int
+	done     bool
+	failed   bool
+}
+
+// CheckpointTracker maintains the source position (the _id for MongoDB) before which every batch
+// has been committed. Workers finish batches out of order, so batches are registered in read
+// order and the checkpoint only advances over a contiguous prefix of completed batches.
+type CheckpointTracker struct {
+	store    CheckpointStore
+	progress MigrationProgress
+
+	pending    []*pendingBatch
+	byPosition map[string]*pendingBatch
+
+	mu sync.Mutex
+}
+
+// NewCheckpointTracker loads the last checkpoint for migrationName from store.
+// A nil store keeps progress in memory only (used for dry runs).
+func NewCheckpointTracker(ctx context.Context, store CheckpointStore, migrationName string) (*CheckpointTracker, error) {
+	tracker := &CheckpointTracker{
+		store:      store,
+		progress:   MigrationProgress{MigrationName: migrationName, StartTime: time.Now().UTC()},
+		byPosition: make(map[string]*pendingBatch),
+	}
+
+	if store == nil {
+		return tracker, nil
+	}
+
+	saved, err := store.Load(ctx, migrationName)
+	if err != nil {
+		return nil, err
+	}
+	if saved != nil {
+		tracker.progress = *saved
+		log.Printf("Loaded checkpoint %s: last position %s, %d documents committed, last update %s",
+			migrationName, saved.LastProcessedID, saved.ProcessedCount, saved.LastUpdateTime.Format(time.RFC3339))
+	}
+	return tracker, nil
+}
+
+// Name returns the migration name this tracker records progress for
+func (c *CheckpointTracker) Name() string {
+	return c.progress.MigrationName
+}
+
+// LastProcessedID returns the source position up to which all work has been committed
+func (c *CheckpointTracker) LastProcessedID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.progress.LastProcessedID
+}
+
+// ProcessedCount returns the number of documents behind the checkpoint
+func (c *CheckpointTracker) ProcessedCount() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.progress.ProcessedCount
+}
+
+// Override moves the checkpoint to an explicit position, e.g. from MIGRATION_RESUME_FROM_ID
+func (c *CheckpointTracker) Override(lastProcessedID string, processedCount int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.progress.LastProcessedID = lastProcessedID
+	c.progress.ProcessedCount = processedCount
+}
+
+// SetTotal records the total document count of the source collection
+func (c *CheckpointTracker) SetTotal(total int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.progress.TotalCount = total
+}
+
+// SetRulesVersion records the normalization rule set of a committed batch with the checkpoint
+func (c *CheckpointTracker) SetRulesVersion(version string) {
+	if version == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.progress.RulesVersion != "" && c.progress.RulesVersion != version {
+		log.Printf("Checkpoint %s now records normalization rules %s (was %s)", c.progress.MigrationName, version, c.progress.RulesVersion)
+	}
+	c.progress.RulesVersion = version
+}
+
+// Register records a batch ending at position that is about to be handed to the workers.
+// Batches must be registered in read order.
+func (c *CheckpointTracker) Register(position string, count int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	batch := &pendingBatch{position: position, count: count}
+	c.pending = append(c.pending, batch)
+	c.byPosition[position] = batch
+}
+
+// Complete marks the batch ending at position as committed and persists the checkpoint if it advanced
+func (c *CheckpointTracker) Complete(ctx context.Context, position string) error {
+	c.mu.Lock()
+	batch, ok := c.byPosition[position]
+	if !ok {
+		c.mu.Unlock()
+		return nil
+	}
+	batch.done = true
+
+	advanced := false
+	for len(c.pending) > 0 && c.pending[0].done {
+		head := c.pending[0]
+		c.pending = c.pending[1:]
+		delete(c.byPosition, head.position)
+
+		c.progress.LastProcessedID = head.position
+		c.progress.ProcessedCount += int64(head.count)
+		advanced = true
+	}
+	c.progress.LastUpdateTime = time.Now().UTC()
+	snapshot := c.progress
+	c.mu.Unlock()
+
+	if !advanced || c.store == nil {
+		return nil
+	}
+	return c.store.Save(ctx, snapshot)
+}
+
+// Fail marks the batch ending at position as not committed. The checkpoint will not advance past
+// it for the rest of this run, so the batch is read again on the next run.
+func (c *CheckpointTracker) Fail(position string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	batch, ok := c.byPosition[position]
+	if !ok || batch.failed {
+		return
+	}
+	batch.failed = true
+	log.Printf("Warning: batch ending at %s was not committed; checkpoint %s will not advance past %s",
+		position, c.progress.MigrationName, c.progress.LastProcessedID)
+}
+
+// Flush persists the current checkpoint
+func (c *CheckpointTracker) Flush(ctx context.Context) error {
+	if c.store == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	c.progress.LastUpdateTime = time.Now().UTC()
+	snapshot := c.progress
+	c.mu.Unlock()
+
+	if snapshot.LastProcessedID == "" {
+		return nil // Nothing committed yet
+	}
+	return c.store.Save(ctx, snapshot)
+}
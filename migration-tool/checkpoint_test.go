@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+// memoryCheckpointStore keeps every saved checkpoint in memory
+type memoryCheckpointStore struct {
+	saved []MigrationProgress
+}
+
+func (s *memoryCheckpointStore) Load(ctx context.Context, migrationName string) (*MigrationProgress, error) {
+	if len(s.saved) == 0 {
+		return nil, nil
+	}
+	progress := s.saved[len(s.saved)-1]
+	return &progress, nil
+}
+
+func (s *memoryCheckpointStore) Save(ctx context.Context, progress MigrationProgress) error {
+	s.saved = append(s.saved, progress)
+	return nil
+}
+
+func TestCheckpointTrackerAdvancesOverCompletedBatches(t *testing.T) {
+	type op struct {
+		fail     bool
+		position string
+	}
+	complete := func(position string) op { return op{position: position} }
+	fail := func(position string) op { return op{fail: true, position: position} }
+
+	// Every test registers batches "a" to "d" of 10 documents each, in that order
+	tests := []struct {
+		name      string
+		ops       []op
+		wantID    string
+		wantCount int64
+		wantSaves int
+	}{
+		{"in order", []op{complete("a"), complete("b"), complete("c")}, "c", 30, 3},
+		{"out of order", []op{complete("c"), complete("b")}, "", 0, 0},
+		{"gap filled", []op{complete("c"), complete("b"), complete("a")}, "c", 30, 1},
+		{"gap filled by stages", []op{complete("b"), complete("a"), complete("d"), complete("c")}, "d", 40, 2},
+		{"failed head", []op{fail("a"), complete("b"), complete("c"), complete("d")}, "", 0, 0},
+		{"out-of-order fail", []op{complete("a"), complete("c"), fail("b"), complete("d")}, "a", 10, 1},
+		{"fail after later batches completed", []op{complete("d"), complete("c"), fail("b"), complete("a")}, "a", 10, 1},
+		{"failed tail", []op{complete("a"), complete("b"), complete("c"), fail("d")}, "c", 30, 3},
+		{"unknown position", []op{complete("x"), fail("y")}, "", 0, 0},
+		{"completed twice", []op{complete("a"), complete("a"), complete("b")}, "b", 20, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &memoryCheckpointStore{}
+			tracker, err := NewCheckpointTracker(context.Background(), store, "test")
+			if err != nil {
+				t.Fatalf("NewCheckpointTracker: %v", err)
+			}
+			for _, position := range []string{"a", "b", "c", "d"} {
+				tracker.Register(position, 10)
+			}
+			for _, op := range tt.ops {
+				if op.fail {
+					tracker.Fail(op.position)
+				} else if err := tracker.Complete(context.Background(), op.position); err != nil {
+					t.Fatalf("Complete(%s): %v", op.position, err)
+				}
+			}
+
+			if got := tracker.LastProcessedID(); got != tt.wantID {
+				t.Errorf("LastProcessedID() = %q, want %q", got, tt.wantID)
+			}
+			if got := tracker.ProcessedCount(); got != tt.wantCount {
+				t.Errorf("ProcessedCount() = %d, want %d", got, tt.wantCount)
+			}
+			if len(store.saved) != tt.wantSaves {
+				t.Fatalf("saved %d checkpoints, want %d", len(store.saved), tt.wantSaves)
+			}
+			if tt.wantSaves > 0 {
+				last := store.saved[len(store.saved)-1]
+				if last.LastProcessedID != tt.wantID || last.ProcessedCount != tt.wantCount {
+					t.Errorf("last saved checkpoint = %s/%d, want %s/%d", last.LastProcessedID, last.ProcessedCount, tt.wantID, tt.wantCount)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckpointTrackerResumes(t *testing.T) {
+	store := &memoryCheckpointStore{saved: []MigrationProgress{{MigrationName: "test", LastProcessedID: "b", ProcessedCount: 20}}}
+	tracker, err := NewCheckpointTracker(context.Background(), store, "test")
+	if err != nil {
+		t.Fatalf("NewCheckpointTracker: %v", err)
+	}
+	if got := tracker.LastProcessedID(); got != "b" {
+		t.Fatalf("LastProcessedID() = %q, want the saved %q", got, "b")
+	}
+
+	tracker.Register("c", 5)
+	if err := tracker.Complete(context.Background(), "c"); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if got := tracker.ProcessedCount(); got != 25 {
+		t.Errorf("ProcessedCount() = %d, want 25", got)
+	}
+}
+
+func TestCheckpointTrackerWithoutStore(t *testing.T) {
+	tracker, err := NewCheckpointTracker(context.Background(), nil, "dry-run")
+	if err != nil {
+		t.Fatalf("NewCheckpointTracker: %v", err)
+	}
+	tracker.Register("a", 3)
+	if err := tracker.Complete(context.Background(), "a"); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if err := tracker.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if got := tracker.LastProcessedID(); got != "a" {
+		t.Errorf("LastProcessedID() = %q, want %q", got, "a")
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CircuitState is the state of a CircuitBreaker
+type CircuitState int
+
+const (
+	CircuitClosed   CircuitState = iota // writes flow normally
+	CircuitHalfOpen                     // the health probe passed, the next write decides
+	CircuitOpen                         // writes are paused until the health probe passes
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitHalfOpen:
+		return "half-open"
+	case CircuitOpen:
+		return "open"
+	default:
+		return "closed"
+	}
+}
+
+// CircuitBreaker pauses all PostgreSQL writers once consecutive writes fail with network errors,
+// instead of letting every worker retry on its own while the reader keeps pulling documents.
+// While open it probes the database every probe interval; once the probe passes it half-opens,
+// and the first write to succeed closes it again.
+// All methods are safe to call on a nil *CircuitBreaker, which never opens.
+type CircuitBreaker struct {
+	threshold     int
+	probeInterval time.Duration
+	probe         func(ctx context.Context) error
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	state    CircuitState
+	failures int // consecutive network failures
+	openedAt time.Time
+	stop     chan struct{}
+
+	transitions *prometheus.CounterVec
+}
+
+// NewCircuitBreaker creates a closed breaker that opens after threshold consecutive network
+// failures and then runs probe every probeInterval
+func NewCircuitBreaker(threshold int, probeInterval time.Duration, probe func(ctx context.Context) error) *CircuitBreaker {
+	b := &CircuitBreaker{
+		threshold:     max(threshold, 1),
+		probeInterval: probeInterval,
+		probe:         probe,
+		stop:          make(chan struct{}),
+		transitions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "migration_circuit_transitions_total",
+			Help: "PostgreSQL circuit breaker state transitions, by new state.",
+		}, []string{"state"}),
+	}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// State returns the current state
+func (b *CircuitBreaker) State() CircuitState {
+	if b == nil {
+		return CircuitClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Wait blocks while the breaker is open. It returns false if ctx is cancelled first.
+func (b *CircuitBreaker) Wait(ctx context.Context) bool {
+	if b == nil {
+		return ctx.Err() == nil
+	}
+	stop := context.AfterFunc(ctx, func() {
+		b.mu.Lock()
+		b.cond.Broadcast()
+		b.mu.Unlock()
+	})
+	defer stop()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for b.state == CircuitOpen {
+		if ctx.Err() != nil {
+			return false
+		}
+		b.cond.Wait()
+	}
+	return ctx.Err() == nil
+}
+
+// Record feeds the outcome of a write to the breaker. Only network errors count as failures:
+// any other result, including a rejected row, shows the database is reachable.
+func (b *CircuitBreaker) Record(err error) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil || classifyError(err) != ErrorClassNetwork {
+		b.failures = 0
+		if b.state != CircuitClosed {
+			log.Printf("✅ PostgreSQL writes succeed again after %v, resuming", time.Since(b.openedAt).Round(time.Second))
+			b.transition(CircuitClosed)
+		}
+		return
+	}
+
+	b.failures++
+	switch {
+	case b.state == CircuitHalfOpen:
+		log.Printf("⛔ PostgreSQL write failed after the health probe passed, pausing writes again: %v", err)
+		b.open()
+	case b.state == CircuitClosed && b.failures >= b.threshold:
+		log.Printf("⛔ %d consecutive PostgreSQL writes failed, pausing reader and workers until the database recovers: %v", b.failures, err)
+		b.open()
+	}
+}
+
+// open moves to CircuitOpen and starts probing; called with b.mu held
+func (b *CircuitBreaker) open() {
+	if b.state == CircuitClosed {
+		b.openedAt = time.Now()
+	}
+	b.transition(CircuitOpen)
+	go b.probeLoop()
+}
+
+// transition changes state and wakes waiters; called with b.mu held
+func (b *CircuitBreaker) transition(state CircuitState) {
+	b.state = state
+	b.transitions.WithLabelValues(state.String()).Inc()
+	b.cond.Broadcast()
+}
+
+// probeLoop probes the database until the probe passes or the breaker is stopped
+func (b *CircuitBreaker) probeLoop() {
+	ticker := time.NewTicker(b.probeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), b.probeInterval)
+		err := b.probe(ctx)
+		cancel()
+
+		b.mu.Lock()
+		if b.state != CircuitOpen {
+			b.mu.Unlock()
+			return
+		}
+		if err != nil {
+			log.Printf("PostgreSQL health probe failed (writes paused for %v): %v", time.Since(b.openedAt).Round(time.Second), err)
+			b.mu.Unlock()
+			continue
+		}
+		log.Println("PostgreSQL health probe passed, resuming writes")
+		b.transition(CircuitHalfOpen)
+		b.mu.Unlock()
+		return
+	}
+}
+
+// Stop ends probing and releases any waiters
+func (b *CircuitBreaker) Stop() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	select {
+	case <-b.stop:
+	default:
+		close(b.stop)
+	}
+	if b.state == CircuitOpen {
+		b.transition(CircuitClosed)
+	}
+}
+
+// Collectors returns the Prometheus collectors exporting the breaker state
+func (b *CircuitBreaker) Collectors() []prometheus.Collector {
+	if b == nil {
+		return nil
+	}
+	return []prometheus.Collector{
+		b.transitions,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "migration_circuit_state",
+			Help: "PostgreSQL circuit breaker state (0 closed, 1 half-open, 2 open).",
+		}, func() float64 { return float64(b.State()) }),
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	errConnection = fmt.Errorf("insert: %w", &pq.Error{Code: "08006", Message: "connection failure"})
+	errRefused    = &pq.Error{Code: "23505", Message: "duplicate key value violates unique constraint"}
+)
+
+func TestCircuitBreakerRecord(t *testing.T) {
+	type step struct {
+		err  error
+		want CircuitState
+	}
+	tests := []struct {
+		name      string
+		threshold int
+		steps     []step
+	}{
+		{"opens at threshold", 3, []step{
+			{errConnection, CircuitClosed},
+			{errConnection, CircuitClosed},
+			{errConnection, CircuitOpen},
+		}},
+		{"success resets the count", 2, []step{
+			{errConnection, CircuitClosed},
+			{nil, CircuitClosed},
+			{errConnection, CircuitClosed},
+			{errConnection, CircuitOpen},
+		}},
+		{"refused rows show the database is reachable", 2, []step{
+			{errConnection, CircuitClosed},
+			{errRefused, CircuitClosed},
+			{errConnection, CircuitClosed},
+		}},
+		{"other errors never open it", 1, []step{
+			{errRefused, CircuitClosed},
+			{errors.New("unrecognised"), CircuitClosed},
+			{&pq.Error{Code: "40P01"}, CircuitClosed},
+		}},
+		{"threshold of at least one", 0, []step{
+			{errConnection, CircuitOpen},
+		}},
+		{"a successful write closes an open breaker", 1, []step{
+			{errConnection, CircuitOpen},
+			{errConnection, CircuitOpen},
+			{nil, CircuitClosed},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The probe never runs within the test, so only Record changes the state
+			breaker := NewCircuitBreaker(tt.threshold, time.Hour, func(context.Context) error { return nil })
+			defer breaker.Stop()
+			for i, step := range tt.steps {
+				breaker.Record(step.err)
+				if got := breaker.State(); got != step.want {
+					t.Fatalf("after step %d (%v) state = %s, want %s", i+1, step.err, got, step.want)
+				}
+			}
+		})
+	}
+}
+
+// waitForState polls until the breaker reaches want
+func waitForState(t *testing.T, breaker *CircuitBreaker, want CircuitState) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for breaker.State() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("state = %s, want %s", breaker.State(), want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want CircuitState
+	}{
+		{"success closes it", nil, CircuitClosed},
+		{"refused row closes it", errRefused, CircuitClosed},
+		{"network failure opens it again", errConnection, CircuitOpen},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var healthy atomic.Bool
+			var probes atomic.Int32
+			breaker := NewCircuitBreaker(1, time.Millisecond, func(context.Context) error {
+				probes.Add(1)
+				if !healthy.Load() {
+					return errConnection
+				}
+				return nil
+			})
+			defer breaker.Stop()
+
+			breaker.Record(errConnection)
+			if got := breaker.State(); got != CircuitOpen {
+				t.Fatalf("state = %s, want %s", got, CircuitOpen)
+			}
+			// Failing probes keep it open
+			for probes.Load() < 3 {
+				time.Sleep(time.Millisecond)
+			}
+			if got := breaker.State(); got != CircuitOpen {
+				t.Fatalf("state after failed probes = %s, want %s", got, CircuitOpen)
+			}
+
+			healthy.Store(true)
+			waitForState(t, breaker, CircuitHalfOpen)
+
+			healthy.Store(false)
+			breaker.Record(tt.err)
+			if got := breaker.State(); got != tt.want {
+				t.Errorf("state = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerWait(t *testing.T) {
+	breaker := NewCircuitBreaker(1, time.Hour, func(context.Context) error { return nil })
+	if !breaker.Wait(context.Background()) {
+		t.Fatal("Wait on a closed breaker = false, want true")
+	}
+
+	breaker.Record(errConnection)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if breaker.Wait(ctx) {
+		t.Fatal("Wait on an open breaker returned true before it closed")
+	}
+
+	released := make(chan bool)
+	go func() { released <- breaker.Wait(context.Background()) }()
+	breaker.Stop()
+	select {
+	case ok := <-released:
+		if !ok {
+			t.Error("Wait after Stop = false, want true")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop did not release the waiting writer")
+	}
+	if got := breaker.State(); got != CircuitClosed {
+		t.Errorf("state after Stop = %s, want %s", got, CircuitClosed)
+	}
+}
+
+func TestNilCircuitBreaker(t *testing.T) {
+	var breaker *CircuitBreaker
+	breaker.Record(errConnection)
+	if got := breaker.State(); got != CircuitClosed {
+		t.Errorf("State() = %s, want %s", got, CircuitClosed)
+	}
+	if !breaker.Wait(context.Background()) {
+		t.Error("Wait() = false, want true")
+	}
+	breaker.Stop()
+}
@@ -0,0 +1,496 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// command is a CLI subcommand
+type command struct {
+	name    string
+	summary string
+	// flags registers the command's flags, bound to the loaded config; nil for commands without config
+	flags func(fs *flag.FlagSet, config *Config)
+	run   func(config *Config, fs *flag.FlagSet) error
+}
+
+// commands lists the CLI subcommands in the order they are shown in the usage
+var commands = []*command{
+	{
+		name:    "migrate",
+		summary: "Copy the MongoDB collection or export files into PostgreSQL and/or NDJSON and Parquet files, resuming from the last checkpoint (default)",
+		flags: func(fs *flag.FlagSet, config *Config) {
+			sourceFlags(fs, config)
+			sinkFlags(fs, config)
+			connectionFlags(fs, config)
+			pipelineFlags(fs, config)
+			checkpointFlags(fs, config)
+			deadLetterFlags(fs, config)
+		},
+		run: runWithTool(func(ctx context.Context, tool *MigrationTool) error {
+			if err := tool.Migrate(ctx); err != nil {
+				return fmt.Errorf("migration failed: %w", err)
+			}
+			log.Println("Migration completed successfully!")
+			return nil
+		}),
+	},
+	{
+		name:    "sync",
+		summary: "Run the initial load, then tail the MongoDB change stream",
+		flags: func(fs *flag.FlagSet, config *Config) {
+			sinkFlags(fs, config)
+			connectionFlags(fs, config)
+			pipelineFlags(fs, config)
+			checkpointFlags(fs, config)
+			deadLetterFlags(fs, config)
+		},
+		run: runWithTool(func(ctx context.Context, tool *MigrationTool) error {
+			if err := tool.Sync(ctx); err != nil {
+				return fmt.Errorf("sync failed: %w", err)
+			}
+			log.Println("Sync stopped")
+			return nil
+		}),
+	},
+	{
+		name:    "verify",
+		summary: "Compare MongoDB with ThreatEvents and write a discrepancy report",
+		flags: func(fs *flag.FlagSet, config *Config) {
+			connectionFlags(fs, config)
+			fs.IntVar(&config.Migration.VerifySampleSize, "sample-size", config.Migration.VerifySampleSize, "documents compared field by field (0 to skip)")
+			fs.StringVar(&config.Migration.VerifyReport, "report", config.Migration.VerifyReport, "file receiving the JSON report (stdout if empty)")
+		},
+		run: runWith(NewReadOnlyTool, func(ctx context.Context, tool *MigrationTool) error {
+			migration := tool.config.Migration
+			if err := tool.Verify(ctx, migration.VerifySampleSize, migration.VerifyReport); err != nil {
+				return fmt.Errorf("verify failed: %w", err)
+			}
+			return nil
+		}),
+	},
+	{
+		name:    "replay",
+		summary: "Re-run dead-lettered documents through the pipeline",
+		flags: func(fs *flag.FlagSet, config *Config) {
+			sinkFlags(fs, config)
+			connectionFlags(fs, config)
+			pipelineFlags(fs, config)
+			deadLetterFlags(fs, config)
+		},
+		run: runWithTool(func(ctx context.Context, tool *MigrationTool) error {
+			if err := tool.ReplayDeadLetters(ctx); err != nil {
+				return fmt.Errorf("replay failed: %w", err)
+			}
+			return nil
+		}),
+	},
+	{
+		name:    "restore-indexes",
+		summary: "Rebuild ThreatEvents indexes left suspended by an interrupted load",
+		flags: func(fs *flag.FlagSet, config *Config) {
+			connectionFlags(fs, config)
+			fs.StringVar(&config.Migration.MigrationName, "name", config.Migration.MigrationName, "migration whose suspended indexes are rebuilt")
+		},
+		run: runWithTool(func(ctx context.Context, tool *MigrationTool) error {
+			if err := tool.RestoreIndexes(ctx); err != nil {
+				return fmt.Errorf("index restore failed: %w", err)
+			}
+			return nil
+		}),
+	},
+	{
+		name:    "health",
+		summary: "Check MongoDB and PostgreSQL connectivity",
+		flags: func(fs *flag.FlagSet, config *Config) {
+			connectionFlags(fs, config)
+			fs.Duration("timeout", 30*time.Second, "overall health check timeout")
+		},
+		run: func(config *Config, fs *flag.FlagSet) error {
+			if err := config.Validate(); err != nil {
+				return fmt.Errorf("invalid configuration: %w", err)
+			}
+			tool, err := NewReadOnlyTool(config)
+			if err != nil {
+				return fmt.Errorf("failed to create migration tool: %w", err)
+			}
+			defer tool.Close()
+
+			timeout := fs.Lookup("timeout").Value.(flag.Getter).Get().(time.Duration)
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			if err := tool.HealthCheck(ctx); err != nil {
+				return fmt.Errorf("health check failed: %w", err)
+			}
+			return nil
+		},
+	},
+	{
+		name:    "config",
+		summary: "Configuration helpers: 'config print' shows the effective configuration with secrets redacted",
+		flags: func(fs *flag.FlagSet, config *Config) {
+			sourceFlags(fs, config)
+			sinkFlags(fs, config)
+			connectionFlags(fs, config)
+			pipelineFlags(fs, config)
+			checkpointFlags(fs, config)
+			deadLetterFlags(fs, config)
+			fs.IntVar(&config.Migration.VerifySampleSize, "sample-size", config.Migration.VerifySampleSize, "documents compared field by field by verify")
+			fs.StringVar(&config.Migration.VerifyReport, "report", config.Migration.VerifyReport, "file receiving the verify report")
+			fs.String("format", "yaml", "output format: yaml or toml")
+		},
+		run: func(config *Config, fs *flag.FlagSet) error {
+			if fs.NArg() == 0 || fs.Arg(0) != "print" {
+				return fmt.Errorf("usage: migration-tool config print [flags]")
+			}
+			// Flag parsing stops at "print", so parse whatever follows it as well
+			if err := fs.Parse(fs.Args()[1:]); err != nil {
+				return err
+			}
+			return printConfig(os.Stdout, config.Redacted(), fs.Lookup("format").Value.String())
+		},
+	},
+	{
+		name:    "rules",
+		summary: "Normalization rule helpers: 'rules check' validates a rule file without connecting to anything, 'rules match <field> <value>' shows how a value is normalized",
+		flags: func(fs *flag.FlagSet, config *Config) {
+			fs.StringVar(&config.Migration.RulesFile, "rules", config.Migration.RulesFile, "YAML or JSON rule file to use (the built-in rules if empty)")
+			fs.StringVar(&config.Migration.ServiceNamesFile, "service-names", config.Migration.ServiceNamesFile, "IANA service-name registry CSV to infer services from (the built-in registry if empty)")
+		},
+		run: func(config *Config, fs *flag.FlagSet) error {
+			usage := fmt.Errorf("usage: migration-tool rules check [-rules file] | rules match [-rules file] [-service-names file] <category|country|protocol|application_protocol|malware_family> <value>")
+			if fs.NArg() == 0 || (fs.Arg(0) != "check" && fs.Arg(0) != "match") {
+				return usage
+			}
+			command := fs.Arg(0)
+			if err := fs.Parse(fs.Args()[1:]); err != nil {
+				return err
+			}
+			store, err := NewRuleStore(config.Migration.RulesFile)
+			if err != nil {
+				return err
+			}
+			rules := store.Rules()
+
+			if command == "match" {
+				if fs.NArg() < 2 {
+					return usage
+				}
+				services, err := loadServiceRegistry(config.Migration.ServiceNamesFile)
+				if err != nil {
+					return err
+				}
+				client := &PostgreSQLClient{rules: store, services: services}
+				value := strings.Join(fs.Args()[1:], " ")
+				var match RuleMatch
+				switch fs.Arg(0) {
+				case "category":
+					match = client.matchCategory(value)
+				case "country":
+					match = client.matchCountry(value)
+				case "protocol":
+					match = client.matchProtocol(value)
+				case "application_protocol":
+					match = client.matchApplicationProtocol(value)
+				case "malware_family":
+					match = client.matchMalwareFamily(value)
+				default:
+					return usage
+				}
+				fmt.Printf("%q -> %s\n", value, match)
+				return nil
+			}
+
+			fmt.Printf("Rules %s (%s) are valid\n", rules.Version, rules.Source)
+			for _, table := range []struct {
+				name  string
+				table *ruleTable
+			}{
+				{"category", rules.Category},
+				{"country", rules.Country},
+				{"protocol", rules.Protocol},
+				{"application_protocol", rules.ApplicationProtocol},
+				{"malware_family", rules.MalwareFamily},
+			} {
+				fmt.Printf("  %-21s %d aliases, %d patterns, %d terms, fuzzy %g, default %q\n", table.name,
+					len(table.table.aliases), len(table.table.patterns), len(table.table.terms), table.table.fuzzy, table.table.def)
+			}
+			return nil
+		},
+	},
+	{name: "test", summary: "Run the transformation self-test", run: func(*Config, *flag.FlagSet) error {
+		TestTransformation()
+		return nil
+	}},
+	{name: "test-batch", summary: "Run the batch processing self-tests", run: func(*Config, *flag.FlagSet) error {
+		TestBatchProcessing()
+		TestBatchProcessingWithSampleData()
+		return nil
+	}},
+	{name: "test-utf8", summary: "Run the UTF-8 sanitization self-tests", run: func(*Config, *flag.FlagSet) error {
+		TestUTF8Sanitization()
+		TestNormalizationWithSanitization()
+		return nil
+	}},
+	{name: "test-aggressive", summary: "Run the aggressive sanitization self-test", run: func(*Config, *flag.FlagSet) error {
+		TestAggressiveSanitization()
+		return nil
+	}},
+}
+
+// Execute parses the command line and runs the selected command. Without a command (or when the
+// first argument is a flag) it runs migrate, so existing invocations keep working.
+func Execute(args []string) error {
+	name := "migrate"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" {
+		printUsage(os.Stdout)
+		return nil
+	}
+
+	cmd := findCommand(name)
+	if cmd == nil {
+		printUsage(os.Stderr)
+		return fmt.Errorf("unknown command %q", name)
+	}
+
+	fs := flag.NewFlagSet("migration-tool "+cmd.name, flag.ContinueOnError)
+	var config *Config
+	if cmd.flags != nil {
+		// The config file has to be loaded before the flags are defined, since flag defaults
+		// come from it, so it is picked out of the arguments ahead of parsing
+		var err error
+		config, err = LoadConfig(configPathFromArgs(args))
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %w", err)
+		}
+		fs.String("config", "", "YAML or TOML config file (default $MIGRATION_CONFIG_FILE)")
+		cmd.flags(fs, config)
+	}
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	return cmd.run(config, fs)
+}
+
+// runWithTool wraps a command body with config validation, MigrationTool setup and
+// cancellation on SIGINT/SIGTERM
+func runWithTool(body func(ctx context.Context, tool *MigrationTool) error) func(*Config, *flag.FlagSet) error {
+	return runWith(NewMigrationTool, body)
+}
+
+// runWith is runWithTool with the MigrationTool built by newTool
+func runWith(newTool func(*Config) (*MigrationTool, error), body func(ctx context.Context, tool *MigrationTool) error) func(*Config, *flag.FlagSet) error {
+	return func(config *Config, _ *flag.FlagSet) error {
+		if err := config.Validate(); err != nil {
+			return fmt.Errorf("invalid configuration: %w", err)
+		}
+
+		migrationTool, err := newTool(config)
+		if err != nil {
+			return fmt.Errorf("failed to create migration tool: %w", err)
+		}
+		defer migrationTool.Close()
+
+		if config.Migration.MetricsAddr != "" {
+			stopMetrics, err := migrationTool.metrics.Serve(config.Migration.MetricsAddr)
+			if err != nil {
+				return err
+			}
+			defer stopMetrics()
+		}
+
+		// Set up context with cancellation for graceful shutdown
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		sigChan := make(chan os.Signal, 1)
+		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+		defer signal.Stop(sigChan)
+
+		go func() {
+			select {
+			case <-sigChan:
+				log.Println("Received interrupt signal, shutting down gracefully...")
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		return body(ctx, migrationTool)
+	}
+}
+
+// connectionFlags registers the database connection flags
+func connectionFlags(fs *flag.FlagSet, config *Config) {
+	fs.Var(&secretFlag{&config.MongoDB.URI}, "mongo-uri", "MongoDB connection URI")
+	fs.StringVar(&config.MongoDB.Database, "mongo-database", config.MongoDB.Database, "MongoDB database")
+	fs.StringVar(&config.MongoDB.Collection, "mongo-collection", config.MongoDB.Collection, "MongoDB collection")
+	fs.StringVar(&config.PostgreSQL.Host, "postgres-host", config.PostgreSQL.Host, "PostgreSQL host")
+	fs.IntVar(&config.PostgreSQL.Port, "postgres-port", config.PostgreSQL.Port, "PostgreSQL port")
+	fs.StringVar(&config.PostgreSQL.Database, "postgres-database", config.PostgreSQL.Database, "PostgreSQL database")
+	fs.StringVar(&config.PostgreSQL.Username, "postgres-username", config.PostgreSQL.Username, "PostgreSQL user")
+	fs.StringVar(&config.PostgreSQL.SSLMode, "postgres-sslmode", config.PostgreSQL.SSLMode, "PostgreSQL sslmode")
+}
+
+// sourceFlags registers the flags selecting where documents are read from
+func sourceFlags(fs *flag.FlagSet, config *Config) {
+	fs.StringVar(&config.Source.Type, "source", config.Source.Type, "read documents from mongodb, ndjson (mongoexport) or bson (mongodump) files")
+	fs.StringVar(&config.Source.Path, "source-path", config.Source.Path, "export file, directory or glob pattern read by the ndjson and bson sources")
+}
+
+// sinkFlags registers the flags selecting where records are written
+func sinkFlags(fs *flag.FlagSet, config *Config) {
+	fs.Func("sink", "comma-separated sinks: postgres, ndjson and/or parquet (default "+strings.Join(config.Sink.Types, ",")+")", func(value string) error {
+		config.Sink.Types = splitList(value)
+		return nil
+	})
+	fs.StringVar(&config.Sink.NDJSONPath, "sink-ndjson", config.Sink.NDJSONPath, "file the ndjson sink appends records to")
+	fs.StringVar(&config.Sink.ParquetDir, "sink-parquet-dir", config.Sink.ParquetDir, "directory receiving the parquet sink's part files")
+	fs.IntVar(&config.Sink.ParquetFileRows, "sink-parquet-file-rows", config.Sink.ParquetFileRows, "records per parquet part file (0 for one file per run)")
+}
+
+// pipelineFlags registers the batching, worker and ingestion tuning flags
+func pipelineFlags(fs *flag.FlagSet, config *Config) {
+	m := &config.Migration
+	fs.IntVar(&m.BatchSize, "batch-size", m.BatchSize, "documents per batch")
+	fs.IntVar(&m.WorkerCount, "workers", m.WorkerCount, "concurrent batch workers")
+	fs.IntVar(&m.BufferSize, "buffer-size", m.BufferSize, "batches buffered between reader and workers")
+	fs.IntVar(&m.ConnectionPoolSize, "pool-size", m.ConnectionPoolSize, "PostgreSQL connection pool size")
+	fs.IntVar(&m.MaxRetries, "max-retries", m.MaxRetries, "retries per failed batch")
+	fs.IntVar(&m.RetryDelaySeconds, "retry-delay", m.RetryDelaySeconds, "seconds before the first batch retry, doubling on each further retry")
+	fs.IntVar(&m.RetryTransient.MaxAttempts, "retry-transient", m.RetryTransient.MaxAttempts, "insert retries after serialization failures, deadlocks and lock or resource contention")
+	fs.IntVar(&m.RetryNetwork.MaxAttempts, "retry-network", m.RetryNetwork.MaxAttempts, "insert retries after connection and network errors")
+	fs.IntVar(&m.RetryUnknown.MaxAttempts, "retry-unknown", m.RetryUnknown.MaxAttempts, "insert retries after unclassified errors")
+	fs.IntVar(&m.BreakerThreshold, "breaker-threshold", m.BreakerThreshold, "consecutive network write failures that pause the pipeline (0 disables the circuit breaker)")
+	fs.IntVar(&m.BreakerProbeIntervalSeconds, "breaker-probe-interval", m.BreakerProbeIntervalSeconds, "seconds between PostgreSQL health probes while paused")
+	fs.StringVar(&m.SpoolDir, "spool-dir", m.SpoolDir, "spool batches to this directory while PostgreSQL is unreachable")
+	fs.IntVar(&m.SpoolMaxMB, "spool-max-mb", m.SpoolMaxMB, "spool size in MiB at which workers block until it drains (0 for no limit)")
+	fs.StringVar(&m.RulesFile, "rules", m.RulesFile, "YAML or JSON normalization rule file (built-in rules if empty)")
+	fs.BoolVar(&m.RulesReload, "rules-reload", m.RulesReload, "reload the rule file when it changes")
+	fs.StringVar(&m.ServiceNamesFile, "service-names", m.ServiceNamesFile, "IANA service-name registry CSV to infer services from ports (built-in registry if empty)")
+	fs.IntVar(&m.LookupCacheSize, "lookup-cache-size", m.LookupCacheSize, "values cached per lookup table, least recently used first out (0 caches every value)")
+	fs.IntVar(&m.LookupCacheRefreshSeconds, "lookup-cache-refresh", m.LookupCacheRefreshSeconds, "seconds between lookup cache reloads (0 disables refreshing)")
+	fs.IntVar(&m.BatchTimeoutSeconds, "batch-timeout", m.BatchTimeoutSeconds, "seconds before a batch times out")
+	fs.IntVar(&m.ProgressReportInterval, "progress-interval", m.ProgressReportInterval, "seconds between progress reports")
+	fs.BoolVar(&m.UseCopy, "use-copy", m.UseCopy, "use COPY for large batches")
+	fs.IntVar(&m.CopyThreshold, "copy-threshold", m.CopyThreshold, "minimum batch size for COPY")
+	fs.BoolVar(&m.AdaptiveCopy, "copy-adaptive", m.AdaptiveCopy, "tune batch size, COPY threshold and workers toward the target rows/sec")
+	fs.IntVar(&m.CopyTargetRowsPerSec, "copy-target-rps", m.CopyTargetRowsPerSec, "insert rows per second targeted by -copy-adaptive")
+	fs.BoolVar(&m.DryRun, "dry-run", m.DryRun, "validate and transform only, without writing")
+	fs.StringVar(&m.MetricsAddr, "metrics-addr", m.MetricsAddr, "serve Prometheus metrics on this address, e.g. :9100")
+}
+
+// checkpointFlags registers the resume / checkpoint flags
+func checkpointFlags(fs *flag.FlagSet, config *Config) {
+	m := &config.Migration
+	fs.StringVar(&m.MigrationName, "name", m.MigrationName, "name under which checkpoints are recorded")
+	fs.StringVar(&m.CheckpointFile, "checkpoint-file", m.CheckpointFile, "JSON checkpoint file instead of the MigrationCheckpoints table")
+	fs.StringVar(&m.ResumeFromID, "resume-from", m.ResumeFromID, "resume after this source position (MongoDB _id or <file>:<offset>), overriding the checkpoint")
+}
+
+// deadLetterFlags registers the dead-letter store flags
+func deadLetterFlags(fs *flag.FlagSet, config *Config) {
+	m := &config.Migration
+	fs.StringVar(&m.DeadLetterFile, "dead-letter-file", m.DeadLetterFile, "JSONL file receiving rejected documents")
+	fs.BoolVar(&m.DeadLetterTable, "dead-letter-table", m.DeadLetterTable, "write rejected documents to the MigrationDeadLetters table")
+}
+
+// secretFlag is a string flag whose default is shown redacted in the usage
+type secretFlag struct {
+	value *string
+}
+
+func (f *secretFlag) String() string {
+	if f == nil || f.value == nil {
+		return ""
+	}
+	return redactURI(*f.value)
+}
+
+func (f *secretFlag) Set(s string) error {
+	*f.value = s
+	return nil
+}
+
+// configPathFromArgs returns the value of a -config / --config argument, if present
+func configPathFromArgs(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		name := strings.TrimLeft(arg, "-")
+		if name == arg {
+			continue
+		}
+		if value, ok := strings.CutPrefix(name, "config="); ok {
+			return value
+		}
+		if name == "config" && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+// findCommand looks up a command by name
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// printUsage lists the available commands
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: migration-tool [command] [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-16s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Configuration is layered: defaults, then -config file (YAML or TOML), then environment, then flags.")
+	fmt.Fprintln(w, "Run 'migration-tool <command> -h' for the flags of a command.")
+}
+
+// printConfig writes the configuration as YAML or TOML
+func printConfig(w io.Writer, config *Config, format string) error {
+	switch format {
+	case "yaml", "yml":
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(config); err != nil {
+			return fmt.Errorf("failed to encode config: %w", err)
+		}
+		return encoder.Close()
+	case "toml":
+		if err := toml.NewEncoder(w).Encode(config); err != nil {
+			return fmt.Errorf("failed to encode config: %w", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported format %q (use yaml or toml)", format)
+	}
+}
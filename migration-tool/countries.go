@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/lib/pq"
+)
+
+//go:embed data/iso3166-1.tsv
+var iso3166Data string
+
+// Country is an ISO 3166-1 country
+type Country struct {
+	Alpha2  string
+	Alpha3  string
+	Numeric string // three digits, empty for user-assigned codes
+	Name    string
+}
+
+// countryIndex resolves country codes and names to countries
+type countryIndex struct {
+	current map[string]*Country // current alpha-2 codes
+	codes   map[string]*Country // alpha-2, alpha-3, numeric and former codes
+	names   map[string]*Country // keyed by countryNameKey
+}
+
+// countryNameKey reduces a country name to its lowercased words separated by single spaces,
+// so case, punctuation and spacing do not matter. Accents do, which is why the dataset lists
+// accented names with their plain spellings as well.
+func countryNameKey(name string) string {
+	tokens := tokenize(name)
+	words := make([]string, len(tokens))
+	for i, t := range tokens {
+		words[i] = t.text
+	}
+	return strings.Join(words, " ")
+}
+
+// parseCountries parses the tab-separated ISO 3166-1 dataset
+func parseCountries(data string) (*countryIndex, error) {
+	index := &countryIndex{
+		current: make(map[string]*Country),
+		codes:   make(map[string]*Country),
+		names:   make(map[string]*Country),
+	}
+
+	addCode := func(line int, code string, country *Country) error {
+		if existing, ok := index.codes[code]; ok {
+			return fmt.Errorf("line %d: code %s is already used by %s", line, code, existing.Alpha2)
+		}
+		index.codes[code] = country
+		return nil
+	}
+	addName := func(line int, name string, country *Country) error {
+		key := countryNameKey(name)
+		if key == "" {
+			return fmt.Errorf("line %d: empty name for %s", line, country.Alpha2)
+		}
+		if existing, ok := index.names[key]; ok && existing != country {
+			return fmt.Errorf("line %d: name %q is already used by %s", line, name, existing.Alpha2)
+		}
+		index.names[key] = country
+		return nil
+	}
+
+	for i, line := range strings.Split(data, "\n") {
+		lineNumber := i + 1
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 6 {
+			return nil, fmt.Errorf("line %d: expected 6 columns, got %d", lineNumber, len(fields))
+		}
+		country := &Country{Alpha2: fields[0], Alpha3: fields[1], Numeric: fields[2], Name: fields[3]}
+		if !isAlpha2(country.Alpha2) || len(country.Alpha3) != 3 || country.Name == "" {
+			return nil, fmt.Errorf("line %d: invalid country %q", lineNumber, line)
+		}
+		index.current[country.Alpha2] = country
+
+		codes := []string{country.Alpha2, country.Alpha3, country.Numeric}
+		codes = append(codes, strings.Split(fields[4], "|")...)
+		for _, code := range codes {
+			if code == "" {
+				continue
+			}
+			if err := addCode(lineNumber, code, country); err != nil {
+				return nil, err
+			}
+		}
+
+		names := append([]string{country.Name}, strings.Split(fields[5], "|")...)
+		for _, name := range names {
+			if name == "" {
+				continue
+			}
+			if err := addName(lineNumber, name, country); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return index, nil
+}
+
+var (
+	countriesOnce sync.Once
+	countries     *countryIndex
+)
+
+// countryData returns the embedded ISO 3166-1 dataset
+func countryData() *countryIndex {
+	countriesOnce.Do(func() {
+		index, err := parseCountries(iso3166Data)
+		if err != nil {
+			panic(fmt.Sprintf("embedded ISO 3166-1 dataset is invalid: %v", err))
+		}
+		countries = index
+	})
+	return countries
+}
+
+// CountryByCode returns the country with the current alpha-2 code
+func CountryByCode(alpha2 string) (Country, bool) {
+	country, ok := countryData().current[alpha2]
+	if !ok {
+		return Country{}, false
+	}
+	return *country, true
+}
+
+// LookupCountry resolves an alpha-2, alpha-3 or numeric code, a former code such as "UK", or
+// an English, Indonesian or common country name to its country
+func LookupCountry(value string) (Country, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return Country{}, false
+	}
+	index := countryData()
+
+	code := strings.ToUpper(value)
+	if isDigits(code) && len(code) <= 3 {
+		code = strings.Repeat("0", 3-len(code)) + code
+	}
+	if country, ok := index.codes[code]; ok {
+		return *country, true
+	}
+	if country, ok := index.names[countryNameKey(value)]; ok {
+		return *country, true
+	}
+	return Country{}, false
+}
+
+// isAlpha2 reports whether code is two uppercase ASCII letters
+func isAlpha2(code string) bool {
+	return len(code) == 2 && code[0] >= 'A' && code[0] <= 'Z' && code[1] >= 'A' && code[1] <= 'Z'
+}
+
+// isDigits reports whether s is a non-empty run of ASCII digits
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// fixCountryNames gives Countries rows with an ISO 3166-1 code the dataset's country name.
+// Earlier versions stored whatever raw value first produced a code, such as "INDONESIA" or "idn".
+func (p *PostgreSQLClient) fixCountryNames(ctx context.Context) (int64, error) {
+	index := countryData()
+	codes := make([]string, 0, len(index.current))
+	names := make([]string, 0, len(index.current))
+	for code, country := range index.current {
+		codes = append(codes, code)
+		names = append(names, country.Name)
+	}
+
+	result, err := p.db.ExecContext(ctx, `
+		UPDATE "Countries" c SET "Name" = v.name
+		FROM unnest($1::text[], $2::text[]) AS v(code, name)
+		WHERE c."Code" = v.code AND c."Name" IS DISTINCT FROM v.name`,
+		pq.Array(codes), pq.Array(names))
+	if err != nil {
+		return 0, fmt.Errorf("failed to update country names: %w", err)
+	}
+	return result.RowsAffected()
+}
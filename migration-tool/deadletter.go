@@ -0,0 +1,443 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lib/pq"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// DeadLetter is a document rejected by validation or transformation, kept so it can be replayed later
+type DeadLetter struct {
+	DocumentID  string          `json:"document_id"`
+	ErrorType   string          `json:"error_type"`
+	Message     string          `json:"message"`
+	Timestamp   time.Time       `json:"timestamp"`
+	RawDocument []byte          `json:"raw_bson"`           // original BSON, base64 in JSONL
+	Document    json.RawMessage `json:"document,omitempty"` // extended JSON rendering for humans
+}
+
+// NewDeadLetter builds a dead letter for a rejected document
+func NewDeadLetter(doc ThreatDocument, migErr MigrationError) DeadLetter {
+	letter := DeadLetter{
+		DocumentID: migErr.DocumentID,
+		ErrorType:  migErr.Type.String(),
+		Message:    migErr.Message,
+		Timestamp:  migErr.Timestamp,
+	}
+
+	raw, err := doc.RawBSON()
+	if err != nil {
+		log.Printf("Warning: could not encode rejected document %s: %v", migErr.DocumentID, err)
+		return letter
+	}
+	letter.RawDocument = raw
+	if ext, err := bson.MarshalExtJSON(raw, false, false); err == nil {
+		letter.Document = ext
+	}
+	return letter
+}
+
+// Decode turns the stored BSON back into a ThreatDocument
+func (d DeadLetter) Decode() (ThreatDocument, error) {
+	var doc ThreatDocument
+	if len(d.RawDocument) == 0 {
+		return doc, fmt.Errorf("dead letter %s has no stored document", d.DocumentID)
+	}
+	if err := bson.Unmarshal(d.RawDocument, &doc); err != nil {
+		return doc, fmt.Errorf("failed to decode dead letter %s: %w", d.DocumentID, err)
+	}
+	doc.Raw = bson.Raw(d.RawDocument)
+	return doc, nil
+}
+
+// DeadLetterStore stores rejected documents and hands them back for replay
+type DeadLetterStore interface {
+	// Write appends dead letters to the store
+	Write(ctx context.Context, letters []DeadLetter) error
+	// Replay passes stored dead letters to fn in batches. A batch is removed from the store when
+	// fn returns nil and kept otherwise. Letters written while replaying are kept for the next replay.
+	Replay(ctx context.Context, batchSize int, fn func([]DeadLetter) error) error
+	Close() error
+}
+
+// NewDeadLetterStore returns the dead-letter store selected by the migration configuration,
+// or nil if dead-lettering is disabled
+func NewDeadLetterStore(config MigrationConfig, postgresClient *PostgreSQLClient) (DeadLetterStore, error) {
+	var stores []DeadLetterStore
+
+	if config.DeadLetterTable {
+		if config.DryRun {
+			log.Println("Dry run: MigrationDeadLetters table disabled")
+		} else {
+			store, err := NewPostgresDeadLetterStore(postgresClient.db)
+			if err != nil {
+				return nil, err
+			}
+			log.Println("Writing rejected documents to MigrationDeadLetters")
+			stores = append(stores, store)
+		}
+	}
+
+	if config.DeadLetterFile != "" {
+		store, err := NewFileDeadLetterStore(config.DeadLetterFile)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Writing rejected documents to %s", config.DeadLetterFile)
+		stores = append(stores, store)
+	}
+
+	switch len(stores) {
+	case 0:
+		return nil, nil
+	case 1:
+		return stores[0], nil
+	default:
+		return &multiDeadLetterStore{primary: stores[0], mirrors: stores[1:]}, nil
+	}
+}
+
+// FileDeadLetterStore appends dead letters to a JSONL file
+type FileDeadLetterStore struct {
+	path string
+	file *os.File
+	mu   sync.Mutex
+}
+
+// NewFileDeadLetterStore opens (or creates) the JSONL file at path for appending
+func NewFileDeadLetterStore(path string) (*FileDeadLetterStore, error) {
+	store := &FileDeadLetterStore{path: path}
+	if err := store.open(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+func (s *FileDeadLetterStore) open() error {
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open dead-letter file %s: %w", s.path, err)
+	}
+	s.file = file
+	return nil
+}
+
+// Write appends one JSON line per dead letter and syncs the file
+func (s *FileDeadLetterStore) Write(ctx context.Context, letters []DeadLetter) error {
+	if len(letters) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	writer := bufio.NewWriter(s.file)
+	encoder := json.NewEncoder(writer)
+	for _, letter := range letters {
+		if err := encoder.Encode(letter); err != nil {
+			return fmt.Errorf("failed to write dead letter %s: %w", letter.DocumentID, err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("failed to write dead-letter file: %w", err)
+	}
+	return s.file.Sync()
+}
+
+// Replay moves the current file aside, replays it, and appends batches that fail back to a fresh file
+func (s *FileDeadLetterStore) Replay(ctx context.Context, batchSize int, fn func([]DeadLetter) error) error {
+	replayPath := s.path + ".replaying"
+
+	// Reuse a leftover file from an interrupted replay, otherwise rotate the live file
+	s.mu.Lock()
+	if _, err := os.Stat(replayPath); errors.Is(err, os.ErrNotExist) {
+		if err := s.file.Close(); err != nil {
+			s.mu.Unlock()
+			return fmt.Errorf("failed to close dead-letter file: %w", err)
+		}
+		if err := os.Rename(s.path, replayPath); err != nil {
+			s.mu.Unlock()
+			return fmt.Errorf("failed to rotate dead-letter file: %w", err)
+		}
+		if err := s.open(); err != nil {
+			s.mu.Unlock()
+			return err
+		}
+	}
+	s.mu.Unlock()
+
+	file, err := os.Open(replayPath)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", replayPath, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+
+	flush := func(batch []DeadLetter) error {
+		if err := fn(batch); err != nil {
+			log.Printf("Replay batch failed, keeping %d dead letters: %v", len(batch), err)
+			return s.Write(ctx, batch)
+		}
+		return nil
+	}
+
+	batch := make([]DeadLetter, 0, batchSize)
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return ctx.Err() // Leave the .replaying file for the next attempt
+		}
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var letter DeadLetter
+		if err := json.Unmarshal(scanner.Bytes(), &letter); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", replayPath, err)
+		}
+		batch = append(batch, letter)
+		if len(batch) >= batchSize {
+			if err := flush(batch); err != nil {
+				return err
+			}
+			batch = make([]DeadLetter, 0, batchSize)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", replayPath, err)
+	}
+	if len(batch) > 0 {
+		if err := flush(batch); err != nil {
+			return err
+		}
+	}
+
+	file.Close()
+	return os.Remove(replayPath)
+}
+
+// Close closes the dead-letter file
+func (s *FileDeadLetterStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// PostgresDeadLetterStore keeps dead letters in the "MigrationDeadLetters" table
+type PostgresDeadLetterStore struct {
+	db *sql.DB
+}
+
+// NewPostgresDeadLetterStore creates the dead-letter table if needed
+func NewPostgresDeadLetterStore(db *sql.DB) (*PostgresDeadLetterStore, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if _, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS "MigrationDeadLetters" (
+			"Id" bigserial PRIMARY KEY,
+			"DocumentId" text NOT NULL,
+			"ErrorType" text NOT NULL,
+			"Message" text NOT NULL,
+			"RawDocument" bytea,
+			"CreatedAt" timestamptz NOT NULL,
+			"ReplayedAt" timestamptz
+		)`); err != nil {
+		return nil, fmt.Errorf("failed to create MigrationDeadLetters table: %w", err)
+	}
+	if _, err := db.ExecContext(ctx, `
+		CREATE INDEX IF NOT EXISTS "IX_MigrationDeadLetters_Pending"
+		ON "MigrationDeadLetters" ("Id") WHERE "ReplayedAt" IS NULL`); err != nil {
+		return nil, fmt.Errorf("failed to create MigrationDeadLetters index: %w", err)
+	}
+
+	return &PostgresDeadLetterStore{db: db}, nil
+}
+
+// Write inserts dead letters in a single COPY
+func (s *PostgresDeadLetterStore) Write(ctx context.Context, letters []DeadLetter) error {
+	if len(letters) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin dead-letter transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(pq.CopyIn("MigrationDeadLetters", "DocumentId", "ErrorType", "Message", "RawDocument", "CreatedAt"))
+	if err != nil {
+		return fmt.Errorf("prepare dead-letter COPY failed: %w", err)
+	}
+	for _, letter := range letters {
+		if _, err := stmt.Exec(letter.DocumentID, letter.ErrorType, sanitizeUTF8String(letter.Message), letter.RawDocument, letter.Timestamp); err != nil {
+			stmt.Close()
+			return fmt.Errorf("dead-letter COPY exec failed: %w", err)
+		}
+	}
+	if _, err := stmt.Exec(); err != nil {
+		stmt.Close()
+		return fmt.Errorf("dead-letter COPY finalize failed: %w", err)
+	}
+	if err := stmt.Close(); err != nil {
+		return fmt.Errorf("dead-letter COPY close failed: %w", err)
+	}
+	return tx.Commit()
+}
+
+// Replay walks pending dead letters in insertion order and marks each successful batch as replayed
+func (s *PostgresDeadLetterStore) Replay(ctx context.Context, batchSize int, fn func([]DeadLetter) error) error {
+	// Letters written during the replay get higher IDs and are left for the next replay
+	var maxID int64
+	if err := s.db.QueryRowContext(ctx, `SELECT COALESCE(MAX("Id"), 0) FROM "MigrationDeadLetters"`).Scan(&maxID); err != nil {
+		return fmt.Errorf("failed to read dead-letter high-water mark: %w", err)
+	}
+
+	var afterID int64
+	for {
+		rows, err := s.db.QueryContext(ctx, `
+			SELECT "Id","DocumentId","ErrorType","Message","RawDocument","CreatedAt"
+			FROM "MigrationDeadLetters"
+			WHERE "ReplayedAt" IS NULL AND "Id" > $1 AND "Id" <= $2
+			ORDER BY "Id" LIMIT $3`, afterID, maxID, batchSize)
+		if err != nil {
+			return fmt.Errorf("failed to read dead letters: %w", err)
+		}
+
+		var ids []int64
+		var batch []DeadLetter
+		for rows.Next() {
+			var id int64
+			var letter DeadLetter
+			if err := rows.Scan(&id, &letter.DocumentID, &letter.ErrorType, &letter.Message, &letter.RawDocument, &letter.Timestamp); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan dead letter: %w", err)
+			}
+			ids = append(ids, id)
+			batch = append(batch, letter)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to read dead letters: %w", err)
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		afterID = ids[len(ids)-1]
+
+		if err := fn(batch); err != nil {
+			log.Printf("Replay batch failed, keeping %d dead letters: %v", len(batch), err)
+			continue
+		}
+		if _, err := s.db.ExecContext(ctx, `UPDATE "MigrationDeadLetters" SET "ReplayedAt" = now() WHERE "Id" = ANY($1)`, pq.Array(ids)); err != nil {
+			return fmt.Errorf("failed to mark dead letters as replayed: %w", err)
+		}
+	}
+}
+
+// Close is a no-op; the table shares the PostgreSQL client's connection pool
+func (s *PostgresDeadLetterStore) Close() error {
+	return nil
+}
+
+// multiDeadLetterStore writes to a primary store, which replay reads from, and mirrors the letters
+// the primary accepted to the other stores. Letters rejected again while replaying already have
+// their copy in the mirrors, so they are only written back to the primary.
+type multiDeadLetterStore struct {
+	primary   DeadLetterStore
+	mirrors   []DeadLetterStore
+	replaying atomic.Bool
+}
+
+func (m *multiDeadLetterStore) Write(ctx context.Context, letters []DeadLetter) error {
+	if err := m.primary.Write(ctx, letters); err != nil {
+		return err
+	}
+	if m.replaying.Load() {
+		return nil
+	}
+	for _, store := range m.mirrors {
+		if err := store.Write(ctx, letters); err != nil {
+			// The primary holds the letters, so the batch can still be committed
+			log.Printf("Warning: failed to mirror %d dead letters: %v", len(letters), err)
+		}
+	}
+	return nil
+}
+
+func (m *multiDeadLetterStore) Replay(ctx context.Context, batchSize int, fn func([]DeadLetter) error) error {
+	m.replaying.Store(true)
+	defer m.replaying.Store(false)
+	return m.primary.Replay(ctx, batchSize, fn)
+}
+
+func (m *multiDeadLetterStore) Close() error {
+	errs := []error{m.primary.Close()}
+	for _, store := range m.mirrors {
+		errs = append(errs, store.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// ReplayDeadLetters re-runs stored dead letters through the validate → transform → insert pipeline,
+// typically after normalization rules have been fixed. Documents that are rejected again are
+// dead-lettered anew; batches that fail to commit stay in the store.
+func (m *MigrationTool) ReplayDeadLetters(ctx context.Context) error {
+	if m.deadLetters == nil {
+		return fmt.Errorf("no dead-letter store configured (set MIGRATION_DEAD_LETTER_TABLE or MIGRATION_DEAD_LETTER_FILE)")
+	}
+
+	log.Println("Replaying dead letters...")
+	var replayed, recovered, rejected int64
+
+	err := m.deadLetters.Replay(ctx, m.config.Migration.BatchSize, func(letters []DeadLetter) error {
+		documents := make([]ThreatDocument, 0, len(letters))
+		var undecodable []DeadLetter
+		for _, letter := range letters {
+			doc, err := letter.Decode()
+			if err != nil {
+				log.Printf("Warning: %v", err)
+				undecodable = append(undecodable, letter)
+				continue
+			}
+			documents = append(documents, doc)
+		}
+
+		// Keep letters we cannot decode as they are
+		if err := m.deadLetters.Write(ctx, undecodable); err != nil {
+			return err
+		}
+
+		result := m.processBatch(ctx, documents)
+		for _, err := range result.Errors {
+			log.Printf("Replay error: %v", err)
+		}
+		if !result.Committed {
+			return fmt.Errorf("replay batch was not committed")
+		}
+
+		replayed += int64(len(letters))
+		recovered += int64(result.ProcessedCount)
+		rejected += int64(result.ErrorCount + len(undecodable))
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("replay failed: %w", err)
+	}
+
+	log.Printf("Replay completed: %d dead letters replayed, %d documents migrated, %d rejected again",
+		replayed, recovered, rejected)
+	return nil
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Older sensors stored ports as numbers, timestamps as strings or epoch numbers and _id values
+// that are not ObjectIDs. Documents are decoded field by field and such values are coerced to
+// the types of ThreatDocument, counting each coercion.
+
+// CoercionCounter counts the values converted while decoding documents, by field and source type
+type CoercionCounter struct {
+	mu     sync.Mutex
+	counts map[string]int64 // keyed by "field from type"
+	total  *prometheus.CounterVec
+}
+
+// documentCoercions counts the coercions of every document decoded by this process
+var documentCoercions = &CoercionCounter{
+	counts: make(map[string]int64),
+	total: prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "migration_document_coercions_total",
+		Help: "Document field values converted while decoding, by field and source type",
+	}, []string{"field", "from"}),
+}
+
+// Add counts a value of field converted from the BSON type from
+func (c *CoercionCounter) Add(field, from string) {
+	c.mu.Lock()
+	c.counts[field+" from "+from]++
+	c.mu.Unlock()
+	c.total.WithLabelValues(field, from).Inc()
+}
+
+// Summary returns the counts as "field from type: n" lines, sorted
+func (c *CoercionCounter) Summary() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	lines := make([]string, 0, len(c.counts))
+	for key, count := range c.counts {
+		lines = append(lines, fmt.Sprintf("%s: %d", key, count))
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// Collectors returns the coercion metrics
+func (c *CoercionCounter) Collectors() []prometheus.Collector {
+	return []prometheus.Collector{c.total}
+}
+
+// fieldCoercion is a value of field converted from a BSON type while decoding one document
+type fieldCoercion struct {
+	field, from string
+}
+
+// bsonTypeName is the short name of a BSON type used in coercion counts
+func bsonTypeName(t bsontype.Type) string {
+	switch t {
+	case bsontype.Double:
+		return "double"
+	case bsontype.String:
+		return "string"
+	case bsontype.EmbeddedDocument:
+		return "document"
+	case bsontype.Array:
+		return "array"
+	case bsontype.Binary:
+		return "binary"
+	case bsontype.ObjectID:
+		return "objectid"
+	case bsontype.Boolean:
+		return "bool"
+	case bsontype.DateTime:
+		return "date"
+	case bsontype.Null:
+		return "null"
+	case bsontype.Int32:
+		return "int32"
+	case bsontype.Timestamp:
+		return "timestamp"
+	case bsontype.Int64:
+		return "int64"
+	case bsontype.Decimal128:
+		return "decimal"
+	default:
+		return strings.ReplaceAll(t.String(), " ", "_")
+	}
+}
+
+// UnmarshalBSON decodes a document leniently, coercing legacy field types. A document with a
+// value that cannot be coerced still decodes, with only its ID, its raw BSON and DecodeErr set,
+// so it fails validation and is dead-lettered instead of vanishing. Only BSON that is not a
+// valid document is an error.
+func (d *ThreatDocument) UnmarshalBSON(data []byte) error {
+	raw := bson.Raw(data)
+	if err := raw.Validate(); err != nil {
+		return err
+	}
+
+	var coerced []fieldCoercion
+	doc, err := decodeThreatDocument(raw, &coerced)
+	if err == nil {
+		// Only counted once the whole document decodes, as a failed one is dead-lettered unchanged
+		for _, c := range coerced {
+			documentCoercions.Add(c.field, c.from)
+		}
+	} else {
+		doc = ThreatDocument{Raw: append(bson.Raw(nil), raw...), DecodeErr: err}
+		if id, lookupErr := raw.LookupErr("_id"); lookupErr == nil {
+			doc.ID, _ = documentObjectID(id)
+			if id.Type != bsontype.ObjectID {
+				doc.SourceID = copyRawValue(id)
+			}
+		}
+	}
+	*d = doc
+	return nil
+}
+
+// decodeThreatDocument maps the fields of a raw document to a ThreatDocument, appending the
+// values it converts to coerced
+func decodeThreatDocument(raw bson.Raw, coerced *[]fieldCoercion) (ThreatDocument, error) {
+	var doc ThreatDocument
+	elements, err := raw.Elements()
+	if err != nil {
+		return doc, err
+	}
+
+	for _, element := range elements {
+		key, value := element.Key(), element.Value()
+		switch key {
+		case "_id":
+			var coercion string
+			doc.ID, coercion = documentObjectID(value)
+			if value.Type != bsontype.ObjectID {
+				doc.SourceID = copyRawValue(value)
+				*coerced = append(*coerced, fieldCoercion{"_id", coercion})
+			}
+		case "asn":
+			err = decodeString(key, value, &doc.ASN, coerced)
+		case "asninfo":
+			err = decodeString(key, value, &doc.ASNInfo, coerced)
+		case "category":
+			err = decodeString(key, value, &doc.Category, coerced)
+		case "source_address":
+			err = decodeString(key, value, &doc.SourceAddress, coerced)
+		case "source_country":
+			err = decodeString(key, value, &doc.SourceCountry, coerced)
+		case "timestamp":
+			err = decodeTime(key, value, &doc.Timestamp, coerced)
+		case "created_at":
+			err = decodeTime(key, value, &doc.CreatedAt, coerced)
+		case "updated_at":
+			err = decodeTime(key, value, &doc.UpdatedAt, coerced)
+		case "optional_information":
+			err = decodeOptionalInfo(value, &doc.OptionalInformation, coerced)
+		}
+		if err != nil {
+			return ThreatDocument{}, err
+		}
+	}
+	return doc, nil
+}
+
+// decodeOptionalInfo maps the fields of the embedded optional information document
+func decodeOptionalInfo(value bson.RawValue, info *OptionalInfo, coerced *[]fieldCoercion) error {
+	switch value.Type {
+	case bsontype.Null, bsontype.Undefined:
+		return nil
+	case bsontype.EmbeddedDocument:
+	default:
+		return fmt.Errorf("optional_information: cannot decode %s into a document", bsonTypeName(value.Type))
+	}
+
+	elements, err := value.Document().Elements()
+	if err != nil {
+		return fmt.Errorf("optional_information: %w", err)
+	}
+	for _, element := range elements {
+		key, value := element.Key(), element.Value()
+		var target *string
+		switch key {
+		case "destination_address":
+			target = &info.DestinationAddress
+		case "destination_country":
+			target = &info.DestinationCountry
+		case "destination_port":
+			target = &info.DestinationPort
+		case "source_port":
+			target = &info.SourcePort
+		case "protocol":
+			target = &info.Protocol
+		case "family":
+			target = &info.Family
+		default:
+			continue
+		}
+		if err := decodeString("optional_information."+key, value, target, coerced); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeString decodes a string field, formatting numbers such as ports stored as int32,
+// int64 or double
+func decodeString(field string, value bson.RawValue, target *string, coerced *[]fieldCoercion) error {
+	switch value.Type {
+	case bsontype.String:
+		*target = value.StringValue()
+		return nil
+	case bsontype.Null, bsontype.Undefined:
+		*target = ""
+		return nil
+	case bsontype.Int32:
+		*target = strconv.FormatInt(int64(value.Int32()), 10)
+	case bsontype.Int64:
+		*target = strconv.FormatInt(value.Int64(), 10)
+	case bsontype.Double:
+		number := value.Double()
+		if math.IsNaN(number) || math.IsInf(number, 0) {
+			return fmt.Errorf("%s: cannot decode %v into a string", field, number)
+		}
+		if number == math.Trunc(number) && math.Abs(number) < 1<<53 {
+			*target = strconv.FormatInt(int64(number), 10)
+		} else {
+			*target = strconv.FormatFloat(number, 'f', -1, 64)
+		}
+	case bsontype.Symbol:
+		*target = value.Symbol()
+	default:
+		return fmt.Errorf("%s: cannot decode %s into a string", field, bsonTypeName(value.Type))
+	}
+	*coerced = append(*coerced, fieldCoercion{field, bsonTypeName(value.Type)})
+	return nil
+}
+
+// timeLayouts are the string timestamp layouts accepted, tried in order. Layouts without a
+// zone are read as UTC.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	time.RFC1123Z,
+	time.RFC1123,
+	"2006-01-02",
+}
+
+// decodeTime decodes a timestamp field stored as a BSON date, a string or an epoch number
+func decodeTime(field string, value bson.RawValue, target *time.Time, coerced *[]fieldCoercion) error {
+	switch value.Type {
+	case bsontype.DateTime:
+		*target = value.Time().UTC()
+		return nil
+	case bsontype.Null, bsontype.Undefined:
+		*target = time.Time{}
+		return nil
+	case bsontype.Timestamp:
+		seconds, _ := value.Timestamp()
+		*target = time.Unix(int64(seconds), 0).UTC()
+	case bsontype.Int32:
+		*target = epochTime(float64(value.Int32()))
+	case bsontype.Int64:
+		*target = epochTime(float64(value.Int64()))
+	case bsontype.Double:
+		number := value.Double()
+		if math.IsNaN(number) || math.IsInf(number, 0) {
+			return fmt.Errorf("%s: cannot decode %v into a time", field, number)
+		}
+		*target = epochTime(number)
+	case bsontype.String:
+		parsed, err := parseTimeString(value.StringValue())
+		if err != nil {
+			return fmt.Errorf("%s: %w", field, err)
+		}
+		*target = parsed
+	default:
+		return fmt.Errorf("%s: cannot decode %s into a time", field, bsonTypeName(value.Type))
+	}
+	*coerced = append(*coerced, fieldCoercion{field, bsonTypeName(value.Type)})
+	return nil
+}
+
+// parseTimeString parses a timestamp string in one of timeLayouts, or an epoch number
+func parseTimeString(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if number, err := strconv.ParseFloat(value, 64); err == nil && !math.IsNaN(number) && !math.IsInf(number, 0) {
+		return epochTime(number), nil
+	}
+	for _, layout := range timeLayouts {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return parsed.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot parse %q as a time", value)
+}
+
+// epochTime converts an epoch number to a time, telling seconds, milliseconds, microseconds and
+// nanoseconds apart by magnitude: 1e11 seconds is in the year 5138, 1e11 milliseconds in 1973.
+// Whole seconds and the remainder are converted apart, as nanoseconds since 1970 overflow an
+// int64 after the year 2262.
+func epochTime(number float64) time.Time {
+	magnitude := math.Abs(number)
+	var perSecond float64
+	switch {
+	case magnitude < 1e11:
+		perSecond = 1
+	case magnitude < 1e14:
+		perSecond = 1e3
+	case magnitude < 1e17:
+		perSecond = 1e6
+	default:
+		perSecond = 1e9
+	}
+	seconds := math.Floor(number / perSecond)
+	nanos := (number - seconds*perSecond) * (1e9 / perSecond)
+	return time.Unix(int64(seconds), int64(math.Round(nanos))).UTC()
+}
+
+// documentObjectID returns the ObjectID of an _id value and the source type it was coerced
+// from. Strings holding an ObjectID in hex are parsed; other values get an ObjectID derived
+// from a hash of their type and bytes, so the ThreatEvents ID derived from it is stable too.
+func documentObjectID(id bson.RawValue) (primitive.ObjectID, string) {
+	switch id.Type {
+	case bsontype.ObjectID:
+		return id.ObjectID(), ""
+	case bsontype.String:
+		if objectID, err := primitive.ObjectIDFromHex(id.StringValue()); err == nil {
+			return objectID, "hex_string"
+		}
+	}
+
+	hash := sha1.New()
+	hash.Write([]byte{byte(id.Type)})
+	hash.Write(id.Value)
+	var objectID primitive.ObjectID
+	copy(objectID[:], hash.Sum(nil))
+	return objectID, bsonTypeName(id.Type)
+}
+
+// copyRawValue copies a raw value out of a buffer that may be reused
+func copyRawValue(value bson.RawValue) bson.RawValue {
+	return bson.RawValue{Type: value.Type, Value: append([]byte(nil), value.Value...)}
+}
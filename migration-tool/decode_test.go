@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// decodeFixture marshals fields and decodes them as a ThreatDocument, returning the document,
+// its BSON and the coercions counted while decoding it
+func decodeFixture(t *testing.T, fields bson.D) (ThreatDocument, []byte, map[string]int64) {
+	t.Helper()
+	data, err := bson.Marshal(fields)
+	if err != nil {
+		t.Fatalf("failed to marshal fixture: %v", err)
+	}
+	before := coercionCounts()
+	var doc ThreatDocument
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("failed to unmarshal fixture: %v", err)
+	}
+
+	counted := make(map[string]int64)
+	for key, count := range coercionCounts() {
+		if delta := count - before[key]; delta != 0 {
+			counted[key] = delta
+		}
+	}
+	return doc, data, counted
+}
+
+// coercionCounts copies the coercion counts of documentCoercions
+func coercionCounts() map[string]int64 {
+	documentCoercions.mu.Lock()
+	defer documentCoercions.mu.Unlock()
+	counts := make(map[string]int64, len(documentCoercions.counts))
+	for key, count := range documentCoercions.counts {
+		counts[key] = count
+	}
+	return counts
+}
+
+// validFields are the fields a document needs to pass validation, with the given timestamp
+func validFields(timestamp any) bson.D {
+	return bson.D{
+		{Key: "_id", Value: primitive.NewObjectID()},
+		{Key: "timestamp", Value: timestamp},
+		{Key: "source_address", Value: "203.0.113.7"},
+		{Key: "category", Value: "bot"},
+	}
+}
+
+func TestEpochTime(t *testing.T) {
+	tests := []struct {
+		name   string
+		number float64
+		want   time.Time
+	}{
+		{"zero", 0, time.Unix(0, 0)},
+		{"seconds", 1_700_000_000, time.Unix(1_700_000_000, 0)},
+		{"fractional seconds", 1_700_000_000.5, time.Unix(1_700_000_000, 500_000_000)},
+		{"negative seconds", -86_400, time.Unix(-86_400, 0)},
+		{"largest seconds", 1e11 - 1, time.Unix(1e11-1, 0)},
+		{"smallest milliseconds", 1e11, time.UnixMilli(1e11)},
+		{"milliseconds", 1_700_000_000_000, time.UnixMilli(1_700_000_000_000)},
+		{"largest milliseconds", 1e14 - 1, time.UnixMilli(1e14 - 1)},
+		{"smallest microseconds", 1e14, time.UnixMicro(1e14)},
+		{"microseconds", 1_700_000_000_000_000, time.UnixMicro(1_700_000_000_000_000)},
+		{"smallest nanoseconds", 1e17, time.Unix(0, 1e17)},
+		{"nanoseconds", 1_700_000_000_000_000_000, time.Unix(0, 1_700_000_000_000_000_000)},
+	}
+	for _, tt := range tests {
+		if got := epochTime(tt.number); !got.Equal(tt.want) {
+			t.Errorf("%s: epochTime(%v) = %s, want %s", tt.name, tt.number, got, tt.want.UTC())
+		}
+	}
+}
+
+func TestDecodeTimestamp(t *testing.T) {
+	base := time.Unix(1_700_000_000, 0).UTC() // 2023-11-14T22:13:20Z
+
+	tests := []struct {
+		name  string
+		value any
+		want  time.Time
+		from  string // source type counted, "" when the value is not coerced
+	}{
+		{"date", primitive.NewDateTimeFromTime(base), base, ""},
+		{"int32 seconds", int32(1_700_000_000), base, "int32"},
+		{"int64 milliseconds", int64(1_700_000_000_000), base, "int64"},
+		{"double seconds", 1_700_000_000.25, base.Add(250 * time.Millisecond), "double"},
+		{"double microseconds", 1_700_000_000_000_000.0, base, "double"},
+		{"bson timestamp", primitive.Timestamp{T: 1_700_000_000, I: 3}, base, "timestamp"},
+		{"RFC 3339", "2023-11-14T22:13:20Z", base, "string"},
+		{"RFC 3339 with offset", "2023-11-15T05:13:20.5+07:00", base.Add(500 * time.Millisecond), "string"},
+		{"no zone", "2023-11-14T22:13:20", base, "string"},
+		{"space separated", "2023-11-14 22:13:20", base, "string"},
+		{"space separated with offset", "2023-11-14 23:13:20+01:00", base, "string"},
+		{"RFC 1123", "Tue, 14 Nov 2023 22:13:20 UTC", base, "string"},
+		{"RFC 1123 numeric zone", "Tue, 14 Nov 2023 22:13:20 +0000", base, "string"},
+		{"date only", "2023-11-14", time.Date(2023, 11, 14, 0, 0, 0, 0, time.UTC), "string"},
+		{"epoch seconds string", " 1700000000 ", base, "string"},
+		{"epoch milliseconds string", "1700000000000", base, "string"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, _, counted := decodeFixture(t, validFields(tt.value))
+			if doc.DecodeErr != nil {
+				t.Fatalf("DecodeErr = %v", doc.DecodeErr)
+			}
+			if !doc.Timestamp.Equal(tt.want) || doc.Timestamp.Location() != time.UTC {
+				t.Errorf("Timestamp = %s, want %s", doc.Timestamp, tt.want)
+			}
+			want := map[string]int64{}
+			if tt.from != "" {
+				want["timestamp from "+tt.from] = 1
+			}
+			if !reflect.DeepEqual(counted, want) {
+				t.Errorf("coercions = %v, want %v", counted, want)
+			}
+		})
+	}
+}
+
+func TestDecodeNullTimestamp(t *testing.T) {
+	doc, _, counted := decodeFixture(t, validFields(primitive.Null{}))
+	if doc.DecodeErr != nil || !doc.Timestamp.IsZero() || len(counted) != 0 {
+		t.Errorf("decoded null timestamp as %s (DecodeErr %v, coercions %v)", doc.Timestamp, doc.DecodeErr, counted)
+	}
+	if err := doc.ValidateDocument(); err == nil || !strings.Contains(err.Error(), "timestamp is empty") {
+		t.Errorf("ValidateDocument() = %v, want an empty timestamp error", err)
+	}
+}
+
+func TestDecodePorts(t *testing.T) {
+	fields := append(validFields(primitive.NewDateTimeFromTime(time.Now())), bson.E{
+		Key: "optional_information", Value: bson.D{
+			{Key: "destination_port", Value: 8080.0},
+			{Key: "source_port", Value: int32(443)},
+			{Key: "destination_address", Value: "198.51.100.1"},
+			{Key: "protocol", Value: "tcp"},
+			{Key: "family", Value: int64(7)},
+		},
+	})
+	doc, _, counted := decodeFixture(t, fields)
+	if doc.DecodeErr != nil {
+		t.Fatalf("DecodeErr = %v", doc.DecodeErr)
+	}
+
+	info := doc.OptionalInformation
+	want := OptionalInfo{DestinationAddress: "198.51.100.1", DestinationPort: "8080", SourcePort: "443", Protocol: "tcp", Family: "7"}
+	if info != want {
+		t.Errorf("OptionalInformation = %+v, want %+v", info, want)
+	}
+	wantCounted := map[string]int64{
+		"optional_information.destination_port from double": 1,
+		"optional_information.source_port from int32":       1,
+		"optional_information.family from int64":            1,
+	}
+	if !reflect.DeepEqual(counted, wantCounted) {
+		t.Errorf("coercions = %v, want %v", counted, wantCounted)
+	}
+}
+
+func TestDecodeString(t *testing.T) {
+	tests := []struct {
+		value   any
+		want    string
+		wantErr bool
+	}{
+		{value: 8080.0, want: "8080"},
+		{value: -1.0, want: "-1"},
+		{value: 8080.5, want: "8080.5"},
+		{value: 1e20, want: "100000000000000000000"},
+		{value: math.NaN(), wantErr: true},
+		{value: math.Inf(1), wantErr: true},
+		{value: true, wantErr: true},
+		{value: bson.A{"80"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		bsonType, data, err := bson.MarshalValue(tt.value)
+		if err != nil {
+			t.Fatalf("failed to marshal %v: %v", tt.value, err)
+		}
+		var got string
+		var coerced []fieldCoercion
+		err = decodeString("port", bson.RawValue{Type: bsonType, Value: data}, &got, &coerced)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("decodeString(%v) = %q, want an error", tt.value, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("decodeString(%v) = %q, %v, want %q", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestDecodeObjectID(t *testing.T) {
+	objectID := primitive.NewObjectID()
+
+	t.Run("objectid", func(t *testing.T) {
+		doc, _, counted := decodeFixture(t, bson.D{{Key: "_id", Value: objectID}})
+		if doc.ID != objectID || doc.SourceID.Type != 0 || len(counted) != 0 {
+			t.Errorf("decoded %s as ID %s, SourceID %v, coercions %v", objectID.Hex(), doc.ID.Hex(), doc.SourceID, counted)
+		}
+	})
+
+	t.Run("hex string", func(t *testing.T) {
+		doc, _, counted := decodeFixture(t, bson.D{{Key: "_id", Value: objectID.Hex()}})
+		if doc.ID != objectID {
+			t.Errorf("ID = %s, want %s", doc.ID.Hex(), objectID.Hex())
+		}
+		if doc.SourceID.Type != bsontype.String || doc.SourceID.StringValue() != objectID.Hex() {
+			t.Errorf("SourceID = %v, want the hex string", doc.SourceID)
+		}
+		if want := map[string]int64{"_id from hex_string": 1}; !reflect.DeepEqual(counted, want) {
+			t.Errorf("coercions = %v, want %v", counted, want)
+		}
+	})
+
+	t.Run("hashed", func(t *testing.T) {
+		first, _, counted := decodeFixture(t, bson.D{{Key: "_id", Value: int32(42)}})
+		again, _, _ := decodeFixture(t, bson.D{{Key: "_id", Value: int32(42)}})
+		if first.ID.IsZero() || first.ID != again.ID {
+			t.Errorf("ID of int32 42 = %s then %s, want a stable non-zero ID", first.ID.Hex(), again.ID.Hex())
+		}
+		if first.SourceID.Type != bsontype.Int32 || first.SourceID.Int32() != 42 {
+			t.Errorf("SourceID = %v, want int32 42", first.SourceID)
+		}
+		if want := map[string]int64{"_id from int32": 1}; !reflect.DeepEqual(counted, want) {
+			t.Errorf("coercions = %v, want %v", counted, want)
+		}
+
+		// The hash covers the type, so equal-looking values of other types get other IDs
+		for _, other := range []any{int64(42), "42", 42.0} {
+			doc, _, _ := decodeFixture(t, bson.D{{Key: "_id", Value: other}})
+			if doc.ID == first.ID {
+				t.Errorf("_id %#v has the same ID as int32 42", other)
+			}
+		}
+	})
+}
+
+func TestDecodeFailureIsDeadLettered(t *testing.T) {
+	fields := bson.D{
+		{Key: "_id", Value: int32(7)},
+		{Key: "source_address", Value: "203.0.113.7"},
+		{Key: "category", Value: int32(3)}, // coerced before the timestamp fails
+		{Key: "timestamp", Value: "yesterday"},
+	}
+	doc, data, counted := decodeFixture(t, fields)
+
+	if doc.DecodeErr == nil || !strings.Contains(doc.DecodeErr.Error(), "timestamp") {
+		t.Fatalf("DecodeErr = %v, want a timestamp error", doc.DecodeErr)
+	}
+	if len(counted) != 0 {
+		t.Errorf("coercions = %v, want none for a document that failed to decode", counted)
+	}
+	if doc.Category != "" || doc.SourceAddress != "" {
+		t.Errorf("fields of a failed document were decoded: %+v", doc)
+	}
+	if !bytes.Equal(doc.Raw, data) {
+		t.Errorf("Raw = %x, want the original BSON", []byte(doc.Raw))
+	}
+	hashed, _, _ := decodeFixture(t, bson.D{{Key: "_id", Value: int32(7)}})
+	if doc.ID != hashed.ID || doc.SourceID.Type != bsontype.Int32 {
+		t.Errorf("ID = %s, SourceID %v, want the ID of int32 7", doc.ID.Hex(), doc.SourceID)
+	}
+
+	err := doc.ValidateDocument()
+	if err == nil || !strings.Contains(err.Error(), "could not be decoded") {
+		t.Fatalf("ValidateDocument() = %v, want a decoding error", err)
+	}
+	letter := NewDeadLetter(doc, MigrationError{Type: ValidationError, DocumentID: doc.SourceIDString(), Message: err.Error()})
+	if !bytes.Equal(letter.RawDocument, data) {
+		t.Errorf("dead letter holds %x, want the original BSON", letter.RawDocument)
+	}
+	replayed, err := letter.Decode()
+	if err != nil {
+		t.Fatalf("Decode() = %v", err)
+	}
+	if replayed.DecodeErr == nil || replayed.ID != doc.ID {
+		t.Errorf("replayed document has ID %s, DecodeErr %v", replayed.ID.Hex(), replayed.DecodeErr)
+	}
+}
+
+func TestDecodeInvalidBSON(t *testing.T) {
+	var doc ThreatDocument
+	if err := doc.UnmarshalBSON([]byte{5, 0, 0, 0, 1}); err == nil {
+		t.Error("UnmarshalBSON accepted invalid BSON")
+	}
+}
+
+func TestTimestampDay(t *testing.T) {
+	tests := []struct {
+		value any
+		want  string
+	}{
+		{primitive.NewDateTimeFromTime(time.Date(2023, 11, 14, 23, 59, 59, 0, time.UTC)), "2023-11-14"},
+		{int64(1_700_000_000), "2023-11-14"},     // seconds, which $convert read as milliseconds in 1970
+		{int64(1_700_000_000_000), "2023-11-14"}, // milliseconds
+		{"Tue, 14 Nov 2023 22:13:20 GMT", "2023-11-14"},
+		{"2023-11-14 23:30:00-02:00", "2023-11-15"}, // days are UTC
+		{"yesterday", ""},
+		{primitive.Null{}, ""},
+	}
+	for _, tt := range tests {
+		bsonType, data, err := bson.MarshalValue(tt.value)
+		if err != nil {
+			t.Fatalf("failed to marshal %v: %v", tt.value, err)
+		}
+		if got := timestampDay(bson.RawValue{Type: bsonType, Value: data}); got != tt.want {
+			t.Errorf("timestampDay(%v) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+	if got := timestampDay(bson.RawValue{}); got != "" {
+		t.Errorf("timestampDay of a missing field = %q, want \"\"", got)
+	}
+}
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// maxBSONDocumentSize bounds the length prefix of a BSON document; MongoDB documents are at most
+// 16 MiB, so anything larger means the file is not a BSON dump or is corrupt
+const maxBSONDocumentSize = 16 << 20
+
+// mongodumpArchiveMagic starts files written by mongodump --archive
+const mongodumpArchiveMagic = 0x8199e26d
+
+// FileSource reads documents from mongoexport (NDJSON or extended JSON array) or mongodump
+// (BSON) files, which may be gzip compressed. Files are read in name order. A position is
+// "<file>:<offset>", the uncompressed byte offset in file just after the last document read.
+type FileSource struct {
+	format string
+	files  []string
+
+	// The open file, kept between batches so reading continues without seeking
+	index    int
+	file     *os.File
+	reader   *bufio.Reader
+	offset   int64
+	position string
+}
+
+// OpenFileSource opens the export files of format at path, which is a file, a directory or a
+// glob pattern
+func OpenFileSource(format, path string) (*FileSource, error) {
+	files, err := sourceFiles(format, path)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no %s files found at %s", format, path)
+	}
+	return &FileSource{format: format, files: files, index: -1}, nil
+}
+
+// sourceFiles expands path into the sorted list of files to read. Directories contribute the
+// files with an extension matching format.
+func sourceFiles(format, path string) ([]string, error) {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list source directory %s: %w", path, err)
+		}
+		var files []string
+		for _, entry := range entries {
+			if !entry.IsDir() && hasSourceExtension(format, entry.Name()) {
+				files = append(files, filepath.Join(path, entry.Name()))
+			}
+		}
+		sort.Strings(files)
+		return files, nil
+	}
+
+	files, err := filepath.Glob(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source path %s: %w", path, err)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// hasSourceExtension reports whether name is a file of format, optionally gzip compressed
+func hasSourceExtension(format, name string) bool {
+	name = strings.TrimSuffix(strings.ToLower(name), ".gz")
+	switch format {
+	case SourceBSON:
+		return strings.HasSuffix(name, ".bson")
+	default:
+		// Skip the collection metadata written next to the data by mongodump
+		if strings.HasSuffix(name, ".metadata.json") {
+			return false
+		}
+		return strings.HasSuffix(name, ".json") || strings.HasSuffix(name, ".jsonl") || strings.HasSuffix(name, ".ndjson")
+	}
+}
+
+// Name describes the files
+func (s *FileSource) Name() string {
+	if len(s.files) == 1 {
+		return fmt.Sprintf("%s file %s", s.format, s.files[0])
+	}
+	return fmt.Sprintf("%d %s files (%s .. %s)", len(s.files), s.format, s.files[0], s.files[len(s.files)-1])
+}
+
+// EstimatedCount extrapolates the document count from the uncompressed size of the files and
+// the average size of the first documents. The uncompressed size of gzip files is taken from
+// the gzip trailer, which is only exact for single-member files below 4 GiB.
+func (s *FileSource) EstimatedCount(ctx context.Context) (int64, error) {
+	var total int64
+	for _, path := range s.files {
+		size, err := uncompressedSize(path)
+		if err != nil {
+			return 0, err
+		}
+		total += size
+	}
+
+	sample, err := OpenFileSource(s.format, s.files[0])
+	if err != nil {
+		return 0, err
+	}
+	defer sample.Close()
+	batch, position, err := sample.ReadBatch(ctx, "", 1000)
+	if err != nil || len(batch) == 0 {
+		return 0, err
+	}
+	_, sampled, err := parseFilePosition(position)
+	if err != nil || sampled == 0 {
+		return 0, err
+	}
+	return total * int64(len(batch)) / sampled, nil
+}
+
+// uncompressedSize returns the size of a plain file, or the size recorded in a gzip trailer
+func uncompressedSize(path string) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open source file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat source file: %w", err)
+	}
+	magic := make([]byte, 2)
+	if _, err := io.ReadFull(file, magic); err != nil || magic[0] != 0x1f || magic[1] != 0x8b || info.Size() < 4 {
+		return info.Size(), nil
+	}
+	trailer := make([]byte, 4)
+	if _, err := file.ReadAt(trailer, info.Size()-4); err != nil {
+		return 0, fmt.Errorf("failed to read gzip trailer of %s: %w", path, err)
+	}
+	return int64(binary.LittleEndian.Uint32(trailer)), nil
+}
+
+// ReadBatch reads up to batchSize documents after position, continuing into the next files
+// as each one ends. Documents that cannot be decoded are logged and skipped.
+func (s *FileSource) ReadBatch(ctx context.Context, position string, batchSize int) ([]ThreatDocument, string, error) {
+	if s.reader == nil || position != s.position {
+		if err := s.seek(position); err != nil {
+			return nil, position, err
+		}
+	}
+
+	documents := make([]ThreatDocument, 0, batchSize)
+	for len(documents) < batchSize {
+		if err := ctx.Err(); err != nil {
+			return nil, position, err
+		}
+
+		data, err := s.readRecord()
+		if errors.Is(err, io.EOF) {
+			if s.index+1 >= len(s.files) {
+				break
+			}
+			if err := s.open(s.index+1, 0); err != nil {
+				return nil, position, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, position, fmt.Errorf("failed to read %s at offset %d: %w", s.files[s.index], s.offset, err)
+		}
+		s.position = fmt.Sprintf("%s:%d", s.files[s.index], s.offset)
+
+		doc, err := s.decode(data)
+		if err != nil {
+			log.Printf("Warning: failed to decode document at %s: %v", s.position, err)
+			continue // Skip records that are not documents at all
+		}
+		if doc.DecodeErr != nil {
+			log.Printf("Warning: failed to decode document at %s: %v", s.position, doc.DecodeErr)
+		}
+		documents = append(documents, doc)
+	}
+
+	if len(documents) == 0 {
+		return nil, position, nil
+	}
+	return documents, s.position, nil
+}
+
+// CountUpTo counts the documents in the files before position's file and in that file up to
+// its offset. It reads all of them, so it is only meant for overriding the resume position.
+func (s *FileSource) CountUpTo(ctx context.Context, position string) (int64, error) {
+	if position == "" {
+		return 0, nil
+	}
+	target, offset, err := s.locate(position)
+	if err != nil {
+		return 0, err
+	}
+
+	counter := &FileSource{format: s.format, files: s.files[:target+1], index: -1}
+	defer counter.Close()
+	if err := counter.open(0, 0); err != nil {
+		return 0, err
+	}
+
+	var count int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		if counter.index == target && counter.offset >= offset {
+			return count, nil
+		}
+		_, err := counter.readRecord()
+		if errors.Is(err, io.EOF) {
+			if counter.index == target {
+				return count, nil
+			}
+			if err := counter.open(counter.index+1, 0); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read %s at offset %d: %w", counter.files[counter.index], counter.offset, err)
+		}
+		count++
+	}
+}
+
+// Close closes the open file
+func (s *FileSource) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file, s.reader = nil, nil
+	return err
+}
+
+// seek opens the file of position and skips to its offset
+func (s *FileSource) seek(position string) error {
+	if position == "" {
+		return s.open(0, 0)
+	}
+	index, offset, err := s.locate(position)
+	if err != nil {
+		return err
+	}
+	if err := s.open(index, offset); err != nil {
+		return err
+	}
+	s.position = position
+	return nil
+}
+
+// locate returns the index of the file of position in s.files and the offset in it
+func (s *FileSource) locate(position string) (int, int64, error) {
+	path, offset, err := parseFilePosition(position)
+	if err != nil {
+		return 0, 0, err
+	}
+	for i, file := range s.files {
+		if file == path {
+			return i, offset, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("resume position %q refers to a file that is not part of the source", position)
+}
+
+// parseFilePosition splits a "<file>:<offset>" position
+func parseFilePosition(position string) (string, int64, error) {
+	sep := strings.LastIndex(position, ":")
+	if sep < 0 {
+		return "", 0, fmt.Errorf("invalid file position %q, expected <file>:<offset>", position)
+	}
+	offset, err := strconv.ParseInt(position[sep+1:], 10, 64)
+	if err != nil || offset < 0 {
+		return "", 0, fmt.Errorf("invalid offset in file position %q", position)
+	}
+	return position[:sep], offset, nil
+}
+
+// open opens file number index, decompressing it if it is gzip compressed, and skips offset
+// uncompressed bytes
+func (s *FileSource) open(index int, offset int64) error {
+	if err := s.Close(); err != nil {
+		return err
+	}
+
+	path := s.files[index]
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open source file: %w", err)
+	}
+
+	var reader *bufio.Reader
+	magic := make([]byte, 4)
+	n, _ := file.ReadAt(magic, 0)
+	if n >= 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(bufio.NewReaderSize(file, 1<<20))
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("failed to read gzip file %s: %w", path, err)
+		}
+		// Compressed data cannot be seeked, so decompress up to the offset
+		reader = bufio.NewReaderSize(gz, 1<<20)
+		if _, err := io.CopyN(io.Discard, reader, offset); err != nil {
+			file.Close()
+			return fmt.Errorf("failed to skip to offset %d of %s: %w", offset, path, err)
+		}
+	} else {
+		if s.format == SourceBSON && n == 4 && binary.LittleEndian.Uint32(magic) == mongodumpArchiveMagic {
+			file.Close()
+			return fmt.Errorf("%s is a mongodump --archive file, which is not supported; dump with --out to get one .bson file per collection", path)
+		}
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			file.Close()
+			return fmt.Errorf("failed to seek to offset %d of %s: %w", offset, path, err)
+		}
+		reader = bufio.NewReaderSize(file, 1<<20)
+	}
+
+	s.index, s.file, s.reader, s.offset = index, file, reader, offset
+	s.position = fmt.Sprintf("%s:%d", path, offset)
+	return nil
+}
+
+// readRecord reads the next document of the open file. It returns io.EOF at the end of the file.
+func (s *FileSource) readRecord() ([]byte, error) {
+	if s.format == SourceBSON {
+		return s.readBSONRecord()
+	}
+	return s.readJSONRecord()
+}
+
+// readBSONRecord reads one length-prefixed BSON document
+func (s *FileSource) readBSONRecord() ([]byte, error) {
+	header, err := s.reader.Peek(4)
+	if len(header) == 0 && errors.Is(err, io.EOF) {
+		return nil, io.EOF
+	}
+	if len(header) < 4 {
+		return nil, fmt.Errorf("truncated document length: %w", io.ErrUnexpectedEOF)
+	}
+	length := int(binary.LittleEndian.Uint32(header))
+	if length < 5 || length > maxBSONDocumentSize {
+		return nil, fmt.Errorf("invalid document length %d", length)
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(s.reader, data); err != nil {
+		return nil, fmt.Errorf("truncated document: %w", io.ErrUnexpectedEOF)
+	}
+	s.offset += int64(length)
+	return data, nil
+}
+
+// readJSONRecord reads one JSON object. Whitespace, commas and the brackets of a JSON array
+// between objects are skipped, so both line-delimited files and --jsonArray exports work.
+func (s *FileSource) readJSONRecord() ([]byte, error) {
+	for {
+		b, err := s.reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		s.offset++
+		if b == '{' {
+			break
+		}
+		if strings.IndexByte(" \t\r\n,[]", b) < 0 {
+			return nil, fmt.Errorf("unexpected %q between documents", b)
+		}
+	}
+
+	data := []byte{'{'}
+	depth, inString, escaped := 1, false, false
+	for depth > 0 {
+		b, err := s.reader.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("truncated document: %w", io.ErrUnexpectedEOF)
+		}
+		s.offset++
+		data = append(data, b)
+
+		switch {
+		case escaped:
+			escaped = false
+		case inString:
+			if b == '\\' {
+				escaped = true
+			} else if b == '"' {
+				inString = false
+			}
+		case b == '"':
+			inString = true
+		case b == '{':
+			depth++
+		case b == '}':
+			depth--
+		}
+	}
+	return data, nil
+}
+
+// decode decodes a document read by readRecord, keeping its BSON for dead-lettering
+func (s *FileSource) decode(data []byte) (ThreatDocument, error) {
+	raw := bson.Raw(data)
+	if s.format != SourceBSON {
+		// Relaxed mode parsing accepts canonical extended JSON as well
+		if err := bson.UnmarshalExtJSON(data, false, &raw); err != nil {
+			return ThreatDocument{}, err
+		}
+	}
+
+	var doc ThreatDocument
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return ThreatDocument{}, err
+	}
+	doc.Raw = raw
+	return doc, nil
+}
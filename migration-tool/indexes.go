@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Index suspension: for bulk loads the secondary indexes of ThreatEvents are dropped and rebuilt
+// afterwards, which is much cheaper than maintaining them row by row. Definitions are saved in
+// "MigrationSuspendedIndexes" before anything is dropped, and each row is only removed once its
+// index has been rebuilt, so a crashed run leaves behind exactly what still has to be restored.
+
+// SuspendedIndex is the saved definition of a dropped index
+type SuspendedIndex struct {
+	Name        string
+	Definition  string
+	SuspendedAt time.Time
+}
+
+// ensureSuspendedIndexTable creates the table holding suspended index definitions
+func (p *PostgreSQLClient) ensureSuspendedIndexTable(ctx context.Context) error {
+	if _, err := p.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS "MigrationSuspendedIndexes" (
+			"MigrationName" text NOT NULL,
+			"IndexName" text NOT NULL,
+			"Definition" text NOT NULL,
+			"SuspendedAt" timestamptz NOT NULL DEFAULT now(),
+			PRIMARY KEY ("MigrationName", "IndexName")
+		)`); err != nil {
+		return fmt.Errorf("failed to create MigrationSuspendedIndexes table: %w", err)
+	}
+	return nil
+}
+
+// SuspendedIndexes returns the indexes suspended under migrationName that are not yet restored
+func (p *PostgreSQLClient) SuspendedIndexes(ctx context.Context, migrationName string) ([]SuspendedIndex, error) {
+	if err := p.ensureSuspendedIndexTable(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT "IndexName", "Definition", "SuspendedAt" FROM "MigrationSuspendedIndexes"
+		WHERE "MigrationName" = $1 ORDER BY "IndexName"`, migrationName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load suspended indexes: %w", err)
+	}
+	defer rows.Close()
+
+	var indexes []SuspendedIndex
+	for rows.Next() {
+		var index SuspendedIndex
+		if err := rows.Scan(&index.Name, &index.Definition, &index.SuspendedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan suspended index: %w", err)
+		}
+		indexes = append(indexes, index)
+	}
+	return indexes, rows.Err()
+}
+
+// SuspendIndexes saves the definitions of the non-unique, non-primary-key indexes on
+// ThreatEvents and drops them. Indexes still suspended by an earlier, unfinished run stay
+// suspended. It returns the number of suspended indexes.
+func (p *PostgreSQLClient) SuspendIndexes(ctx context.Context, migrationName string) (int, error) {
+	if err := p.ensureSuspendedIndexTable(ctx); err != nil {
+		return 0, err
+	}
+
+	// Unique and primary key indexes (and anything backing a constraint) enforce
+	// ON CONFLICT and referential integrity, so they always stay
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO "MigrationSuspendedIndexes" ("MigrationName", "IndexName", "Definition")
+		SELECT $1, i.relname, pg_get_indexdef(ix.indexrelid)
+		FROM pg_index ix
+		JOIN pg_class i ON i.oid = ix.indexrelid
+		JOIN pg_class t ON t.oid = ix.indrelid
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		WHERE t.relname = 'ThreatEvents' AND n.nspname = current_schema()
+			AND NOT ix.indisunique AND NOT ix.indisprimary
+			AND NOT EXISTS (SELECT 1 FROM pg_constraint c WHERE c.conindid = ix.indexrelid)
+		ON CONFLICT ("MigrationName", "IndexName") DO NOTHING`, migrationName); err != nil {
+		return 0, fmt.Errorf("failed to save index definitions: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to save index definitions: %w", err)
+	}
+
+	indexes, err := p.SuspendedIndexes(ctx, migrationName)
+	if err != nil {
+		return 0, err
+	}
+	for _, index := range indexes {
+		if _, err := p.db.ExecContext(ctx, fmt.Sprintf(`DROP INDEX IF EXISTS %s`, quoteIdentifier(index.Name))); err != nil {
+			return 0, fmt.Errorf("failed to drop index %s: %w", index.Name, err)
+		}
+		log.Printf("Suspended index %s", index.Name)
+	}
+	return len(indexes), nil
+}
+
+// RestoreIndexes recreates the indexes suspended under migrationName, concurrently where the
+// table allows it, and forgets each one once it is rebuilt. It returns the number restored.
+func (p *PostgreSQLClient) RestoreIndexes(ctx context.Context, migrationName string) (int, error) {
+	indexes, err := p.SuspendedIndexes(ctx, migrationName)
+	if err != nil || len(indexes) == 0 {
+		return 0, err
+	}
+
+	hypertable, err := p.isHypertable(ctx, "ThreatEvents")
+	if err != nil {
+		return 0, err
+	}
+
+	restored := 0
+	for _, index := range indexes {
+		start := time.Now()
+		if err := p.restoreIndex(ctx, index, hypertable); err != nil {
+			return restored, err
+		}
+		if _, err := p.db.ExecContext(ctx, `
+			DELETE FROM "MigrationSuspendedIndexes" WHERE "MigrationName" = $1 AND "IndexName" = $2`,
+			migrationName, index.Name); err != nil {
+			return restored, fmt.Errorf("failed to clear suspended index %s: %w", index.Name, err)
+		}
+		restored++
+		log.Printf("Restored index %s in %v", index.Name, time.Since(start).Round(time.Second))
+	}
+	return restored, nil
+}
+
+// restoreIndex rebuilds one index unless a valid index of that name already exists
+func (p *PostgreSQLClient) restoreIndex(ctx context.Context, index SuspendedIndex, hypertable bool) error {
+	var valid sql.NullBool
+	err := p.db.QueryRowContext(ctx, `
+		SELECT ix.indisvalid FROM pg_index ix
+		JOIN pg_class i ON i.oid = ix.indexrelid
+		JOIN pg_namespace n ON n.oid = i.relnamespace
+		WHERE i.relname = $1 AND n.nspname = current_schema()`, index.Name).Scan(&valid)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return fmt.Errorf("failed to inspect index %s: %w", index.Name, err)
+	case valid.Bool:
+		return nil // Rebuilt before the last run stopped
+	default:
+		// An interrupted CREATE INDEX CONCURRENTLY leaves an invalid index behind
+		if _, err := p.db.ExecContext(ctx, fmt.Sprintf(`DROP INDEX IF EXISTS %s`, quoteIdentifier(index.Name))); err != nil {
+			return fmt.Errorf("failed to drop invalid index %s: %w", index.Name, err)
+		}
+	}
+
+	log.Printf("Rebuilding index %s...", index.Name)
+	if _, err := p.db.ExecContext(ctx, concurrentIndexDefinition(index.Definition, hypertable)); err != nil {
+		return fmt.Errorf("failed to recreate index %s: %w", index.Name, err)
+	}
+	return nil
+}
+
+// concurrentIndexDefinition rewrites a pg_get_indexdef definition so the build does not block
+// writes: CONCURRENTLY on plain tables, one transaction per chunk on TimescaleDB hypertables
+// (which do not support CONCURRENTLY)
+func concurrentIndexDefinition(definition string, hypertable bool) string {
+	if !hypertable {
+		for _, prefix := range []string{"CREATE INDEX ", "CREATE UNIQUE INDEX "} {
+			if rest, ok := strings.CutPrefix(definition, prefix); ok {
+				return prefix + "CONCURRENTLY " + rest
+			}
+		}
+		return definition
+	}
+
+	if strings.Contains(definition, " WITH (") {
+		return definition // Storage parameters already set, leave the definition alone
+	}
+	// WITH (...) goes before TABLESPACE and WHERE
+	insertAt := len(definition)
+	for _, clause := range []string{" TABLESPACE ", " WHERE "} {
+		if i := strings.Index(definition, clause); i >= 0 && i < insertAt {
+			insertAt = i
+		}
+	}
+	return definition[:insertAt] + " WITH (timescaledb.transaction_per_chunk)" + definition[insertAt:]
+}
+
+// isHypertable reports whether table is a TimescaleDB hypertable
+func (p *PostgreSQLClient) isHypertable(ctx context.Context, table string) (bool, error) {
+	var installed bool
+	if err := p.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'timescaledb')`).Scan(&installed); err != nil {
+		return false, fmt.Errorf("failed to check for TimescaleDB: %w", err)
+	}
+	if !installed {
+		return false, nil
+	}
+
+	var hypertable bool
+	if err := p.db.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM timescaledb_information.hypertables
+			WHERE hypertable_name = $1 AND hypertable_schema = current_schema())`, table).Scan(&hypertable); err != nil {
+		return false, fmt.Errorf("failed to check whether %s is a hypertable: %w", table, err)
+	}
+	return hypertable, nil
+}
+
+// quoteIdentifier quotes a PostgreSQL identifier
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// prepareIndexes suspends the ThreatEvents indexes before a load when DisableIndexesDuringLoad
+// is set. Otherwise it restores indexes left suspended by a run that crashed. It reports
+// whether indexes are suspended for this run.
+func (m *MigrationTool) prepareIndexes(ctx context.Context) (bool, error) {
+	if m.config.Migration.DryRun || !m.config.Sink.HasSink(SinkPostgres) {
+		return false, nil
+	}
+	name := m.config.Migration.MigrationName
+
+	if !m.config.Migration.DisableIndexesDuringLoad {
+		restored, err := m.postgresClient.RestoreIndexes(ctx, name)
+		if err != nil {
+			return false, fmt.Errorf("failed to restore indexes left suspended by an earlier run: %w", err)
+		}
+		if restored > 0 {
+			log.Printf("Restored %d indexes left suspended by an earlier run", restored)
+		}
+		return false, nil
+	}
+
+	suspended, err := m.postgresClient.SuspendIndexes(ctx, name)
+	if err != nil {
+		return false, fmt.Errorf("failed to suspend indexes: %w", err)
+	}
+	log.Printf("Suspended %d ThreatEvents indexes for the load", suspended)
+	return true, nil
+}
+
+// RestoreIndexes recreates any indexes still suspended for this migration
+func (m *MigrationTool) RestoreIndexes(ctx context.Context) error {
+	restored, err := m.postgresClient.RestoreIndexes(ctx, m.config.Migration.MigrationName)
+	if err != nil {
+		return err
+	}
+	log.Printf("Restored %d indexes", restored)
+	return nil
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// LookupCache maps the key values of a lookup table to row IDs. With a capacity it is an LRU
+// cache that evicts the least recently used value once full; a zero capacity keeps every value.
+// It is safe for concurrent use.
+type LookupCache struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List // most recently used first
+
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+type lookupCacheEntry struct {
+	key string
+	id  uuid.UUID
+}
+
+// NewLookupCache creates a cache holding at most capacity values (0 for no limit)
+func NewLookupCache(capacity int) *LookupCache {
+	return &LookupCache{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// Get returns the ID cached for key and marks it as recently used
+func (c *LookupCache) Get(key string) (uuid.UUID, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return uuid.Nil, false
+	}
+	c.hits++
+	c.order.MoveToFront(elem)
+	return elem.Value.(*lookupCacheEntry).id, true
+}
+
+// Put caches the ID of key as recently used, evicting the least recently used value if the cache is full
+func (c *LookupCache) Put(key string, id uuid.UUID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*lookupCacheEntry).id = id
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&lookupCacheEntry{key: key, id: id})
+	if c.capacity > 0 && c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lookupCacheEntry).key)
+		c.evictions++
+	}
+}
+
+// Refresh updates the ID of a cached key without marking it as used, and caches a new key only
+// while there is room, so that loading a table never evicts values in use. It returns false if
+// key was not cached and the cache is full.
+func (c *LookupCache) Refresh(key string, id uuid.UUID) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*lookupCacheEntry).id = id
+		return true
+	}
+	if c.capacity > 0 && c.order.Len() >= c.capacity {
+		return false
+	}
+	c.entries[key] = c.order.PushBack(&lookupCacheEntry{key: key, id: id})
+	return true
+}
+
+// Len returns the number of cached values
+func (c *LookupCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// Stats returns the hits, misses and evictions since the cache was created
+func (c *LookupCache) Stats() (hits, misses, evictions uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses, c.evictions
+}
+
+// lookupTables lists every lookup table, in load order
+var lookupTables = []lookupTable{asnLookup, countryLookup, protocolLookup, applicationProtocolLookup, malwareFamilyLookup}
+
+// loadLookupCaches streams every lookup table into its cache. A table that cannot be read is
+// skipped with a warning, since its values are still resolved on demand.
+func (p *PostgreSQLClient) loadLookupCaches(ctx context.Context) {
+	counts := make([]int, len(lookupTables))
+	for i, table := range lookupTables {
+		count, err := p.loadLookupCache(ctx, table)
+		if err != nil {
+			log.Printf("Warning: Could not load %s cache (table may not exist): %v", table.name, err)
+		}
+		counts[i] = count
+	}
+
+	log.Printf("Loaded lookup caches: %d ASNs, %d countries, %d protocols, %d application protocols, %d malware families",
+		counts[0], counts[1], counts[2], counts[3], counts[4])
+}
+
+// loadLookupCache streams the rows of table into its cache and returns the number of values
+// cached. Rows are read as the server sends them, so the whole table is never held in memory
+// at once. A full bounded cache only updates the values it holds.
+func (p *PostgreSQLClient) loadLookupCache(ctx context.Context, table lookupTable) (int, error) {
+	cache := p.cacheFor(table)
+	keyColumn := quoteIdentifier(table.keyColumn)
+	rows, err := p.db.QueryContext(ctx, fmt.Sprintf(`SELECT "Id", %s FROM %s`, keyColumn, quoteIdentifier(table.name)))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	count, skipped := 0, 0
+	for rows.Next() {
+		var id uuid.UUID
+		var key string
+		if err := rows.Scan(&id, &key); err != nil {
+			log.Printf("Warning: failed to scan %s row: %v", table.name, err)
+			continue
+		}
+		if key == "" {
+			continue
+		}
+		if !cache.Refresh(key, id) {
+			skipped++
+			continue
+		}
+		count++
+	}
+	if skipped > 0 {
+		log.Printf("%s cache is full at %d entries, %d values not cached are resolved on demand", table.name, cache.Len(), skipped)
+	}
+	return count, rows.Err()
+}
+
+// refreshLookupCaches reloads the lookup caches every interval until ctx is cancelled, picking
+// up IDs created by other writers such as the API or parallel migrations
+func (p *PostgreSQLClient) refreshLookupCaches(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, table := range lookupTables {
+			if _, err := p.loadLookupCache(ctx, table); err != nil && ctx.Err() == nil {
+				log.Printf("Warning: failed to refresh %s cache: %v", table.name, err)
+			}
+		}
+		p.logLookupCacheStats()
+	}
+}
+
+// logLookupCacheStats logs the size and hit rate of every lookup cache
+func (p *PostgreSQLClient) logLookupCacheStats() {
+	for _, table := range lookupTables {
+		cache := p.cacheFor(table)
+		hits, misses, evictions := cache.Stats()
+		hitRate := 0.0
+		if hits+misses > 0 {
+			hitRate = float64(hits) / float64(hits+misses) * 100
+		}
+		log.Printf("Lookup cache %s: %d entries, %.1f%% hit rate (%d hits, %d misses), %d evictions",
+			table.name, cache.Len(), hitRate, hits, misses, evictions)
+	}
+}
+
+// Collectors returns the Prometheus collectors exporting the lookup cache sizes and evictions
+func (p *PostgreSQLClient) Collectors() []prometheus.Collector {
+	var collectors []prometheus.Collector
+	for _, table := range lookupTables {
+		cache := p.cacheFor(table)
+		labels := prometheus.Labels{"table": table.name}
+		collectors = append(collectors,
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Name:        "migration_lookup_cache_entries",
+				Help:        "Values held in the lookup cache, per table.",
+				ConstLabels: labels,
+			}, func() float64 { return float64(cache.Len()) }),
+			prometheus.NewCounterFunc(prometheus.CounterOpts{
+				Name:        "migration_lookup_cache_evictions_total",
+				Help:        "Values evicted from a bounded lookup cache, per table.",
+				ConstLabels: labels,
+			}, func() float64 {
+				_, _, evictions := cache.Stats()
+				return float64(evictions)
+			}),
+		)
+	}
+	return collectors
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Lookup values (ASNs, countries, protocols, application protocols, malware families) are resolved a batch at a time:
+// the distinct values a batch needs that are not cached yet are created or fetched with one
+// multi-row upsert per table, instead of a SELECT/INSERT round trip per value. Workers missing
+// the same value at the same time share a single resolution.
+
+// lookupTable describes a lookup table keyed by a unique column
+type lookupTable struct {
+	name        string
+	keyColumn   string
+	extraColumn string // optional column filled in when a row is created
+	asnColumn   string // optional bigint column filled in with the AS number parsed from the key
+}
+
+var (
+	asnLookup                 = lookupTable{name: "AsnRegistries", keyColumn: "Number", extraColumn: "Description", asnColumn: "AsNumber"}
+	countryLookup             = lookupTable{name: "Countries", keyColumn: "Code", extraColumn: "Name"}
+	protocolLookup            = lookupTable{name: "Protocols", keyColumn: "Name"}
+	applicationProtocolLookup = lookupTable{name: "ApplicationProtocols", keyColumn: "Name"}
+	malwareFamilyLookup       = lookupTable{name: "MalwareFamilies", keyColumn: "Name"}
+)
+
+// lookupCall is the resolution of one lookup value by a worker, which other workers missing
+// the same value wait for
+type lookupCall struct {
+	done chan struct{}
+	id   uuid.UUID
+	err  error
+}
+
+// lookupValues collects the distinct values of one lookup table needed by a batch, with the
+// extra column value of the first document that used each of them
+type lookupValues map[string]string
+
+// add records value, ignoring empty values
+func (v lookupValues) add(value, extra string) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return
+	}
+	if _, ok := v[value]; !ok {
+		v[value] = extra
+	}
+}
+
+// resolvedLookups holds the IDs resolved for one lookup table, and the error that kept any
+// value from resolving
+type resolvedLookups struct {
+	table lookupTable
+	ids   map[string]uuid.UUID
+	err   error
+}
+
+// id returns the ID resolved for value
+func (r resolvedLookups) id(value string) (uuid.UUID, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return uuid.Nil, fmt.Errorf("%s value cannot be empty", r.table.keyColumn)
+	}
+	if id, ok := r.ids[value]; ok {
+		return id, nil
+	}
+	if r.err != nil {
+		return uuid.Nil, r.err
+	}
+	return uuid.Nil, fmt.Errorf("%s.%s %q was not resolved", r.table.name, r.table.keyColumn, value)
+}
+
+// cacheFor returns the cache of table
+func (p *PostgreSQLClient) cacheFor(table lookupTable) *LookupCache {
+	switch table.name {
+	case asnLookup.name:
+		return p.asnCache
+	case countryLookup.name:
+		return p.countryCache
+	case protocolLookup.name:
+		return p.protocolCache
+	case applicationProtocolLookup.name:
+		return p.applicationProtocolCache
+	default:
+		return p.malwareFamilyCache
+	}
+}
+
+// getOrCreateLookup returns the ID of value in table, creating the row if needed
+func (p *PostgreSQLClient) getOrCreateLookup(table lookupTable, value, extra string) (uuid.UUID, error) {
+	values := lookupValues{}
+	values.add(value, extra)
+	ids, err := p.resolveLookups(context.Background(), table, values)
+	return resolvedLookups{table: table, ids: ids, err: err}.id(value)
+}
+
+// resolveLookups returns the IDs of values in table. Cached values are returned directly; the
+// rest are upserted in one statement, except for values another worker is already resolving,
+// whose result is awaited instead. The IDs resolved so far are returned along with any error.
+func (p *PostgreSQLClient) resolveLookups(ctx context.Context, table lookupTable, values lookupValues) (map[string]uuid.UUID, error) {
+	ids := make(map[string]uuid.UUID, len(values))
+	var missing []string
+
+	cache := p.cacheFor(table)
+	for value := range values {
+		if id, ok := cache.Get(value); ok {
+			ids[value] = id
+		} else {
+			missing = append(missing, value)
+		}
+	}
+
+	for range ids {
+		p.metrics.LookupCache(table.name, true)
+	}
+	for range missing {
+		p.metrics.LookupCache(table.name, false)
+	}
+	if len(missing) == 0 {
+		return ids, nil
+	}
+
+	// Claim the values no other worker is resolving, and wait for the others
+	owned := make(map[string]*lookupCall)
+	waiting := make(map[string]*lookupCall)
+	p.inflightMutex.Lock()
+	for _, value := range missing {
+		key := table.name + "\x00" + value
+		if call, ok := p.inflight[key]; ok {
+			waiting[value] = call
+			continue
+		}
+		call := &lookupCall{done: make(chan struct{})}
+		p.inflight[key] = call
+		owned[value] = call
+	}
+	p.inflightMutex.Unlock()
+
+	if len(owned) > 0 {
+		keys := make([]string, 0, len(owned))
+		for value := range owned {
+			keys = append(keys, value)
+		}
+		upserted, err := p.upsertLookups(ctx, table, keys, values)
+
+		for value, id := range upserted {
+			cache.Put(value, id)
+		}
+
+		p.inflightMutex.Lock()
+		for value, call := range owned {
+			if id, ok := upserted[value]; ok {
+				call.id = id
+				ids[value] = id
+			} else if err != nil {
+				call.err = err
+			} else {
+				call.err = fmt.Errorf("%s.%s %q was not returned by the upsert", table.name, table.keyColumn, value)
+			}
+			delete(p.inflight, table.name+"\x00"+value)
+			close(call.done)
+		}
+		p.inflightMutex.Unlock()
+	}
+
+	var firstErr error
+	for value, call := range waiting {
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return ids, ctx.Err()
+		}
+		if call.err != nil {
+			if firstErr == nil {
+				firstErr = call.err
+			}
+			continue
+		}
+		ids[value] = call.id
+	}
+	return ids, firstErr
+}
+
+// upsertLookups creates the rows of table missing for keys with a single statement and returns
+// the ID of every key. Rows committed by another transaction while the statement ran are not
+// visible to it, so those keys are looked up again afterwards.
+func (p *PostgreSQLClient) upsertLookups(ctx context.Context, table lookupTable, keys []string, values lookupValues) (map[string]uuid.UUID, error) {
+	newIDs := make([]string, len(keys))
+	for i := range keys {
+		newIDs[i] = uuid.New().String()
+	}
+
+	tableName := quoteIdentifier(table.name)
+	keyColumn := quoteIdentifier(table.keyColumn)
+	inputColumns := `"Id", "Key"`
+	inputArrays := `$1::uuid[], $2::text[]`
+	insertColumns := `"Id", ` + keyColumn + `, "CreatedAt"`
+	selectColumns := `"Id", "Key", $3::timestamptz`
+	args := []any{pq.Array(newIDs), pq.Array(keys), time.Now().UTC()}
+	if table.extraColumn != "" {
+		extras := make([]string, len(keys))
+		for i, key := range keys {
+			extras[i] = values[key]
+		}
+		inputColumns += `, "Extra"`
+		inputArrays += `, $4::text[]`
+		insertColumns += `, ` + quoteIdentifier(table.extraColumn)
+		selectColumns += `, "Extra"`
+		args = append(args, pq.Array(extras))
+	}
+	if table.asnColumn != "" {
+		// Keys that are not an AS number, kept as they were, get no number
+		numbers := make([]string, len(keys))
+		for i, key := range keys {
+			if asn, _, err := ParseASN(key); err == nil {
+				numbers[i] = strconv.FormatUint(uint64(asn), 10)
+			}
+		}
+		args = append(args, pq.Array(numbers))
+		inputColumns += `, "Asn"`
+		inputArrays += fmt.Sprintf(`, $%d::text[]`, len(args))
+		insertColumns += `, ` + quoteIdentifier(table.asnColumn)
+		selectColumns += `, NULLIF("Asn", '')::bigint`
+	}
+
+	// The final SELECT sees the table as it was before the INSERT, so it returns the rows that
+	// already existed and the CTE returns the rows it created
+	query := fmt.Sprintf(`
+		WITH input AS (
+			SELECT * FROM unnest(%s) AS i(%s)
+		), inserted AS (
+			INSERT INTO %s (%s)
+			SELECT %s FROM input
+			ON CONFLICT (%s) DO NOTHING
+			RETURNING "Id", %s
+		)
+		SELECT "Id", %s FROM inserted
+		UNION ALL
+		SELECT t."Id", t.%s FROM %s t JOIN input i ON t.%s = i."Key"`,
+		inputArrays, inputColumns,
+		tableName, insertColumns,
+		selectColumns,
+		keyColumn,
+		keyColumn,
+		keyColumn,
+		keyColumn, tableName, keyColumn)
+
+	ids := make(map[string]uuid.UUID, len(keys))
+	if err := p.scanLookupIDs(ctx, ids, query, args...); err != nil {
+		return ids, fmt.Errorf("upsert %s.%s failed: %w", table.name, table.keyColumn, err)
+	}
+	if len(ids) == len(keys) {
+		return ids, nil
+	}
+
+	var raced []string
+	for _, key := range keys {
+		if _, ok := ids[key]; !ok {
+			raced = append(raced, key)
+		}
+	}
+	query = fmt.Sprintf(`SELECT "Id", %s FROM %s WHERE %s = ANY($1)`, keyColumn, tableName, keyColumn)
+	if err := p.scanLookupIDs(ctx, ids, query, pq.Array(raced)); err != nil {
+		return ids, fmt.Errorf("post-conflict select %s.%s failed: %w", table.name, table.keyColumn, err)
+	}
+	return ids, nil
+}
+
+// scanLookupIDs runs query and adds the ("Id", key) rows it returns to ids
+func (p *PostgreSQLClient) scanLookupIDs(ctx context.Context, ids map[string]uuid.UUID, query string, args ...any) error {
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id uuid.UUID
+		var key string
+		if err := rows.Scan(&id, &key); err != nil {
+			return err
+		}
+		ids[key] = id
+	}
+	return rows.Err()
+}
+
+// TransformDocuments transforms a batch of MongoDB documents to PostgreSQL records. The lookup
+// values of the whole batch are resolved together before the records are built. The result
+// slices are parallel to docs: each document has either a record or an error.
+func (p *PostgreSQLClient) TransformDocuments(ctx context.Context, docs []ThreatDocument) ([]*ThreatRecord, []error) {
+	threats := make([]*NormalizedThreat, len(docs))
+	errs := make([]error, len(docs))
+
+	asns, countries, protocols, applications, families := lookupValues{}, lookupValues{}, lookupValues{}, lookupValues{}, lookupValues{}
+	for i, doc := range docs {
+		threat, err := p.NormalizeDocument(doc)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		threats[i] = threat
+
+		asns.add(threat.ASN, threat.ASNInfo)
+		countries.add(threat.SourceCountry, threat.SourceCountryName)
+		countries.add(threat.DestinationCountry, threat.DestinationCountryName)
+		protocols.add(threat.Protocol, "")
+		applications.add(threat.ApplicationProtocol, "")
+		families.add(threat.MalwareFamily, "")
+	}
+
+	resolve := func(table lookupTable, values lookupValues) resolvedLookups {
+		ids, err := p.resolveLookups(ctx, table, values)
+		return resolvedLookups{table: table, ids: ids, err: err}
+	}
+	asnIDs := resolve(asnLookup, asns)
+	countryIDs := resolve(countryLookup, countries)
+	protocolIDs := resolve(protocolLookup, protocols)
+	applicationIDs := resolve(applicationProtocolLookup, applications)
+	familyIDs := resolve(malwareFamilyLookup, families)
+
+	records := make([]*ThreatRecord, len(docs))
+	for i, threat := range threats {
+		if threat == nil {
+			continue
+		}
+		records[i], errs[i] = buildThreatRecord(threat, asnIDs, countryIDs, protocolIDs, applicationIDs, familyIDs)
+	}
+	return records, errs
+}
+
+// buildThreatRecord builds the record for a normalized threat from resolved lookup IDs
+func buildThreatRecord(threat *NormalizedThreat, asnIDs, countryIDs, protocolIDs, applicationIDs, familyIDs resolvedLookups) (*ThreatRecord, error) {
+	// Get ASN ID (required field)
+	asnUUID, err := asnIDs.id(threat.ASN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ASN ID for '%s': %w", threat.ASN, err)
+	}
+
+	record := &ThreatRecord{
+		ID:                 threat.ID,
+		Timestamp:          threat.Timestamp,
+		AsnRegistryID:      asnUUID,
+		SourceAddress:      threat.SourceAddress,
+		DestinationAddress: threat.DestinationAddress,
+		SourcePort:         threat.SourcePort,
+		DestinationPort:    threat.DestinationPort,
+		Category:           threat.Category,
+		CreatedAt:          threat.CreatedAt,
+		UpdatedAt:          threat.UpdatedAt,
+	}
+
+	if threat.SourceCountry != "" {
+		countryID, err := countryIDs.id(threat.SourceCountry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get source country ID for '%s': %w", threat.SourceCountry, err)
+		}
+		record.SourceCountryID = &countryID
+	}
+
+	if threat.DestinationCountry != "" {
+		countryID, err := countryIDs.id(threat.DestinationCountry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get destination country ID for '%s': %w", threat.DestinationCountry, err)
+		}
+		record.DestinationCountryID = &countryID
+	}
+
+	if threat.Protocol != "" {
+		protocolID, err := protocolIDs.id(threat.Protocol)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get protocol ID for '%s': %w", threat.Protocol, err)
+		}
+		record.ProtocolID = &protocolID
+	}
+
+	if threat.ApplicationProtocol != "" {
+		applicationID, err := applicationIDs.id(threat.ApplicationProtocol)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get application protocol ID for '%s': %w", threat.ApplicationProtocol, err)
+		}
+		record.ApplicationProtocolID = &applicationID
+	}
+
+	if threat.MalwareFamily != "" {
+		familyID, err := familyIDs.id(threat.MalwareFamily)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get malware family ID for '%s': %w", threat.MalwareFamily, err)
+		}
+		record.MalwareFamilyID = &familyID
+	}
+
+	return record, nil
+}
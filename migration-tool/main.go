@@ -2,26 +2,48 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
-	"os/signal"
 	"strings"
 	"sync"
-	"syscall"
 	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // MigrationTool orchestrates the migration process
 type MigrationTool struct {
 	config         *Config
-	mongoClient    *MongoDBClient
+	mongoClient    *MongoDBClient // nil when reading from export files
 	postgresClient *PostgreSQLClient
+	events         threatEventWriter // writes ThreatEvents rows; postgresClient outside tests
+	source         Source
 
 	// Enhanced error handling and batch processing
 	batchProcessor *BatchProcessor
 	errorLogger    *ErrorLogger
 
+	// Durable resume checkpoints (nil in dry-run mode)
+	checkpointStore CheckpointStore
+	// Rejected documents (nil when dead-lettering is disabled)
+	deadLetters DeadLetterStore
+	// Prometheus instrumentation, served when MetricsAddr is set
+	metrics *Metrics
+	// Throughput-driven tuning (nil when adaptive COPY is disabled)
+	adaptive *AdaptiveController
+	// Pauses reading and writing while PostgreSQL is unreachable (nil when disabled or in dry-run mode)
+	breaker *CircuitBreaker
+	// Local spool taking batches while PostgreSQL is unreachable (nil when disabled or in dry-run mode)
+	spool *Spool
+	// Normalization rules, reloaded while running when the rule file changes
+	rules          *RuleStore
+	stopRulesWatch context.CancelFunc
+	// File sinks receiving the stored records of each batch (nil when PostgreSQL is the only sink or in dry-run mode)
+	sinks Sink
+
 	// Progress tracking
 	totalDocuments     int64
 	processedDocuments int64
@@ -40,6 +62,11 @@ type MigrationResult struct {
 	BatchID        int
 	ProcessingTime time.Duration
 	RetryCount     int
+	// Checkpoint bookkeeping
+	LastDocumentID primitive.ObjectID // _id of the last document in the batch
+	Position       string             // source position just after the batch
+	Committed      bool               // true once every valid record in the batch is stored
+	RulesVersion   string             // normalization rule set the batch was transformed with
 }
 
 // ErrorType represents different types of errors that can occur during migration
@@ -189,15 +216,35 @@ func (p *ProgressTracker) GetProgress() (processed, total, errors int64, elapsed
 
 // NewMigrationTool creates a new migration tool instance
 func NewMigrationTool(config *Config) (*MigrationTool, error) {
-	// Initialize MongoDB client
-	mongoClient, err := NewMongoDBClient(config.MongoDB)
+	// Load and validate the normalization rules before connecting to anything
+	rules, err := NewRuleStore(config.Migration.RulesFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load normalization rules: %w", err)
+	}
+	services, err := loadServiceRegistry(config.Migration.ServiceNamesFile)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create MongoDB client: %w", err)
+		return nil, err
+	}
+
+	// Initialize MongoDB client, unless documents are read from export files
+	var mongoClient *MongoDBClient
+	if config.Source.Type == SourceMongoDB {
+		mongoClient, err = NewMongoDBClient(config.MongoDB)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create MongoDB client: %w", err)
+		}
+	}
+
+	source, err := NewSource(config.Source, mongoClient)
+	if err != nil {
+		mongoClient.Close(context.Background())
+		return nil, fmt.Errorf("failed to open source: %w", err)
 	}
 
 	// Initialize PostgreSQL client
 	postgresClient, err := NewPostgreSQLClient(config.PostgreSQL, config.Migration)
 	if err != nil {
+		source.Close()
 		mongoClient.Close(context.Background())
 		return nil, fmt.Errorf("failed to create PostgreSQL client: %w", err)
 	}
@@ -205,6 +252,42 @@ func NewMigrationTool(config *Config) (*MigrationTool, error) {
 	// Initialize error logger
 	errorLogger := NewErrorLogger()
 
+	metrics := NewMetrics()
+	metrics.Track(nil, errorLogger)
+	postgresClient.metrics = metrics
+	metrics.Register(postgresClient.Collectors()...)
+	postgresClient.rules = rules
+	postgresClient.services = services
+	metrics.Register(rules.Collectors()...)
+	metrics.Register(documentCoercions.Collectors()...)
+
+	var adaptive *AdaptiveController
+	if config.Migration.AdaptiveCopy {
+		adaptive = NewAdaptiveController(config.Migration)
+		metrics.Register(adaptive.Collectors()...)
+		postgresClient.adaptive = adaptive
+	}
+
+	var breaker *CircuitBreaker
+	if config.Migration.BreakerThreshold > 0 && !config.Migration.DryRun {
+		breaker = NewCircuitBreaker(config.Migration.BreakerThreshold,
+			time.Duration(config.Migration.BreakerProbeIntervalSeconds)*time.Second, postgresClient.probeWrites)
+		metrics.Register(breaker.Collectors()...)
+		postgresClient.breaker = breaker
+	}
+
+	var spool *Spool
+	if config.Migration.SpoolDir != "" && !config.Migration.DryRun {
+		spool, err = OpenSpool(config.Migration.SpoolDir, int64(config.Migration.SpoolSegmentMB)<<20, int64(config.Migration.SpoolMaxMB)<<20)
+		if err != nil {
+			postgresClient.Close()
+			source.Close()
+			mongoClient.Close(context.Background())
+			return nil, err
+		}
+		metrics.Register(spool.Collectors()...)
+	}
+
 	// Initialize batch processor with configuration
 	batchProcessor := &BatchProcessor{
 		maxRetries:   config.Migration.MaxRetries,
@@ -213,12 +296,127 @@ func NewMigrationTool(config *Config) (*MigrationTool, error) {
 		errorLogger:  errorLogger,
 	}
 
+	// Checkpoints are only meaningful when records are actually written
+	var checkpointStore CheckpointStore
+	if !config.Migration.DryRun {
+		checkpointStore, err = NewCheckpointStore(config.Migration, postgresClient)
+		if err != nil {
+			postgresClient.Close()
+			source.Close()
+			mongoClient.Close(context.Background())
+			return nil, fmt.Errorf("failed to create checkpoint store: %w", err)
+		}
+	}
+
+	deadLetters, err := NewDeadLetterStore(config.Migration, postgresClient)
+	if err != nil {
+		postgresClient.Close()
+		source.Close()
+		mongoClient.Close(context.Background())
+		return nil, fmt.Errorf("failed to create dead-letter store: %w", err)
+	}
+
+	var sinks Sink
+	if config.Migration.DryRun {
+		log.Println("Dry run: file sinks disabled")
+	} else if sinks, err = NewSinks(config.Sink); err != nil {
+		if deadLetters != nil {
+			deadLetters.Close()
+		}
+		postgresClient.Close()
+		source.Close()
+		mongoClient.Close(context.Background())
+		return nil, fmt.Errorf("failed to open sinks: %w", err)
+	}
+
+	stopRulesWatch := func() {}
+	if config.Migration.RulesReload {
+		var watchCtx context.Context
+		watchCtx, stopRulesWatch = context.WithCancel(context.Background())
+		if err := rules.Watch(watchCtx); err != nil {
+			log.Printf("Warning: rule changes will not be picked up: %v", err)
+		}
+	}
+
+	return &MigrationTool{
+		config:          config,
+		mongoClient:     mongoClient,
+		postgresClient:  postgresClient,
+		events:          postgresClient,
+		source:          source,
+		batchProcessor:  batchProcessor,
+		errorLogger:     errorLogger,
+		checkpointStore: checkpointStore,
+		deadLetters:     deadLetters,
+		metrics:         metrics,
+		adaptive:        adaptive,
+		breaker:         breaker,
+		spool:           spool,
+		sinks:           sinks,
+		rules:           rules,
+		stopRulesWatch:  stopRulesWatch,
+		startTime:       time.Now(),
+	}, nil
+}
+
+// NewReadOnlyTool creates a MigrationTool for the commands that only read from both databases
+// (health, verify). It connects without creating the checkpoint and dead-letter tables, the
+// staging table or the spool, and without fixing country names, so it never writes.
+func NewReadOnlyTool(config *Config) (*MigrationTool, error) {
+	rules, err := NewRuleStore(config.Migration.RulesFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load normalization rules: %w", err)
+	}
+	services, err := loadServiceRegistry(config.Migration.ServiceNamesFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var mongoClient *MongoDBClient
+	if config.Source.Type == SourceMongoDB {
+		mongoClient, err = NewMongoDBClient(config.MongoDB)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create MongoDB client: %w", err)
+		}
+	}
+
+	source, err := NewSource(config.Source, mongoClient)
+	if err != nil {
+		mongoClient.Close(context.Background())
+		return nil, fmt.Errorf("failed to open source: %w", err)
+	}
+
+	postgresClient, err := ConnectPostgreSQL(config.PostgreSQL, config.Migration)
+	if err != nil {
+		source.Close()
+		mongoClient.Close(context.Background())
+		return nil, fmt.Errorf("failed to create PostgreSQL client: %w", err)
+	}
+	if err := postgresClient.checkSchema(); err != nil {
+		postgresClient.Close()
+		source.Close()
+		mongoClient.Close(context.Background())
+		return nil, err
+	}
+	postgresClient.rules = rules
+	postgresClient.services = services
+
+	errorLogger := NewErrorLogger()
+	metrics := NewMetrics()
+	metrics.Track(nil, errorLogger)
+	metrics.Register(postgresClient.Collectors()...)
+	metrics.Register(rules.Collectors()...)
+	postgresClient.metrics = metrics
+
 	return &MigrationTool{
 		config:         config,
 		mongoClient:    mongoClient,
 		postgresClient: postgresClient,
-		batchProcessor: batchProcessor,
+		source:         source,
 		errorLogger:    errorLogger,
+		metrics:        metrics,
+		rules:          rules,
+		stopRulesWatch: func() {},
 		startTime:      time.Now(),
 	}, nil
 }
@@ -227,10 +425,32 @@ func NewMigrationTool(config *Config) (*MigrationTool, error) {
 func (m *MigrationTool) Close() error {
 	var errors []error
 
+	m.stopRulesWatch()
+
+	if err := m.source.Close(); err != nil {
+		errors = append(errors, fmt.Errorf("failed to close source: %w", err))
+	}
+
 	if err := m.mongoClient.Close(context.Background()); err != nil {
 		errors = append(errors, fmt.Errorf("failed to close MongoDB client: %w", err))
 	}
 
+	if err := m.spool.Close(); err != nil {
+		errors = append(errors, fmt.Errorf("failed to close spool: %w", err))
+	}
+
+	if m.deadLetters != nil {
+		if err := m.deadLetters.Close(); err != nil {
+			errors = append(errors, fmt.Errorf("failed to close dead-letter store: %w", err))
+		}
+	}
+
+	if m.sinks != nil {
+		if err := m.sinks.Close(); err != nil {
+			errors = append(errors, fmt.Errorf("failed to close sinks: %w", err))
+		}
+	}
+
 	if err := m.postgresClient.Close(); err != nil {
 		errors = append(errors, fmt.Errorf("failed to close PostgreSQL client: %w", err))
 	}
@@ -246,14 +466,37 @@ func (m *MigrationTool) Close() error {
 func (m *MigrationTool) Migrate(ctx context.Context) error {
 	log.Println("Starting migration process...")
 
+	// Load the checkpoint for this migration so we resume where committed work ended
+	checkpoint, err := NewCheckpointTracker(ctx, m.checkpointStore, m.config.Migration.MigrationName)
+	if err != nil {
+		return fmt.Errorf("failed to load checkpoint: %w", err)
+	}
+	if resumeFrom := m.config.Migration.ResumeFromID; resumeFrom != "" {
+		alreadyProcessed, err := m.source.CountUpTo(ctx, resumeFrom)
+		if err != nil {
+			return fmt.Errorf("invalid MIGRATION_RESUME_FROM_ID: %w", err)
+		}
+		log.Printf("Overriding checkpoint with MIGRATION_RESUME_FROM_ID=%s", resumeFrom)
+		checkpoint.Override(resumeFrom, alreadyProcessed)
+	}
+
+	indexesSuspended, err := m.prepareIndexes(ctx)
+	if err != nil {
+		return err
+	}
+
 	// Total count will be determined by the resume function
 	m.totalDocuments = 0                     // Will be set by resume function
 	progressTracker := NewProgressTracker(0) // Will be updated
+	m.metrics.Track(progressTracker, m.errorLogger)
 
 	// Create channels for communication between goroutines
-	documentChan := make(chan []ThreatDocument, m.config.Migration.BufferSize)
+	documentChan := make(chan SourceBatch, m.config.Migration.BufferSize)
 	resultChan := make(chan MigrationResult, m.config.Migration.BufferSize)
 
+	// Replay batches spooled during PostgreSQL outages, including those left by an earlier run
+	stopDrainer := m.startSpoolDrainer(ctx)
+
 	// Start worker pool
 	var wg sync.WaitGroup
 	for i := 0; i < m.config.Migration.WorkerCount; i++ {
@@ -266,21 +509,15 @@ func (m *MigrationTool) Migrate(ctx context.Context) error {
 	go m.reportProgress(progressCtx, progressTracker)
 
 	// Start result processor
-	go m.processResults(ctx, resultChan, progressTracker)
+	resultsDone := make(chan struct{})
+	go func() {
+		defer close(resultsDone)
+		m.processResults(ctx, resultChan, progressTracker, checkpoint)
+	}()
 
-	// Start reading documents from MongoDB with resume capability
+	// Start reading documents from the source with resume capability
 	go func() {
-		defer func() {
-			// Safely close the channel
-			select {
-			case <-documentChan:
-				// Channel already closed
-			default:
-				close(documentChan)
-			}
-		}()
-		migrationName := "threat_intelligence_migration"
-		if err := m.mongoClient.ReadAllDocumentsWithResume(ctx, m.config.Migration.BatchSize, documentChan, migrationName, m.postgresClient, progressTracker); err != nil {
+		if err := ReadAllDocumentsWithResume(ctx, m.source, m.batchSize, m.writesReady, documentChan, checkpoint, progressTracker); err != nil {
 			log.Printf("Error reading documents: %v", err)
 		}
 	}()
@@ -288,18 +525,53 @@ func (m *MigrationTool) Migrate(ctx context.Context) error {
 	// Wait for all workers to complete
 	wg.Wait()
 	close(resultChan)
+	<-resultsDone
+
+	// Spooled batches count as committed, so the load is only complete once they are replayed
+	if m.spool.Pending() {
+		log.Println("📦 Waiting for spooled batches to be replayed into PostgreSQL...")
+		if !m.spool.WaitEmpty(ctx) {
+			log.Printf("⚠️  Spool %s still holds batches, they are replayed by the next run", m.config.Migration.SpoolDir)
+		}
+	}
+	stopDrainer()
 
 	// Stop progress reporting
 	progressCancel()
 
+	// Persist the final checkpoint even if the run was interrupted
+	flushCtx, flushCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer flushCancel()
+	if err := checkpoint.Flush(flushCtx); err != nil {
+		log.Printf("Warning: failed to persist final checkpoint: %v", err)
+	} else if id := checkpoint.LastProcessedID(); id != "" {
+		log.Printf("Checkpoint %s at %s (%d documents committed)", checkpoint.Name(), id, checkpoint.ProcessedCount())
+	}
+
 	// Generate comprehensive migration summary
 	m.generateMigrationSummary(progressTracker)
 
+	if indexesSuspended {
+		if ctx.Err() != nil {
+			log.Println("⚠️  Load interrupted: ThreatEvents indexes stay suspended until the load is resumed and finishes, or `migration-tool restore-indexes` is run")
+			return nil
+		}
+		log.Println("Rebuilding suspended ThreatEvents indexes...")
+		if err := m.RestoreIndexes(ctx); err != nil {
+			return fmt.Errorf("load finished but indexes could not be restored (run `migration-tool restore-indexes` to retry): %w", err)
+		}
+	}
+
 	return nil
 }
 
+// batchSize returns the number of documents to read per batch
+func (m *MigrationTool) batchSize() int {
+	return m.adaptive.BatchSize(m.config.Migration.BatchSize)
+}
+
 // worker processes batches of documents
-func (m *MigrationTool) worker(ctx context.Context, documentChan <-chan []ThreatDocument, resultChan chan<- MigrationResult, wg *sync.WaitGroup) {
+func (m *MigrationTool) worker(ctx context.Context, documentChan <-chan SourceBatch, resultChan chan<- MigrationResult, wg *sync.WaitGroup) {
 	defer wg.Done()
 
 	for {
@@ -309,7 +581,14 @@ func (m *MigrationTool) worker(ctx context.Context, documentChan <-chan []Threat
 				return // Channel closed, worker done
 			}
 
-			result := m.processBatch(ctx, batch)
+			// Wait while writes cannot proceed, then for an in-flight slot; the adaptive
+			// controller may run fewer than WorkerCount
+			if !m.writesReady(ctx) || !m.adaptive.Acquire(ctx) {
+				return
+			}
+			result := m.processBatch(ctx, batch.Documents)
+			result.Position = batch.Position
+			m.adaptive.Release()
 
 			select {
 			case resultChan <- result:
@@ -326,6 +605,7 @@ func (m *MigrationTool) worker(ctx context.Context, documentChan <-chan []Threat
 // processBatch processes a batch of MongoDB documents with enhanced error handling and retry logic
 func (m *MigrationTool) processBatch(ctx context.Context, documents []ThreatDocument) MigrationResult {
 	startTime := time.Now()
+	m.metrics.DocumentsRead(len(documents))
 
 	result := MigrationResult{
 		ProcessedCount: 0,
@@ -339,8 +619,14 @@ func (m *MigrationTool) processBatch(ctx context.Context, documents []ThreatDocu
 	batchCtx, cancel := context.WithTimeout(ctx, m.batchProcessor.batchTimeout)
 	defer cancel()
 
+	rulesVersion := m.rules.Version()
 	result = m.processBatchWithRetry(batchCtx, documents, 0)
+	result.RulesVersion = rulesVersion
 	result.ProcessingTime = time.Since(startTime)
+	m.metrics.ObserveBatch(result.ProcessingTime)
+	if len(documents) > 0 {
+		result.LastDocumentID = documents[len(documents)-1].ID
+	}
 
 	return result
 }
@@ -355,85 +641,166 @@ func (m *MigrationTool) processBatchWithRetry(ctx context.Context, documents []T
 	}
 
 	var threats []ThreatRecord
+	var threatDocs []ThreatDocument // source document of each record in threats
 	var validationErrors []MigrationError
 	var transformationErrors []MigrationError
+	var deadLetters []DeadLetter
 
 	// Phase 1: Validate and transform documents
+	valid := make([]ThreatDocument, 0, len(documents))
 	for _, doc := range documents {
-		select {
-		case <-ctx.Done():
-			result.Errors = append(result.Errors, fmt.Errorf("batch processing cancelled: %w", ctx.Err()))
-			return result
-		default:
-		}
-
 		// Validate document
 		if err := doc.ValidateDocument(); err != nil {
 			migErr := MigrationError{
 				Type:        ValidationError,
-				DocumentID:  doc.ID.Hex(),
+				DocumentID:  doc.SourceIDString(),
 				Message:     err.Error(),
 				OriginalErr: err,
 				Timestamp:   time.Now(),
 				Retryable:   false, // Validation errors are not retryable
 			}
 			validationErrors = append(validationErrors, migErr)
+			deadLetters = append(deadLetters, NewDeadLetter(doc, migErr))
 			m.errorLogger.LogError(migErr)
 			result.ErrorCount++
 			continue
 		}
+		valid = append(valid, doc)
+	}
 
-		// Transform document
-		threat, err := m.postgresClient.TransformDocument(doc)
-		if err != nil {
-			// Determine if transformation error is retryable
+	// Transform the valid documents, resolving their lookup values together
+	records, transformErrs := m.postgresClient.TransformDocuments(ctx, valid)
+	if ctx.Err() != nil {
+		result.Errors = append(result.Errors, fmt.Errorf("batch processing cancelled: %w", ctx.Err()))
+		return result
+	}
+	for i, doc := range valid {
+		if err := transformErrs[i]; err != nil {
+			// Lookup writes during the transformation can fail like inserts do; anything
+			// unclassified is a problem with the document itself
+			errorType := TransformationError
+			if class := classifyError(err); class != ErrorClassUnknown {
+				errorType = class.ErrorType()
+			}
 			retryable := m.isRetryableError(err)
 
 			migErr := MigrationError{
-				Type:        TransformationError,
-				DocumentID:  doc.ID.Hex(),
+				Type:        errorType,
+				DocumentID:  doc.SourceIDString(),
 				Message:     err.Error(),
 				OriginalErr: err,
 				Timestamp:   time.Now(),
 				Retryable:   retryable,
 			}
 			transformationErrors = append(transformationErrors, migErr)
+			deadLetters = append(deadLetters, NewDeadLetter(doc, migErr))
 			m.errorLogger.LogError(migErr)
 			result.ErrorCount++
 			continue
 		}
 
-		threats = append(threats, *threat)
+		threats = append(threats, *records[i])
+		threatDocs = append(threatDocs, doc)
+	}
+
+	// Phase 1 is repeated on batch retries, count each document once
+	if retryCount == 0 {
+		m.metrics.DocumentsTransformed(len(threats))
+	}
+
+	// Keep rejected documents so they can be replayed. Like the metrics above, they are
+	// only written on the first attempt. If they cannot be stored the batch is
+	// not committed, which keeps the checkpoint from moving past them.
+	deadLettersStored := true
+	if m.deadLetters != nil && len(deadLetters) > 0 && retryCount == 0 {
+		if err := m.deadLetters.Write(ctx, deadLetters); err != nil {
+			deadLettersStored = false
+			result.Errors = append(result.Errors, fmt.Errorf("failed to store %d rejected documents: %w", len(deadLetters), err))
+		}
 	}
 
 	// Phase 2: Insert batch into PostgreSQL with retry logic
-	if len(threats) > 0 {
+	var rejected []RejectedRow
+	var bisected []ThreatRecord // records committed by a bisection that gave up
+	if len(threats) == 0 {
+		result.Committed = true // Nothing to write, every document was rejected
+	} else {
 		if m.config.Migration.DryRun {
 			// Simulate success without DB writes
 			result.ProcessedCount = len(threats)
+			result.Committed = true
+		} else if !m.config.Sink.HasSink(SinkPostgres) {
+			// Only file sinks are configured, they are written below
+			result.ProcessedCount = len(threats)
+			result.Committed = true
+		} else if m.spoolWrites() {
+			m.spoolBatch(ctx, threats, threatDocs, &result)
 		} else {
-			insertErr := m.insertBatchWithRetry(ctx, threats, retryCount)
-			if insertErr != nil {
+			insertErr := m.insertBatchWithRetry(ctx, threats, m.spool == nil)
+			var rejection *RowRejectionError
+			bisectGaveUp := false
+			if insertErr != nil && !errors.As(insertErr, &rejection) && classifyError(insertErr).recordSpecific() && ctx.Err() == nil && len(threats) > 1 &&
+				!m.shouldRetryBatch(insertErr, retryCount) {
+				// Retrying will not help, or this was the last attempt, so split the batch to find
+				// the records the database refuses. Bisecting only on the last attempt means a
+				// batch is bisected at most once and records committed here are never sent again.
+				log.Printf("Batch of %d records failed, bisecting to isolate the bad records: %v", len(threats), insertErr)
+				committed, isolated, bisectErr := m.bisectInsert(ctx, threats, insertErr)
+				switch {
+				case bisectErr != nil:
+					// The parts committed while bisecting stay committed; only the rest of the
+					// batch takes the error path below, without retrying the batch
+					log.Printf("Bisecting failed batch gave up with %d of %d records committed: %v", len(committed), len(threats), bisectErr)
+					result.ProcessedCount = len(committed)
+					m.metrics.DocumentsInserted(len(committed))
+					bisected = committed
+					bisectGaveUp = true
+					threats, threatDocs = uncommittedRecords(threats, threatDocs, committed)
+					insertErr = bisectErr
+				case len(isolated) == 0:
+					insertErr = nil
+				default:
+					insertErr = &RowRejectionError{Rejected: isolated}
+				}
+			}
+			if errors.As(insertErr, &rejection) {
+				// The rest of the batch is committed, only the rejected records take the error path
+				rejected = rejection.Rejected
+				stored := m.rejectRecords(ctx, rejected, threats, threatDocs, &result)
+				result.ProcessedCount = len(threats) - len(rejection.Rejected)
+				result.Committed = stored
+				m.metrics.DocumentsInserted(result.ProcessedCount)
+			} else if insertErr != nil && m.spool != nil && !classifyError(insertErr).recordSpecific() {
+				// PostgreSQL is unreachable or failing: keep the batch in the spool instead
+				log.Printf("Spooling batch of %d records after insert failure: %v", len(threats), insertErr)
+				m.spoolBatch(ctx, threats, threatDocs, &result)
+			} else if insertErr != nil {
 				// Check if we should retry the entire batch
-				if m.shouldRetryBatch(insertErr, retryCount) {
+				if !bisectGaveUp && m.shouldRetryBatch(insertErr, retryCount) {
 					log.Printf("Retrying batch (attempt %d/%d) after error: %v",
 						retryCount+1, m.batchProcessor.maxRetries, insertErr)
 
-					// Wait before retry
+					m.metrics.Retry("batch")
+
+					// Wait before retry, backing off exponentially with the jitter of the error's class
+					_, policy := m.retryPolicy(insertErr)
 					select {
-					case <-time.After(m.batchProcessor.retryDelay):
+					case <-time.After(backoff(m.batchProcessor.retryDelay, 0, retryCount, policy.Jitter)):
 					case <-ctx.Done():
 						result.Errors = append(result.Errors, fmt.Errorf("retry cancelled: %w", ctx.Err()))
 						return result
 					}
 
 					// Retry the entire batch
-					return m.processBatchWithRetry(ctx, documents, retryCount+1)
+					retried := m.processBatchWithRetry(ctx, documents, retryCount+1)
+					retried.Committed = retried.Committed && deadLettersStored
+					return retried
 				}
 
-				// Log database error for all documents in batch
+				// Log the insert error for all documents in batch
+				errorType := classifyError(insertErr).ErrorType()
 				for _, threat := range threats {
-					migErr := MigrationError{Type: DatabaseError, DocumentID: threat.ID.String(), Message: insertErr.Error(), OriginalErr: insertErr, Timestamp: time.Now(), Retryable: m.isRetryableError(insertErr)}
+					migErr := MigrationError{Type: errorType, DocumentID: threat.ID.String(), Message: insertErr.Error(), OriginalErr: insertErr, Timestamp: time.Now(), Retryable: m.isRetryableError(insertErr)}
 					m.errorLogger.LogError(migErr)
 				}
 
@@ -441,10 +808,22 @@ func (m *MigrationTool) processBatchWithRetry(ctx context.Context, documents []T
 				result.Errors = append(result.Errors, fmt.Errorf("batch insert failed after %d retries: %w", retryCount, insertErr))
 			} else {
 				result.ProcessedCount = len(threats)
+				result.Committed = true
+				m.metrics.DocumentsInserted(len(threats))
 			}
 		}
 	}
 
+	// Phase 3: Hand the stored records to the file sinks. Batch retries return above, so this
+	// runs once per batch. If the sinks fail the batch is not committed and will be read again.
+	if m.sinks != nil && result.Committed && result.ProcessedCount > 0 {
+		stored := append(bisected, storedRecords(threats, rejected)...)
+		if err := m.sinks.Write(ctx, stored); err != nil {
+			result.Committed = false
+			result.Errors = append(result.Errors, fmt.Errorf("failed to write %d records to %s: %w", len(stored), m.sinks.Name(), err))
+		}
+	}
+
 	// Add all collected errors to result
 	for _, err := range validationErrors {
 		result.Errors = append(result.Errors, err)
@@ -453,81 +832,211 @@ func (m *MigrationTool) processBatchWithRetry(ctx context.Context, documents []T
 		result.Errors = append(result.Errors, err)
 	}
 
+	result.Committed = result.Committed && deadLettersStored
 	return result
 }
 
-// insertBatchWithRetry attempts to insert a batch with exponential backoff retry
-func (m *MigrationTool) insertBatchWithRetry(ctx context.Context, threats []ThreatRecord, retryCount int) error {
-	var lastErr error
-
-	for attempt := 0; attempt <= m.batchProcessor.maxRetries; attempt++ {
-		select {
-		case <-ctx.Done():
-			return fmt.Errorf("insert cancelled: %w", ctx.Err())
-		default:
+// storedRecords returns threats without the records the database rejected
+func storedRecords(threats []ThreatRecord, rejected []RejectedRow) []ThreatRecord {
+	if len(rejected) == 0 {
+		return threats
+	}
+	rejectedIDs := make(map[uuid.UUID]bool, len(rejected))
+	for _, row := range rejected {
+		rejectedIDs[row.ID] = true
+	}
+	stored := make([]ThreatRecord, 0, len(threats)-len(rejected))
+	for _, threat := range threats {
+		if !rejectedIDs[threat.ID] {
+			stored = append(stored, threat)
 		}
+	}
+	return stored
+}
 
-		err := m.postgresClient.InsertThreatBatch(threats)
-		if err == nil {
-			return nil // Success
+// spoolBatch appends threats and their source documents to the spool. Spooled records count as
+// committed: the spool is durable and is replayed into PostgreSQL in order.
+func (m *MigrationTool) spoolBatch(ctx context.Context, threats []ThreatRecord, docs []ThreatDocument, result *MigrationResult) {
+	entry := SpoolEntry{Records: threats, Sources: make([][]byte, len(docs))}
+	for i := range docs {
+		raw, err := docs[i].RawBSON()
+		if err != nil {
+			result.ErrorCount += len(threats)
+			result.Errors = append(result.Errors, fmt.Errorf("failed to encode document %s for the spool: %w", docs[i].SourceIDString(), err))
+			return
 		}
+		entry.Sources[i] = raw
+	}
+	if err := m.spool.Append(ctx, entry); err != nil {
+		result.ErrorCount += len(threats)
+		result.Errors = append(result.Errors, fmt.Errorf("failed to spool batch of %d records: %w", len(threats), err))
+		return
+	}
+	result.ProcessedCount += len(threats)
+	result.Committed = true
+}
 
-		lastErr = err
-
-		// Check if error is retryable
-		if !m.isRetryableError(err) {
-			return fmt.Errorf("non-retryable error: %w", err)
+// bisectMaxRejectedShare stops bisecting once more than this share of a batch has been
+// rejected: the failure is then most likely not caused by individual records
+const bisectMaxRejectedShare = 0.5
+
+// bisectInsert inserts threats by recursively splitting them in half around failing parts until
+// the records that fail on their own are isolated. Everything else is committed. cause is the
+// error the whole of threats failed with. The records committed are returned even when it gives up.
+func (m *MigrationTool) bisectInsert(ctx context.Context, threats []ThreatRecord, cause error) ([]ThreatRecord, []RejectedRow, error) {
+	limit := int(float64(len(threats)) * bisectMaxRejectedShare)
+	var committed []ThreatRecord
+	var rejected []RejectedRow
+
+	var bisect func(part []ThreatRecord, cause error) error
+	bisect = func(part []ThreatRecord, cause error) error {
+		if len(part) == 1 {
+			rejected = append(rejected, RejectedRow{ID: part[0].ID, Reason: cause.Error()})
+			if len(rejected) > limit {
+				return fmt.Errorf("%d of %d records rejected, last error: %w", len(rejected), len(threats), cause)
+			}
+			return nil
 		}
 
-		if attempt < m.batchProcessor.maxRetries {
-			// Calculate exponential backoff delay
-			delay := time.Duration(attempt+1) * m.batchProcessor.retryDelay
-			log.Printf("Insert attempt %d failed, retrying in %v: %v", attempt+1, delay, err)
-
-			select {
-			case <-time.After(delay):
-			case <-ctx.Done():
-				return fmt.Errorf("retry cancelled: %w", ctx.Err())
+		mid := len(part) / 2
+		for _, half := range [][]ThreatRecord{part[:mid], part[mid:]} {
+			err := m.insertBatchWithRetry(ctx, half, m.spool == nil)
+			var rejection *RowRejectionError
+			switch {
+			case err == nil:
+				committed = append(committed, half...)
+			case errors.As(err, &rejection):
+				committed = append(committed, storedRecords(half, rejection.Rejected)...)
+				rejected = append(rejected, rejection.Rejected...)
+			case !classifyError(err).recordSpecific():
+				return err
+			default:
+				if err := bisect(half, err); err != nil {
+					return err
+				}
 			}
 		}
+		return nil
 	}
 
-	return fmt.Errorf("insert failed after %d attempts: %w", m.batchProcessor.maxRetries+1, lastErr)
+	if err := bisect(threats, cause); err != nil {
+		return committed, nil, err
+	}
+	return committed, rejected, nil
 }
 
-// isRetryableError determines if an error is retryable
-func (m *MigrationTool) isRetryableError(err error) bool {
-	if err == nil {
-		return false
+// uncommittedRecords returns threats and their source documents without the committed records.
+// docs may be nil.
+func uncommittedRecords(threats []ThreatRecord, docs []ThreatDocument, committed []ThreatRecord) ([]ThreatRecord, []ThreatDocument) {
+	committedIDs := make(map[uuid.UUID]bool, len(committed))
+	for _, threat := range committed {
+		committedIDs[threat.ID] = true
 	}
+	var restThreats []ThreatRecord
+	var restDocs []ThreatDocument
+	for i, threat := range threats {
+		if committedIDs[threat.ID] {
+			continue
+		}
+		restThreats = append(restThreats, threat)
+		if docs != nil {
+			restDocs = append(restDocs, docs[i])
+		}
+	}
+	return restThreats, restDocs
+}
 
-	errStr := err.Error()
-
-	// Network-related errors are typically retryable
-	retryablePatterns := []string{
-		"connection refused",
-		"connection reset",
-		"timeout",
-		"temporary failure",
-		"network is unreachable",
-		"no such host",
-		"connection timed out",
-		"i/o timeout",
-		"broken pipe",
-		"connection lost",
-		"server closed the connection",
-		"deadlock detected",
-		"lock wait timeout",
-		"too many connections",
+// rejectRecords sends records the database refused down the error path: each is logged as a
+// DatabaseError and its source document dead-lettered. It reports whether the dead letters were stored.
+// docs holds the source document of each record of threats, or is nil when they are unknown.
+func (m *MigrationTool) rejectRecords(ctx context.Context, rejected []RejectedRow, threats []ThreatRecord, docs []ThreatDocument, result *MigrationResult) bool {
+	docByID := make(map[uuid.UUID]ThreatDocument, len(docs))
+	for i, doc := range docs {
+		docByID[threats[i].ID] = doc
 	}
 
-	for _, pattern := range retryablePatterns {
-		if contains(errStr, pattern) {
-			return true
+	var deadLetters []DeadLetter
+	for _, row := range rejected {
+		doc, ok := docByID[row.ID]
+		documentID := row.ID.String()
+		if ok {
+			documentID = doc.SourceIDString()
+		}
+		migErr := MigrationError{
+			Type:       DatabaseError,
+			DocumentID: documentID,
+			Message:    row.Reason,
+			Timestamp:  time.Now(),
+			Retryable:  false,
+		}
+		m.errorLogger.LogError(migErr)
+		result.Errors = append(result.Errors, migErr)
+		result.ErrorCount++
+		if ok {
+			deadLetters = append(deadLetters, NewDeadLetter(doc, migErr))
 		}
 	}
 
-	return false
+	if m.deadLetters == nil || len(deadLetters) == 0 {
+		return true
+	}
+	if err := m.deadLetters.Write(ctx, deadLetters); err != nil {
+		result.Errors = append(result.Errors, fmt.Errorf("failed to store %d rejected records: %w", len(deadLetters), err))
+		return false
+	}
+	return true
+}
+
+// insertBatchWithRetry attempts to insert a batch, retrying under the policy of each error's class.
+// With waitForRecovery, failures while the circuit breaker is open do not use up attempts: the
+// retry waits for the breaker to close instead. Without it, an open breaker fails the insert
+// with errWritesPaused so the batch can be spooled.
+func (m *MigrationTool) insertBatchWithRetry(ctx context.Context, threats []ThreatRecord, waitForRecovery bool) error {
+	for attempt := 0; ; {
+		if !waitForRecovery && m.breaker.State() == CircuitOpen {
+			return errWritesPaused
+		}
+		if !m.breaker.Wait(ctx) {
+			return fmt.Errorf("insert cancelled: %w", ctx.Err())
+		}
+
+		err := m.events.InsertThreatBatch(threats)
+		if err == nil {
+			return nil // Success
+		}
+
+		// Part of the batch is already committed, so it must not be retried
+		var rejection *RowRejectionError
+		if errors.As(err, &rejection) {
+			return err
+		}
+
+		class, policy := m.retryPolicy(err)
+		if class == ErrorClassNetwork && m.breaker.State() == CircuitOpen {
+			if !waitForRecovery {
+				return err
+			}
+			log.Printf("Insert failed while PostgreSQL writes are paused, waiting for the database to recover: %v", err)
+			continue
+		}
+		if policy.MaxAttempts == 0 {
+			return fmt.Errorf("non-retryable %s error: %w", class, err)
+		}
+		if attempt >= policy.MaxAttempts {
+			return fmt.Errorf("insert failed after %d attempts (%s error): %w", attempt+1, class, err)
+		}
+
+		delay := policy.Delay(attempt)
+		attempt++
+		log.Printf("Insert attempt %d failed with %s error, retrying in %v: %v", attempt, class, delay.Round(time.Millisecond), err)
+		m.metrics.Retry("insert")
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return fmt.Errorf("retry cancelled: %w", ctx.Err())
+		}
+	}
 }
 
 // shouldRetryBatch determines if an entire batch should be retried
@@ -539,27 +1048,8 @@ func (m *MigrationTool) shouldRetryBatch(err error, currentRetryCount int) bool
 	return m.isRetryableError(err)
 }
 
-// contains checks if a string contains a substring (case-insensitive)
-func contains(s, substr string) bool {
-	return len(s) >= len(substr) &&
-		(s == substr ||
-			len(s) > len(substr) &&
-				(s[:len(substr)] == substr ||
-					s[len(s)-len(substr):] == substr ||
-					containsSubstring(s, substr)))
-}
-
-func containsSubstring(s, substr string) bool {
-	for i := 0; i <= len(s)-len(substr); i++ {
-		if s[i:i+len(substr)] == substr {
-			return true
-		}
-	}
-	return false
-}
-
-// processResults processes migration results
-func (m *MigrationTool) processResults(ctx context.Context, resultChan <-chan MigrationResult, progressTracker *ProgressTracker) {
+// processResults processes migration results and advances the checkpoint over committed batches
+func (m *MigrationTool) processResults(ctx context.Context, resultChan <-chan MigrationResult, progressTracker *ProgressTracker, checkpoint *CheckpointTracker) {
 	for {
 		select {
 		case result, ok := <-resultChan:
@@ -570,6 +1060,15 @@ func (m *MigrationTool) processResults(ctx context.Context, resultChan <-chan Mi
 			progressTracker.IncrementProcessed(result.ProcessedCount)
 			progressTracker.IncrementErrors(result.ErrorCount)
 
+			if result.Committed {
+				checkpoint.SetRulesVersion(result.RulesVersion)
+				if err := checkpoint.Complete(ctx, result.Position); err != nil {
+					log.Printf("Warning: failed to save checkpoint: %v", err)
+				}
+			} else {
+				checkpoint.Fail(result.Position)
+			}
+
 			// Log errors
 			for _, err := range result.Errors {
 				log.Printf("Migration error: %v", err)
@@ -634,8 +1133,11 @@ func (m *MigrationTool) generateMigrationSummary(progressTracker *ProgressTracke
 	log.Println(strings.Repeat("=", 80))
 
 	// Overall statistics
-	successRate := float64(processed) / float64(total) * 100
-	errorRate := float64(errors) / float64(total) * 100
+	successRate, errorRate := 0.0, 0.0
+	if total > 0 {
+		successRate = float64(processed) / float64(total) * 100
+		errorRate = float64(errors) / float64(total) * 100
+	}
 	avgRate := float64(processed) / elapsed.Seconds()
 
 	log.Printf("Total Documents: %d", total)
@@ -643,6 +1145,7 @@ func (m *MigrationTool) generateMigrationSummary(progressTracker *ProgressTracke
 	log.Printf("Failed Documents: %d (%.2f%%)", errors, errorRate)
 	log.Printf("Total Elapsed Time: %v", elapsed.Round(time.Second))
 	log.Printf("Average Processing Rate: %.1f docs/sec", avgRate)
+	log.Printf("Normalization Rules: %s", m.rules.Version())
 
 	// Error breakdown
 	if errors > 0 {
@@ -655,6 +1158,13 @@ func (m *MigrationTool) generateMigrationSummary(progressTracker *ProgressTracke
 	}
 
 	// Performance metrics
+	if coercions := documentCoercions.Summary(); len(coercions) > 0 {
+		log.Println("\nCOERCED FIELD VALUES:")
+		for _, line := range coercions {
+			log.Printf("  %s", line)
+		}
+	}
+
 	log.Println("\nPERFORMANCE METRICS:")
 	log.Printf("  Worker Count: %d", m.config.Migration.WorkerCount)
 	log.Printf("  Batch Size: %d", m.config.Migration.BatchSize)
@@ -680,10 +1190,12 @@ func (m *MigrationTool) HealthCheck(ctx context.Context) error {
 	log.Println("Performing health check...")
 
 	// Check MongoDB connection
-	if err := m.mongoClient.client.Ping(ctx, nil); err != nil {
-		return fmt.Errorf("MongoDB health check failed: %w", err)
+	if m.mongoClient != nil {
+		if err := m.mongoClient.client.Ping(ctx, nil); err != nil {
+			return fmt.Errorf("MongoDB health check failed: %w", err)
+		}
+		log.Println("✅ MongoDB connection healthy")
 	}
-	log.Println("✅ MongoDB connection healthy")
 
 	// Check PostgreSQL connection
 	if err := m.postgresClient.db.PingContext(ctx); err != nil {
@@ -692,96 +1204,26 @@ func (m *MigrationTool) HealthCheck(ctx context.Context) error {
 	log.Println("✅ PostgreSQL connection healthy")
 
 	// Check document count
-	count, err := m.mongoClient.GetTotalDocumentCount(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to get document count: %w", err)
-	}
-	log.Printf("✅ MongoDB document count: %d", count)
-
-	log.Println("Health check completed successfully")
-	return nil
-}
-
-func main() {
-	// Check for test flag
-	if len(os.Args) > 1 && os.Args[1] == "test" {
-		TestTransformation()
-		return
-	}
-
-	// Check for batch processing test flag
-	if len(os.Args) > 1 && os.Args[1] == "test-batch" {
-		TestBatchProcessing()
-		TestBatchProcessingWithSampleData()
-		return
-	}
-
-	// Check for UTF-8 sanitization test flag
-	if len(os.Args) > 1 && os.Args[1] == "test-utf8" {
-		TestUTF8Sanitization()
-		TestNormalizationWithSanitization()
-		return
-	}
-
-	// Check for aggressive sanitization test flag
-	if len(os.Args) > 1 && os.Args[1] == "test-aggressive" {
-		TestAggressiveSanitization()
-		return
-	}
-
-	// Check for health check flag
-	if len(os.Args) > 1 && os.Args[1] == "health" {
-		config, err := LoadConfig()
+	if m.mongoClient != nil {
+		count, err := m.mongoClient.GetTotalDocumentCount(ctx)
 		if err != nil {
-			log.Fatalf("Failed to load configuration: %v", err)
+			return fmt.Errorf("failed to get document count: %w", err)
 		}
-
-		migrationTool, err := NewMigrationTool(config)
+		log.Printf("✅ MongoDB document count: %d", count)
+	} else {
+		count, err := m.source.EstimatedCount(ctx)
 		if err != nil {
-			log.Fatalf("Failed to create migration tool: %v", err)
-		}
-		defer migrationTool.Close()
-
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-		defer cancel()
-
-		if err := migrationTool.HealthCheck(ctx); err != nil {
-			log.Fatalf("Health check failed: %v", err)
+			return fmt.Errorf("failed to read %s: %w", m.source.Name(), err)
 		}
-		return
+		log.Printf("✅ %s readable, about %d documents", m.source.Name(), count)
 	}
 
-	// Load configuration
-	config, err := LoadConfig()
-	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
-	}
-
-	// Create migration tool
-	migrationTool, err := NewMigrationTool(config)
-	if err != nil {
-		log.Fatalf("Failed to create migration tool: %v", err)
-	}
-	defer migrationTool.Close()
-
-	// Set up context with cancellation for graceful shutdown
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	// Handle interrupt signals for graceful shutdown
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-
-	go func() {
-		<-sigChan
-		log.Println("Received interrupt signal, shutting down gracefully...")
-		cancel()
-	}()
+	log.Println("Health check completed successfully")
+	return nil
+}
 
-	// Start migration
-	if err := migrationTool.Migrate(ctx); err != nil {
-		log.Fatalf("Migration failed: %v", err)
+func main() {
+	if err := Execute(os.Args[1:]); err != nil {
+		log.Fatalf("%v", err)
 	}
-
-	log.Println("Migration completed successfully!")
 }
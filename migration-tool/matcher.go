@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Match kinds, from the most to the least certain
+const (
+	MatchAlias   = "alias"   // the whole value is an alias
+	MatchPattern = "pattern" // a regular expression matched
+	MatchTerm    = "term"    // a word or phrase matched on word boundaries
+	MatchFuzzy   = "fuzzy"   // the value is close to an alias or term
+	MatchPort    = "port"    // inferred from a port through the service-name registry
+	MatchDefault = "default" // nothing matched, the field's default was used
+	MatchNone    = "none"    // nothing matched, the built-in fallback was used
+)
+
+// RuleMatch is the outcome of matching a value against a rule table. Confidence is 1 for an
+// exact alias, the share of the value covered by the match for patterns and terms, the
+// similarity for fuzzy matches, 0.5 for a service inferred from a port, and 0 when nothing
+// matched.
+type RuleMatch struct {
+	Value      string
+	Kind       string
+	Rule       string // alias, pattern or term that matched
+	Confidence float64
+}
+
+// String renders the match for logs
+func (m RuleMatch) String() string {
+	if m.Rule == "" {
+		return fmt.Sprintf("%q (%s, confidence %.2f)", m.Value, m.Kind, m.Confidence)
+	}
+	return fmt.Sprintf("%q (%s %q, confidence %.2f)", m.Value, m.Kind, m.Rule, m.Confidence)
+}
+
+// token is a word of a value with its byte offsets
+type token struct {
+	text       string
+	start, end int
+}
+
+// isTokenRune reports whether r belongs to a word. '&' and '+' are kept so terms such as
+// "c&c" and "tacacs+" stay whole words.
+func isTokenRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '&' || r == '+'
+}
+
+// tokenize splits value into lowercased words
+func tokenize(value string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range value {
+		if isTokenRune(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			tokens = append(tokens, token{strings.ToLower(value[start:i]), start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{strings.ToLower(value[start:]), start, len(value)})
+	}
+	return tokens
+}
+
+// tokenChars returns the number of characters in tokens, the measure coverage is computed with
+func tokenChars(tokens []token) int {
+	chars := 0
+	for _, t := range tokens {
+		chars += len([]rune(t.text))
+	}
+	return chars
+}
+
+// termRule is a compiled term: its words and canonical value
+type termRule struct {
+	term  string
+	words []string
+	chars int
+	value string
+}
+
+// sortTerms orders terms by precedence: most words, then most characters, then alphabetically
+func sortTerms(terms []termRule) {
+	sort.Slice(terms, func(i, j int) bool {
+		a, b := terms[i], terms[j]
+		if len(a.words) != len(b.words) {
+			return len(a.words) > len(b.words)
+		}
+		if a.chars != b.chars {
+			return a.chars > b.chars
+		}
+		return a.term < b.term
+	})
+}
+
+// matchTerms returns the highest-precedence term found on word boundaries in tokens. Terms
+// are sorted by precedence, so the first term that occurs wins; among occurrences of terms of
+// equal precedence the leftmost wins.
+func matchTerms(terms []termRule, tokens []token) (termRule, bool) {
+	best, bestStart, found := termRule{}, 0, false
+	for _, term := range terms {
+		if found && (len(term.words) != len(best.words) || term.chars != best.chars) {
+			break // Every remaining term has lower precedence
+		}
+		if start, ok := findWords(tokens, term.words); ok && (!found || start < bestStart) {
+			best, bestStart, found = term, start, true
+		}
+	}
+	return best, found
+}
+
+// findWords returns the index of the first run of tokens equal to words
+func findWords(tokens []token, words []string) (int, bool) {
+	for i := 0; i+len(words) <= len(tokens); i++ {
+		matched := true
+		for j, word := range words {
+			if tokens[i+j].text != word {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// fuzzyCandidate is an alias or term a value can be fuzzily matched to
+type fuzzyCandidate struct {
+	key   string // lowercased, words separated by single spaces
+	value string
+}
+
+// matchFuzzy compares the value, and each of its words, to the candidates and returns the most
+// similar one if it reaches threshold. A single word's similarity is scaled by the share of the
+// value it covers. Ties go to the earlier candidate, which is the higher-precedence one.
+func matchFuzzy(candidates []fuzzyCandidate, tokens []token, threshold float64) (fuzzyCandidate, float64, bool) {
+	if threshold <= 0 || len(tokens) == 0 {
+		return fuzzyCandidate{}, 0, false
+	}
+
+	words := make([]string, len(tokens))
+	for i, t := range tokens {
+		words[i] = t.text
+	}
+	whole := strings.Join(words, " ")
+	total := float64(tokenChars(tokens))
+
+	var best fuzzyCandidate
+	bestScore := 0.0
+	for _, candidate := range candidates {
+		score := similarity(whole, candidate.key)
+		if len(tokens) > 1 && !strings.Contains(candidate.key, " ") {
+			for _, t := range tokens {
+				if s := similarity(t.text, candidate.key); s >= threshold {
+					score = math.Max(score, s*float64(len([]rune(t.text)))/total)
+				}
+			}
+		}
+		if score > bestScore {
+			best, bestScore = candidate, score
+		}
+	}
+	if bestScore < threshold {
+		return fuzzyCandidate{}, 0, false
+	}
+	return best, bestScore, true
+}
+
+// similarity is 1 minus the Levenshtein distance of a and b relative to the longer of them
+func similarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+// levenshtein returns the edit distance between a and b
+func levenshtein(a, b []rune) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(min(previous[j]+1, current[j-1]+1), previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
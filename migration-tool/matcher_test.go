@@ -0,0 +1,124 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// testRuleTable compiles a category table exercising every stage of the matcher
+func testRuleTable(t *testing.T, fuzzy float64) *ruleTable {
+	t.Helper()
+	table, err := compileRuleTable("category", RuleTable{
+		Aliases: map[string]string{"c2": "c2", "phishing": "phishing-alias", "ransomware": "ransomware"},
+		Patterns: []PatternRule{
+			{Match: `phish\w*`, Value: "phishing"},
+			{Match: `^(\w+)\.gen$`, Value: "$1"},
+		},
+		Terms: map[string]string{
+			"command and control": "c2",
+			"c&c":                 "c2",
+			"botnet":              "botnet",
+			"scan":                "scanner",
+			"exploit":             "exploit",
+			"spam":                "spam",
+			"worm":                "worm",
+		},
+		Fuzzy:   fuzzy,
+		Default: "other",
+	})
+	if err != nil {
+		t.Fatalf("compileRuleTable: %v", err)
+	}
+	return table
+}
+
+func TestRuleTableResolve(t *testing.T) {
+	table := testRuleTable(t, 0.8)
+
+	tests := []struct {
+		name       string
+		value      string
+		want       string
+		kind       string
+		rule       string
+		confidence float64
+	}{
+		// Precedence: aliases, then patterns in order, then terms, then fuzzy
+		{"alias", "c2", "c2", MatchAlias, "c2", 1},
+		{"alias ignores case", "PHISHING", "phishing-alias", MatchAlias, "PHISHING", 1},
+		{"pattern before terms", "phishing botnet", "phishing", MatchPattern, `phish\w*`, 8.0 / 14},
+		{"pattern capture group", "trojan.gen", "trojan", MatchPattern, `^(\w+)\.gen$`, 1},
+		{"more words first", "botnet command and control", "c2", MatchTerm, "command and control", 17.0 / 23},
+		{"longer term first", "scan exploit", "exploit", MatchTerm, "exploit", 7.0 / 11},
+		{"leftmost of equal terms", "worm spam", "worm", MatchTerm, "worm", 0.5},
+		{"leftmost of equal terms reversed", "spam worm", "spam", MatchTerm, "spam", 0.5},
+		{"term before fuzzy", "botnett scan", "scanner", MatchTerm, "scan", 4.0 / 11},
+
+		// Terms only match whole words
+		{"term on word boundary", "port-scan", "scanner", MatchTerm, "scan", 0.5},
+		{"term keeps ampersand", "C&C server", "c2", MatchTerm, "c&c", 3.0 / 9},
+		{"term inside a word", "scanner", "", "", "", 0},
+		{"term split across words", "c & c", "", "", "", 0},
+
+		// Fuzzy fallback against terms and aliases
+		{"fuzzy above threshold", "botnett", "botnet", MatchFuzzy, "botnet", 1 - 1.0/7},
+		{"fuzzy at threshold", "wormy", "worm", MatchFuzzy, "worm", 0.8},
+		{"fuzzy below threshold", "botnte", "", "", "", 0},
+		{"fuzzy word scaled by coverage", "botnett traffic", "", "", "", 0},
+		{"fuzzy to alias", "ransomwar", "ransomware", MatchFuzzy, "ransomware", 0.9},
+		{"empty value", "", "", "", "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := table.match(tt.value)
+			if ok != (tt.kind != "") {
+				t.Fatalf("match(%q) ok = %v, want %v (got %s)", tt.value, ok, tt.kind != "", got)
+			}
+			if got.Value != tt.want || got.Kind != tt.kind || got.Rule != tt.rule {
+				t.Errorf("match(%q) = %s, want %q (%s %q)", tt.value, got, tt.want, tt.kind, tt.rule)
+			}
+			if math.Abs(got.Confidence-tt.confidence) > 1e-9 {
+				t.Errorf("match(%q) confidence = %v, want %v", tt.value, got.Confidence, tt.confidence)
+			}
+		})
+	}
+}
+
+func TestRuleTableFuzzyDisabled(t *testing.T) {
+	table := testRuleTable(t, 0)
+	if got, ok := table.match("botnett"); ok {
+		t.Errorf("match(%q) = %s with fuzzy matching disabled", "botnett", got)
+	}
+	if got := table.fallback("unknown"); got.Value != "other" || got.Kind != MatchDefault || got.Confidence != 0 {
+		t.Errorf("fallback = %s, want the default", got)
+	}
+}
+
+func TestRuleTableFallbackWithoutDefault(t *testing.T) {
+	table, err := compileRuleTable("category", RuleTable{})
+	if err != nil {
+		t.Fatalf("compileRuleTable: %v", err)
+	}
+	if got := table.fallback("unknown"); got.Value != "unknown" || got.Kind != MatchNone {
+		t.Errorf("fallback = %s, want the built-in value", got)
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"botnet", "botnet", 1},
+		{"botnett", "botnet", 1 - 1.0/7},
+		{"botnte", "botnet", 1 - 2.0/6},
+		{"", "", 1},
+		{"", "scan", 0},
+		{"ünï", "uni", 1 - 2.0/3}, // compared by rune, not byte
+	}
+	for _, tt := range tests {
+		if got := similarity(tt.a, tt.b); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("similarity(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Insert methods used as the "method" label
+const (
+	insertMethodCopy = "copy"
+	insertMethodRows = "rows"
+)
+
+// Metrics holds the Prometheus instrumentation of the pipeline. All methods are safe to call
+// on a nil *Metrics, so components built without metrics (tests, ad-hoc clients) need no checks.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	documentsRead        prometheus.Counter
+	documentsTransformed prometheus.Counter
+	documentsInserted    prometheus.Counter
+	batchDuration        prometheus.Histogram
+	insertDuration       *prometheus.HistogramVec
+	insertBatches        *prometheus.CounterVec
+	insertRows           *prometheus.CounterVec
+	copyFallbacks        prometheus.Counter
+	retries              *prometheus.CounterVec
+	lookupCache          *prometheus.CounterVec
+
+	// Sources read at scrape time
+	mu              sync.RWMutex
+	progressTracker *ProgressTracker
+	errorLogger     *ErrorLogger
+}
+
+// NewMetrics creates the pipeline metrics in a dedicated registry
+func NewMetrics() *Metrics {
+	batchBuckets := prometheus.ExponentialBuckets(0.05, 2, 14) // 50ms .. ~7min
+
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		documentsRead: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "migration_documents_read_total",
+			Help: "Documents read from the source and handed to the workers.",
+		}),
+		documentsTransformed: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "migration_documents_transformed_total",
+			Help: "Documents that passed validation and transformation.",
+		}),
+		documentsInserted: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "migration_documents_inserted_total",
+			Help: "Records committed to ThreatEvents (including rows skipped as duplicates).",
+		}),
+		batchDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "migration_batch_duration_seconds",
+			Help:    "End-to-end processing time of a batch, including retries.",
+			Buckets: batchBuckets,
+		}),
+		insertDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "migration_insert_duration_seconds",
+			Help:    "Time spent writing a batch to ThreatEvents, by insert method.",
+			Buckets: batchBuckets,
+		}, []string{"method"}),
+		insertBatches: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "migration_insert_batches_total",
+			Help: "Batches written to ThreatEvents, by insert method.",
+		}, []string{"method"}),
+		insertRows: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "migration_insert_rows_total",
+			Help: "Rows written to ThreatEvents, by insert method.",
+		}, []string{"method"}),
+		copyFallbacks: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "migration_copy_fallbacks_total",
+			Help: "COPY attempts that failed and fell back to row inserts.",
+		}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "migration_retries_total",
+			Help: "Retries, by scope (insert attempts within a batch, or whole batches).",
+		}, []string{"scope"}),
+		lookupCache: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "migration_lookup_cache_requests_total",
+			Help: "Lookup cache requests, by lookup table and result (hit or miss).",
+		}, []string{"table", "result"}),
+	}
+
+	m.registry.MustRegister(
+		m.documentsRead,
+		m.documentsTransformed,
+		m.documentsInserted,
+		m.batchDuration,
+		m.insertDuration,
+		m.insertBatches,
+		m.insertRows,
+		m.copyFallbacks,
+		m.retries,
+		m.lookupCache,
+		&trackerCollector{metrics: m},
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// Register adds additional collectors to the metrics registry
+func (m *Metrics) Register(cs ...prometheus.Collector) {
+	if m == nil {
+		return
+	}
+	m.registry.MustRegister(cs...)
+}
+
+// Track makes the progress tracker and error logger of the current run visible at scrape time
+func (m *Metrics) Track(progressTracker *ProgressTracker, errorLogger *ErrorLogger) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.progressTracker = progressTracker
+	m.errorLogger = errorLogger
+}
+
+// DocumentsRead counts documents handed to the workers
+func (m *Metrics) DocumentsRead(n int) {
+	if m == nil {
+		return
+	}
+	m.documentsRead.Add(float64(n))
+}
+
+// DocumentsTransformed counts documents that transformed successfully
+func (m *Metrics) DocumentsTransformed(n int) {
+	if m == nil {
+		return
+	}
+	m.documentsTransformed.Add(float64(n))
+}
+
+// DocumentsInserted counts records committed to ThreatEvents
+func (m *Metrics) DocumentsInserted(n int) {
+	if m == nil {
+		return
+	}
+	m.documentsInserted.Add(float64(n))
+}
+
+// ObserveBatch records the end-to-end duration of a batch
+func (m *Metrics) ObserveBatch(d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.batchDuration.Observe(d.Seconds())
+}
+
+// ObserveInsert records a successful write of rows rows using method
+func (m *Metrics) ObserveInsert(method string, rows int, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.insertDuration.WithLabelValues(method).Observe(d.Seconds())
+	m.insertBatches.WithLabelValues(method).Inc()
+	m.insertRows.WithLabelValues(method).Add(float64(rows))
+}
+
+// CopyFallback counts a COPY that failed and fell back to row inserts
+func (m *Metrics) CopyFallback() {
+	if m == nil {
+		return
+	}
+	m.copyFallbacks.Inc()
+}
+
+// Retry counts a retry in scope ("insert" or "batch")
+func (m *Metrics) Retry(scope string) {
+	if m == nil {
+		return
+	}
+	m.retries.WithLabelValues(scope).Inc()
+}
+
+// LookupCache counts a lookup cache hit or miss for table
+func (m *Metrics) LookupCache(table string, hit bool) {
+	if m == nil {
+		return
+	}
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	m.lookupCache.WithLabelValues(table, result).Inc()
+}
+
+// Serve exposes the metrics in Prometheus text format on addr at /metrics. The returned
+// function shuts the listener down.
+func (m *Metrics) Serve(addr string) (func(), error) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	listenErr := make(chan error, 1)
+	go func() {
+		listenErr <- server.ListenAndServe()
+	}()
+
+	// Surface an immediate bind failure instead of failing silently in the background
+	select {
+	case err := <-listenErr:
+		return nil, fmt.Errorf("failed to start metrics listener on %s: %w", addr, err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	log.Printf("📈 Serving Prometheus metrics on http://%s/metrics", addr)
+
+	go func() {
+		if err := <-listenErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Metrics listener stopped: %v", err)
+		}
+	}()
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(ctx)
+	}, nil
+}
+
+// trackerCollector exports the ProgressTracker and ErrorLogger values at scrape time
+type trackerCollector struct {
+	metrics *Metrics
+}
+
+var (
+	progressTotalDesc = prometheus.NewDesc("migration_progress_documents_total",
+		"Documents the current run expects to process.", nil, nil)
+	progressProcessedDesc = prometheus.NewDesc("migration_progress_processed_documents",
+		"Documents successfully processed by the current run.", nil, nil)
+	progressErrorsDesc = prometheus.NewDesc("migration_progress_error_documents",
+		"Documents that failed in the current run.", nil, nil)
+	progressElapsedDesc = prometheus.NewDesc("migration_progress_elapsed_seconds",
+		"Time since the current run started.", nil, nil)
+	errorsByTypeDesc = prometheus.NewDesc("migration_errors_total",
+		"Errors logged by the error logger, by error type.", []string{"type"}, nil)
+)
+
+func (c *trackerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- progressTotalDesc
+	ch <- progressProcessedDesc
+	ch <- progressErrorsDesc
+	ch <- progressElapsedDesc
+	ch <- errorsByTypeDesc
+}
+
+func (c *trackerCollector) Collect(ch chan<- prometheus.Metric) {
+	c.metrics.mu.RLock()
+	progressTracker, errorLogger := c.metrics.progressTracker, c.metrics.errorLogger
+	c.metrics.mu.RUnlock()
+
+	if progressTracker != nil {
+		processed, total, errors, elapsed := progressTracker.GetProgress()
+		ch <- prometheus.MustNewConstMetric(progressTotalDesc, prometheus.GaugeValue, float64(total))
+		ch <- prometheus.MustNewConstMetric(progressProcessedDesc, prometheus.GaugeValue, float64(processed))
+		ch <- prometheus.MustNewConstMetric(progressErrorsDesc, prometheus.GaugeValue, float64(errors))
+		ch <- prometheus.MustNewConstMetric(progressElapsedDesc, prometheus.GaugeValue, elapsed.Seconds())
+	}
+
+	if errorLogger != nil {
+		summary := errorLogger.GetErrorSummary()
+		for _, errorType := range []ErrorType{ValidationError, TransformationError, DatabaseError, NetworkError, UnknownError} {
+			ch <- prometheus.MustNewConstMetric(errorsByTypeDesc, prometheus.CounterValue,
+				float64(summary[errorType]), errorType.String())
+		}
+	}
+}
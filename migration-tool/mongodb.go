@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -24,6 +25,13 @@ type ThreatDocument struct {
 	SourceCountry       string             `bson:"source_country"`
 	CreatedAt           time.Time          `bson:"created_at,omitempty"`
 	UpdatedAt           time.Time          `bson:"updated_at,omitempty"`
+
+	// Raw holds the original BSON when the document was read from MongoDB or an export file, for dead-lettering
+	Raw bson.Raw `bson:"-"`
+	// SourceID holds the original _id when it is not an ObjectID; ID is then derived from it
+	SourceID bson.RawValue `bson:"-"`
+	// DecodeErr is set when a field could not be coerced; only ID, SourceID and Raw are decoded then
+	DecodeErr error `bson:"-"`
 }
 
 // OptionalInfo represents the optional information embedded in MongoDB documents
@@ -73,8 +81,11 @@ func NewMongoDBClient(config MongoConfig) (*MongoDBClient, error) {
 	}, nil
 }
 
-// Close closes the MongoDB connection
+// Close closes the MongoDB connection; it does nothing on a nil client
 func (m *MongoDBClient) Close(ctx context.Context) error {
+	if m == nil {
+		return nil
+	}
 	return m.client.Disconnect(ctx)
 }
 
@@ -100,15 +111,24 @@ func (m *MongoDBClient) getExactDocumentCount(ctx context.Context) (int64, error
 	return count, nil
 }
 
-// ReadDocumentsBatch reads documents in batches from MongoDB
-func (m *MongoDBClient) ReadDocumentsBatch(ctx context.Context, batchSize int, skip int64) ([]ThreatDocument, error) {
+// ReadDocumentsBatch reads the next batch of documents ordered by _id, starting
+// strictly after the _id after. A zero after starts from the beginning of the collection.
+// Paging on the _id index keeps the cost of each read flat regardless of how far
+// into the collection we are, unlike skip-based pagination.
+func (m *MongoDBClient) ReadDocumentsBatch(ctx context.Context, batchSize int, after bson.RawValue) ([]ThreatDocument, error) {
 	// No filter needed since there's no deleted_at field in the collection
 	filter := bson.M{}
-
 	options := options.Find().
 		SetLimit(int64(batchSize)).
-		SetSkip(skip).
-		SetSort(bson.D{{Key: "_id", Value: 1}}) // Sort by _id for consistent pagination
+		SetSort(bson.D{{Key: "_id", Value: 1}}). // Sort by _id for keyset pagination
+		SetHint(bson.D{{Key: "_id", Value: 1}})
+
+	if after.Type != 0 {
+		// A comparison on _id only matches values of the same type, so {$gt: after} would stop at
+		// the last ObjectID, number or string; an inclusive index bound follows the BSON order
+		// across types as the sort does. The document at the bound itself is dropped below.
+		options.SetMin(bson.D{{Key: "_id", Value: after}}).SetLimit(int64(batchSize) + 1)
+	}
 
 	cursor, err := m.collection.Find(ctx, filter, options)
 	if err != nil {
@@ -116,19 +136,29 @@ func (m *MongoDBClient) ReadDocumentsBatch(ctx context.Context, batchSize int, s
 	}
 	defer cursor.Close(ctx)
 
-	var documents []ThreatDocument
+	documents := make([]ThreatDocument, 0, batchSize)
 	for cursor.Next(ctx) {
+		if after.Type != 0 && cursor.Current.Lookup("_id").Equal(after) {
+			continue
+		}
 		var doc ThreatDocument
 		if err := cursor.Decode(&doc); err != nil {
 			log.Printf("Warning: failed to decode document: %v", err)
-			continue // Skip malformed documents
+			continue // Skip documents that are not valid BSON
 		}
+		if doc.DecodeErr != nil {
+			log.Printf("Warning: failed to decode document %s: %v", doc.SourceIDString(), doc.DecodeErr)
+		}
+		doc.Raw = append(bson.Raw(nil), cursor.Current...) // cursor.Current is reused by the next call
 		documents = append(documents, doc)
 	}
 
 	if err := cursor.Err(); err != nil {
 		return nil, fmt.Errorf("cursor error: %w", err)
 	}
+	if len(documents) > batchSize {
+		documents = documents[:batchSize]
+	}
 
 	return documents, nil
 }
@@ -144,56 +174,98 @@ func (m *MongoDBClient) ReadAllDocuments(ctx context.Context, batchSize int, doc
 
 	log.Printf("Starting migration of %d documents from MongoDB", totalCount)
 
-	var skip int64 = 0
-	var consecutiveEmptyBatches = 0
+	var lastID bson.RawValue
+	var readCount int64
 
-	for skip < totalCount {
+	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
 		}
 
-		batch, err := m.ReadDocumentsBatch(ctx, batchSize, skip)
+		batch, err := m.ReadDocumentsBatch(ctx, batchSize, lastID)
 		if err != nil {
-			return fmt.Errorf("failed to read batch at skip %d: %w", skip, err)
+			return fmt.Errorf("failed to read batch after _id %s: %w", mongoPosition(lastID), err)
 		}
 
 		if len(batch) == 0 {
-			consecutiveEmptyBatches++
-			// Only break if we get multiple consecutive empty batches
-			// This handles cases where there might be gaps in the data
-			if consecutiveEmptyBatches >= 3 {
-				log.Printf("Stopping after %d consecutive empty batches at skip %d", consecutiveEmptyBatches, skip)
-				break
-			}
-			// Skip ahead to try to find more documents
-			skip += int64(batchSize)
-			continue
+			break
 		}
 
-		// Reset empty batch counter when we find documents
-		consecutiveEmptyBatches = 0
-
 		select {
 		case documentChan <- batch:
 		case <-ctx.Done():
 			return ctx.Err()
 		}
 
-		skip += int64(len(batch))
+		lastID = batch[len(batch)-1].SourceIDValue()
+		readCount += int64(len(batch))
 
 		// Log progress
-		progress := float64(skip) / float64(totalCount) * 100
-		log.Printf("Read progress: %.2f%% (%d/%d documents)", progress, skip, totalCount)
+		progress := float64(readCount) / float64(totalCount) * 100
+		log.Printf("Read progress: %.2f%% (%d/%d documents), Last _id: %s", progress, readCount, totalCount, mongoPosition(lastID))
 	}
 
-	log.Printf("Finished reading %d documents from MongoDB", skip)
+	log.Printf("Finished reading %d documents from MongoDB", readCount)
 	return nil
 }
 
+// CountDocumentsUpTo returns the number of documents with _id <= lastID. It is
+// used to seed progress reporting when resuming and only walks the _id index.
+func (m *MongoDBClient) CountDocumentsUpTo(ctx context.Context, lastID bson.RawValue) (int64, error) {
+	if lastID.Type == 0 {
+		return 0, nil
+	}
+
+	countCtx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+
+	filter := bson.M{"_id": bson.M{"$lte": lastID}}
+	if lastID.Type != bsontype.ObjectID {
+		// $expr compares across types in BSON order, like ReadDocumentsBatch's index bound
+		filter = bson.M{"$expr": bson.M{"$lte": bson.A{"$_id", lastID}}}
+	}
+	count, err := m.collection.CountDocuments(countCtx, filter,
+		options.Count().SetHint(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return 0, fmt.Errorf("failed to count documents up to %s: %w", mongoPosition(lastID), err)
+	}
+
+	return count, nil
+}
+
+// RawBSON returns the document's original BSON, or re-encodes it if it was not read from MongoDB
+func (d *ThreatDocument) RawBSON() (bson.Raw, error) {
+	if len(d.Raw) > 0 {
+		return d.Raw, nil
+	}
+	return bson.Marshal(d)
+}
+
+// SourceIDValue returns the _id of the document as stored in the source
+func (d *ThreatDocument) SourceIDValue() bson.RawValue {
+	if d.SourceID.Type != 0 {
+		return d.SourceID
+	}
+	return bson.RawValue{Type: bsontype.ObjectID, Value: append([]byte(nil), d.ID[:]...)}
+}
+
+// SourceIDString returns the _id of the document as stored in the source, in hex for ObjectIDs
+// and in extended JSON otherwise
+func (d *ThreatDocument) SourceIDString() string {
+	if d.SourceID.Type != 0 {
+		return d.SourceID.String()
+	}
+	return d.ID.Hex()
+}
+
 // ValidateDocument performs basic validation on a threat document
 func (d *ThreatDocument) ValidateDocument() error {
+	if d.DecodeErr != nil {
+		return fmt.Errorf("document could not be decoded: %w", d.DecodeErr)
+	}
+
 	if d.ID.IsZero() {
 		return fmt.Errorf("document ID is empty")
 	}
@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"log"
 	"net"
-	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -15,6 +14,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/lib/pq"
 	_ "github.com/lib/pq"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // PostgreSQLClient wraps PostgreSQL operations
@@ -25,49 +25,141 @@ type PostgreSQLClient struct {
 	// Removed per-table prepared insert statements except for ThreatEvents
 	insertThreatStmt *sql.Stmt
 
-	asnCache           map[string]uuid.UUID
-	countryCache       map[string]uuid.UUID
-	protocolCache      map[string]uuid.UUID
-	malwareFamilyCache map[string]uuid.UUID
+	asnCache                 *LookupCache
+	countryCache             *LookupCache
+	protocolCache            *LookupCache
+	applicationProtocolCache *LookupCache
+	malwareFamilyCache       *LookupCache
+	refreshCancel            context.CancelFunc // stops the periodic lookup cache refresh
 
 	useCopy       bool
-	copyThreshold int
-	adaptiveCopy  bool
-	copyMin       int
-	copyMax       int
+	copyThreshold int                 // static COPY threshold, used without an adaptive controller
+	copyTempTable string              // UNLOGGED staging table for COPY + merge (direct COPY if empty)
+	adaptive      *AdaptiveController // tunes the COPY threshold when adaptive COPY is enabled
+	breaker       *CircuitBreaker     // pauses writers while the database is unreachable (nil when disabled)
+	rules         *RuleStore          // normalization rules (built-in rules when nil)
+	services      *ServiceRegistry    // service names inferred from ports (built-in registry when nil)
+
+	inflight      map[string]*lookupCall // lookup values being resolved, by table and value
+	inflightMutex sync.Mutex
+
+	// Instrumentation (nil-safe)
+	metrics *Metrics
+}
+
+// threatEventNamespace is the UUIDv5 namespace for ThreatEvents IDs derived from MongoDB ObjectIDs.
+// It must never change, otherwise re-migrated documents would no longer collide with existing rows.
+var threatEventNamespace = uuid.MustParse("5b7e2f4c-8a1d-4c3e-9f60-2d4b7a9c1e83")
 
-	cacheMutex sync.RWMutex
+// ThreatEventID returns the deterministic ThreatEvents ID for a MongoDB document
+func ThreatEventID(objectID primitive.ObjectID) uuid.UUID {
+	return uuid.NewSHA1(threatEventNamespace, []byte(objectID.Hex()))
 }
 
-// MigrationProgress represents the current migration state
-type MigrationProgress struct {
-	LastProcessedID string    `json:"last_processed_id"`
-	ProcessedCount  int64     `json:"processed_count"`
-	TotalCount      int64     `json:"total_count"`
-	StartTime       time.Time `json:"start_time"`
-	LastUpdateTime  time.Time `json:"last_update_time"`
+// threatEventColumns lists the ThreatEvents columns written by the migration, in insert order
+var threatEventColumns = []string{
+	"Id", "Timestamp", "AsnRegistryId", "SourceAddress", "SourceCountryId",
+	"DestinationAddress", "DestinationCountryId", "SourcePort", "DestinationPort",
+	"ProtocolId", "Category", "MalwareFamilyId", "CreatedAt", "UpdatedAt", "ApplicationProtocolId",
 }
 
+// threatEventsUpsert is the conflict clause of every ThreatEvents insert, whether by row, COPY or
+// staging table: a record migrated again overwrites everything but the key and CreatedAt, and
+// rows whose data did not change are left alone
+var threatEventsUpsert = func() string {
+	var updates, current, incoming []string
+	for _, column := range threatEventColumns {
+		switch column {
+		case "Id", "Timestamp", "CreatedAt":
+			continue
+		}
+		quoted := quoteIdentifier(column)
+		updates = append(updates, quoted+" = EXCLUDED."+quoted)
+		if column != "UpdatedAt" {
+			current = append(current, `"ThreatEvents".`+quoted)
+			incoming = append(incoming, "EXCLUDED."+quoted)
+		}
+	}
+	return fmt.Sprintf(`ON CONFLICT ("Id", "Timestamp") DO UPDATE SET %s WHERE (%s) IS DISTINCT FROM (%s)`,
+		strings.Join(updates, ", "), strings.Join(current, ", "), strings.Join(incoming, ", "))
+}()
+
 // ThreatRecord represents the normalized threat intelligence record for PostgreSQL
 type ThreatRecord struct {
-	ID                   uuid.UUID
-	Timestamp            time.Time
-	AsnRegistryID        uuid.UUID
-	SourceAddress        net.IP
-	SourceCountryID      *uuid.UUID
-	DestinationAddress   *net.IP
-	DestinationCountryID *uuid.UUID
-	SourcePort           *int
-	DestinationPort      *int
-	ProtocolID           *uuid.UUID
-	Category             string
-	MalwareFamilyID      *uuid.UUID
-	CreatedAt            time.Time
-	UpdatedAt            time.Time
+	ID                    uuid.UUID
+	Timestamp             time.Time
+	AsnRegistryID         uuid.UUID
+	SourceAddress         net.IP
+	SourceCountryID       *uuid.UUID
+	DestinationAddress    *net.IP
+	DestinationCountryID  *uuid.UUID
+	SourcePort            *int
+	DestinationPort       *int
+	ProtocolID            *uuid.UUID
+	Category              string
+	MalwareFamilyID       *uuid.UUID
+	CreatedAt             time.Time
+	UpdatedAt             time.Time
+	ApplicationProtocolID *uuid.UUID
 }
 
-// NewPostgreSQLClient creates a new PostgreSQL client
+// NewPostgreSQLClient creates a new PostgreSQL client ready to migrate: it checks the schema,
+// prepares the insert statements, creates the staging table, fixes country names and loads the
+// lookup caches
 func NewPostgreSQLClient(config PostgreSQLConfig, migrationConfig MigrationConfig) (*PostgreSQLClient, error) {
+	client, err := ConnectPostgreSQL(config, migrationConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := client.checkSchema(); err != nil {
+		client.db.Close()
+		return nil, err
+	}
+
+	// Prepare statements
+	log.Println("Preparing SQL statements...")
+	if err := client.prepareStatements(); err != nil {
+		client.db.Close()
+		return nil, fmt.Errorf("failed to prepare statements: %w", err)
+	}
+	log.Println("SQL statements prepared successfully")
+
+	if client.copyTempTable != "" {
+		if err := client.ensureStagingTable(); err != nil {
+			client.db.Close()
+			return nil, err
+		}
+		log.Printf("COPY batches are staged in UNLOGGED table %s", client.copyTempTable)
+	}
+
+	if !migrationConfig.DryRun {
+		if fixed, err := client.fixCountryNames(context.Background()); err != nil {
+			log.Printf("Warning: Could not update country names (table may not exist): %v", err)
+		} else if fixed > 0 {
+			log.Printf("Updated %d country names from ISO 3166-1", fixed)
+		}
+	}
+
+	// Load existing lookup data into caches
+	log.Println("Loading lookup caches...")
+	client.loadLookupCaches(context.Background())
+	if migrationConfig.LookupCacheRefreshSeconds > 0 {
+		var refreshCtx context.Context
+		refreshCtx, client.refreshCancel = context.WithCancel(context.Background())
+		go client.refreshLookupCaches(refreshCtx, time.Duration(migrationConfig.LookupCacheRefreshSeconds)*time.Second)
+	}
+
+	log.Printf("Connected to PostgreSQL: %s:%d/%s", config.Host, config.Port, config.Database)
+
+	// Progress tracking is now based on existing record count in PostgreSQL
+
+	return client, nil
+}
+
+// ConnectPostgreSQL opens and pings a connection pool without writing anything: no DDL, no data
+// fixes and no prepared inserts. The commands that only read from the database use it directly.
+func ConnectPostgreSQL(config PostgreSQLConfig, migrationConfig MigrationConfig) (*PostgreSQLClient, error) {
 	connStr := config.ConnectionString()
 	log.Printf("Connecting to PostgreSQL with connection string: %s", connStr)
 	db, err := sql.Open("postgres", connStr)
@@ -83,52 +175,84 @@ func NewPostgreSQLClient(config PostgreSQLConfig, migrationConfig MigrationConfi
 	log.Println("Testing PostgreSQL connection...")
 	// Test the connection
 	if err := db.Ping(); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("failed to ping PostgreSQL: %w", err)
 	}
 	log.Println("PostgreSQL connection successful")
 
-	client := &PostgreSQLClient{
-		db:                 db,
-		config:             config,
-		asnCache:           make(map[string]uuid.UUID),
-		countryCache:       make(map[string]uuid.UUID),
-		protocolCache:      make(map[string]uuid.UUID),
-		malwareFamilyCache: make(map[string]uuid.UUID),
-		useCopy:            migrationConfig.UseCopy,
-		copyThreshold:      migrationConfig.CopyThreshold,
-		adaptiveCopy:       migrationConfig.AdaptiveCopy,
-		copyMin:            migrationConfig.CopyMinThreshold,
-		copyMax:            migrationConfig.CopyMaxThreshold,
-	}
-
-	// Prepare statements
-	log.Println("Preparing SQL statements...")
-	if err := client.prepareStatements(); err != nil {
-		return nil, fmt.Errorf("failed to prepare statements: %w", err)
-	}
-	log.Println("SQL statements prepared successfully")
-
-	// Load existing lookup data into caches
-	log.Println("Loading lookup caches...")
-	if err := client.loadLookupCaches(); err != nil {
-		return nil, fmt.Errorf("failed to load lookup caches: %w", err)
-	}
+	return &PostgreSQLClient{
+		db:                       db,
+		config:                   config,
+		asnCache:                 NewLookupCache(migrationConfig.LookupCacheSize),
+		countryCache:             NewLookupCache(migrationConfig.LookupCacheSize),
+		protocolCache:            NewLookupCache(migrationConfig.LookupCacheSize),
+		applicationProtocolCache: NewLookupCache(migrationConfig.LookupCacheSize),
+		malwareFamilyCache:       NewLookupCache(migrationConfig.LookupCacheSize),
+		inflight:                 make(map[string]*lookupCall),
+		useCopy:                  migrationConfig.UseCopy,
+		copyThreshold:            migrationConfig.CopyThreshold,
+		copyTempTable:            migrationConfig.CopyTempTable,
+	}, nil
+}
 
-	log.Printf("Connected to PostgreSQL: %s:%d/%s", config.Host, config.Port, config.Database)
+// requiredColumns are the columns the tool writes that were added to the schema after its first
+// release, with the EF Core migration adding each. The application owns the schema, so the tool
+// only checks for them.
+var requiredColumns = []struct {
+	table, column, migration string
+}{
+	{"AsnRegistries", "AsNumber", "AddAsnRegistryAsNumber"},
+	{"ApplicationProtocols", "Name", "AddApplicationProtocols"},
+	{"ThreatEvents", "ApplicationProtocolId", "AddApplicationProtocols"},
+}
 
-	// Progress tracking is now based on existing record count in PostgreSQL
+// checkSchema fails with the migration to apply when the database lacks one of requiredColumns
+func (p *PostgreSQLClient) checkSchema() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
 
-	return client, nil
+	for _, required := range requiredColumns {
+		var exists bool
+		if err := p.db.QueryRowContext(ctx, `
+			SELECT EXISTS (
+				SELECT 1 FROM information_schema.columns
+				WHERE table_schema = current_schema() AND table_name = $1 AND column_name = $2
+			)`, required.table, required.column).Scan(&exists); err != nil {
+			return fmt.Errorf("failed to check for column %s.%s: %w", required.table, required.column, err)
+		}
+		if !exists {
+			return fmt.Errorf("column %s.%s is missing: apply the EF Core migration %s (dotnet ef database update) before running the migration tool",
+				required.table, required.column, required.migration)
+		}
+	}
+	return nil
 }
 
 // Close closes the PostgreSQL connection and prepared statements
 func (p *PostgreSQLClient) Close() error {
+	p.breaker.Stop()
+	if p.refreshCancel != nil {
+		p.refreshCancel()
+	}
 	if p.insertThreatStmt != nil {
 		_ = p.insertThreatStmt.Close()
 	}
 	return p.db.Close()
 }
 
+// probeWrites checks that the database is reachable and accepts writes (it is not a
+// read-only standby, as during a failover)
+func (p *PostgreSQLClient) probeWrites(ctx context.Context) error {
+	var inRecovery bool
+	if err := p.db.QueryRowContext(ctx, `SELECT pg_is_in_recovery()`).Scan(&inRecovery); err != nil {
+		return err
+	}
+	if inRecovery {
+		return fmt.Errorf("server is a read-only standby")
+	}
+	return nil
+}
+
 // prepareStatements prepares all SQL statements for batch operations
 func (p *PostgreSQLClient) prepareStatements() error {
 	var err error
@@ -137,221 +261,90 @@ func (p *PostgreSQLClient) prepareStatements() error {
 		INSERT INTO "ThreatEvents" (
 			"Id","Timestamp","AsnRegistryId","SourceAddress","SourceCountryId",
 			"DestinationAddress","DestinationCountryId","SourcePort","DestinationPort",
-			"ProtocolId","Category","MalwareFamilyId","CreatedAt","UpdatedAt"
-		) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14)`)
+			"ProtocolId","Category","MalwareFamilyId","CreatedAt","UpdatedAt","ApplicationProtocolId"
+		) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15)
+		` + threatEventsUpsert)
 	if err != nil {
 		return fmt.Errorf("failed to prepare ThreatEvents insert: %w", err)
 	}
 	return nil
 }
 
-// loadLookupCaches loads existing lookup data into memory caches
-func (p *PostgreSQLClient) loadLookupCaches() error {
-	log.Println("Loading ASN cache (AsnRegistries)...")
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	rows, err := p.db.QueryContext(ctx, `SELECT "Id", "Number" FROM "AsnRegistries" LIMIT 200000`)
-	if err != nil {
-		log.Printf("Warning: Could not load ASN cache (table may not exist): %v", err)
-	} else {
-		defer rows.Close()
-		count := 0
-		for rows.Next() {
-			var id uuid.UUID
-			var number string
-			if err := rows.Scan(&id, &number); err != nil {
-				log.Printf("Warning: failed to scan AsnRegistries row: %v", err)
-				continue
-			}
-			if number != "" {
-				p.asnCache[number] = id
-				count++
-			}
-		}
-		log.Printf("Loaded %d ASN entries", count)
-	}
-
-	log.Println("Loading country cache (Countries)...")
-	ctx2, cancel2 := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel2()
-	rows, err = p.db.QueryContext(ctx2, `SELECT "Id", "Code" FROM "Countries" LIMIT 10000`)
-	if err != nil {
-		log.Printf("Warning: Could not load Countries cache: %v", err)
-	} else {
-		defer rows.Close()
-		count := 0
-		for rows.Next() {
-			var id uuid.UUID
-			var code string
-			if err := rows.Scan(&id, &code); err != nil {
-				log.Printf("Warning: failed to scan Countries row: %v", err)
-				continue
-			}
-			if code != "" {
-				p.countryCache[code] = id
-				count++
-			}
-		}
-		log.Printf("Loaded %d country entries", count)
-	}
-
-	log.Println("Loading protocol cache (Protocols)...")
-	ctx3, cancel3 := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel3()
-	rows, err = p.db.QueryContext(ctx3, `SELECT "Id", "Name" FROM "Protocols" LIMIT 10000`)
-	if err != nil {
-		log.Printf("Warning: Could not load Protocols cache: %v", err)
-	} else {
-		defer rows.Close()
-		count := 0
-		for rows.Next() {
-			var id uuid.UUID
-			var name string
-			if err := rows.Scan(&id, &name); err != nil {
-				log.Printf("Warning: failed to scan Protocols row: %v", err)
-				continue
-			}
-			if name != "" {
-				p.protocolCache[name] = id
-				count++
-			}
-		}
-		log.Printf("Loaded %d protocol entries", count)
-	}
-
-	log.Println("Loading malware family cache (MalwareFamilies)...")
-	ctx4, cancel4 := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel4()
-	rows, err = p.db.QueryContext(ctx4, `SELECT "Id", "Name" FROM "MalwareFamilies" LIMIT 10000`)
-	if err != nil {
-		log.Printf("Warning: Could not load MalwareFamilies cache: %v", err)
-	} else {
-		defer rows.Close()
-		count := 0
-		for rows.Next() {
-			var id uuid.UUID
-			var name string
-			if err := rows.Scan(&id, &name); err != nil {
-				log.Printf("Warning: failed to scan MalwareFamilies row: %v", err)
-				continue
-			}
-			if name != "" {
-				p.malwareFamilyCache[name] = id
-				count++
-			}
-		}
-		log.Printf("Loaded %d malware family entries", count)
-	}
-
-	log.Printf("Loaded lookup caches: %d ASNs, %d countries, %d protocols, %d malware families",
-		len(p.asnCache), len(p.countryCache), len(p.protocolCache), len(p.malwareFamilyCache))
-
-	return nil
-}
-
 // GetOrCreateAsnID gets or creates an ASN record and returns its ID
 func (p *PostgreSQLClient) GetOrCreateAsnID(asn, description string) (uuid.UUID, error) {
-	// Cache check
-	p.cacheMutex.RLock()
-	if id, ok := p.asnCache[asn]; ok {
-		p.cacheMutex.RUnlock()
-		return id, nil
-	}
-	p.cacheMutex.RUnlock()
-
-	id, err := p.getOrCreateUUID("AsnRegistries", "Number", asn, map[string]string{"Description": description})
-	if err != nil {
-		return uuid.Nil, err
-	}
-	p.cacheMutex.Lock()
-	p.asnCache[asn] = id
-	p.cacheMutex.Unlock()
-	return id, nil
+	return p.getOrCreateLookup(asnLookup, asn, description)
 }
 
-// GetOrCreateCountryID gets or creates a country record and returns its ID
+// GetOrCreateCountryID gets or creates a country record and returns its ID. ISO 3166-1 codes
+// are created with their proper country name; name is only used for codes outside the dataset.
 func (p *PostgreSQLClient) GetOrCreateCountryID(code, name string) (uuid.UUID, error) {
-	p.cacheMutex.RLock()
-	if id, ok := p.countryCache[code]; ok {
-		p.cacheMutex.RUnlock()
-		return id, nil
-	}
-	p.cacheMutex.RUnlock()
-
-	id, err := p.getOrCreateUUID("Countries", "Code", code, map[string]string{"Name": name})
-	if err != nil {
-		return uuid.Nil, err
+	if country, ok := CountryByCode(code); ok {
+		name = country.Name
 	}
-	p.cacheMutex.Lock()
-	p.countryCache[code] = id
-	p.cacheMutex.Unlock()
-	return id, nil
+	return p.getOrCreateLookup(countryLookup, code, name)
 }
 
 // GetOrCreateProtocolID gets or creates a protocol record and returns its ID
 func (p *PostgreSQLClient) GetOrCreateProtocolID(name string) (uuid.UUID, error) {
-	p.cacheMutex.RLock()
-	if id, ok := p.protocolCache[name]; ok {
-		p.cacheMutex.RUnlock()
-		return id, nil
-	}
-	p.cacheMutex.RUnlock()
+	return p.getOrCreateLookup(protocolLookup, name, "")
+}
 
-	id, err := p.getOrCreateUUID("Protocols", "Name", name, nil)
-	if err != nil {
-		return uuid.Nil, err
-	}
-	p.cacheMutex.Lock()
-	p.protocolCache[name] = id
-	p.cacheMutex.Unlock()
-	return id, nil
+// GetOrCreateApplicationProtocolID gets or creates an application protocol record and returns its ID
+func (p *PostgreSQLClient) GetOrCreateApplicationProtocolID(name string) (uuid.UUID, error) {
+	return p.getOrCreateLookup(applicationProtocolLookup, name, "")
 }
 
 // GetOrCreateMalwareFamilyID gets or creates a malware family record and returns its ID
 func (p *PostgreSQLClient) GetOrCreateMalwareFamilyID(name string) (uuid.UUID, error) {
-	p.cacheMutex.RLock()
-	if id, ok := p.malwareFamilyCache[name]; ok {
-		p.cacheMutex.RUnlock()
-		return id, nil
-	}
-	p.cacheMutex.RUnlock()
+	return p.getOrCreateLookup(malwareFamilyLookup, name, "")
+}
 
-	id, err := p.getOrCreateUUID("MalwareFamilies", "Name", name, nil)
-	if err != nil {
-		return uuid.Nil, err
-	}
-	p.cacheMutex.Lock()
-	p.malwareFamilyCache[name] = id
-	p.cacheMutex.Unlock()
-	return id, nil
+// threatEventWriter writes ThreatEvents rows. PostgreSQLClient is the implementation; tests
+// substitute one that refuses rows.
+type threatEventWriter interface {
+	InsertThreatBatch(threats []ThreatRecord) error
+	DeleteThreatEvents(ctx context.Context, ids []uuid.UUID) (int64, error)
 }
 
-// InsertThreatBatch inserts a batch of threat records
+// InsertThreatBatch inserts a batch of threat records and reports the outcome to the circuit breaker
 func (p *PostgreSQLClient) InsertThreatBatch(threats []ThreatRecord) error {
+	err := p.insertThreatBatch(threats)
+	p.breaker.Record(err)
+	return err
+}
+
+// insertThreatBatch writes threats with COPY or row inserts, depending on the batch size
+func (p *PostgreSQLClient) insertThreatBatch(threats []ThreatRecord) error {
 	if len(threats) == 0 {
 		return nil
 	}
 
-	threshold := p.copyThreshold
-	if p.adaptiveCopy {
-		// Placeholder adaptive logic: grow threshold modestly if very large batches observed
-		if len(threats) > threshold*4 && threshold < p.copyMax {
-			threshold = min(p.copyMax, threshold*2)
-		} else if len(threats) < threshold/2 && threshold > p.copyMin {
-			threshold = max(p.copyMin, threshold/2)
-		}
-		p.copyThreshold = threshold
-	}
+	threshold := p.adaptive.CopyThreshold(p.copyThreshold)
 
 	if p.useCopy && len(threats) >= threshold {
-		if err := p.copyThreatBatch(threats); err == nil {
+		copyStart := time.Now()
+		var rejected []RejectedRow
+		var err error
+		if p.copyTempTable != "" {
+			rejected, err = p.stageThreatBatch(threats)
+		} else {
+			err = p.copyThreatBatch(threats)
+		}
+		if err == nil {
+			p.metrics.ObserveInsert(insertMethodCopy, len(threats), time.Since(copyStart))
+			p.adaptive.Observe(insertMethodCopy, len(threats), time.Since(copyStart))
+			if len(rejected) > 0 {
+				return &RowRejectionError{Rejected: rejected}
+			}
 			return nil
 		} else {
 			log.Printf("COPY failed, fallback to row inserts: %v", err)
+			p.metrics.CopyFallback()
 		}
 	}
 
+	insertStart := time.Now()
+
 	// Fallback per-row prepared statement inside transaction
 	tx, err := p.db.Begin()
 	if err != nil {
@@ -363,7 +356,7 @@ func (p *PostgreSQLClient) InsertThreatBatch(threats []ThreatRecord) error {
 	defer stmt.Close()
 
 	for _, threat := range threats {
-		var srcCountry, dstCountry, proto, mal *uuid.UUID
+		var srcCountry, dstCountry, proto, app, mal *uuid.UUID
 		if threat.SourceCountryID != nil {
 			srcCountry = threat.SourceCountryID
 		}
@@ -373,6 +366,9 @@ func (p *PostgreSQLClient) InsertThreatBatch(threats []ThreatRecord) error {
 		if threat.ProtocolID != nil {
 			proto = threat.ProtocolID
 		}
+		if threat.ApplicationProtocolID != nil {
+			app = threat.ApplicationProtocolID
+		}
 		if threat.MalwareFamilyID != nil {
 			mal = threat.MalwareFamilyID
 		}
@@ -396,6 +392,7 @@ func (p *PostgreSQLClient) InsertThreatBatch(threats []ThreatRecord) error {
 			mal,
 			threat.CreatedAt,
 			threat.UpdatedAt,
+			app,
 		); err != nil {
 			return fmt.Errorf("insert threat %s: %w", threat.ID, err)
 		}
@@ -403,6 +400,8 @@ func (p *PostgreSQLClient) InsertThreatBatch(threats []ThreatRecord) error {
 	if err := tx.Commit(); err != nil {
 		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
+	p.metrics.ObserveInsert(insertMethodRows, len(threats), time.Since(insertStart))
+	p.adaptive.Observe(insertMethodRows, len(threats), time.Since(insertStart))
 	return nil
 }
 
@@ -414,13 +413,6 @@ func (p *PostgreSQLClient) copyThreatBatch(threats []ThreatRecord) error {
 	}
 	defer conn.Close()
 
-	// Columns list mirrors prepared insert ordering
-	copyInStmt := pq.CopyIn("ThreatEvents",
-		"Id", "Timestamp", "AsnRegistryId", "SourceAddress", "SourceCountryId",
-		"DestinationAddress", "DestinationCountryId", "SourcePort", "DestinationPort",
-		"ProtocolId", "Category", "MalwareFamilyId", "CreatedAt", "UpdatedAt",
-	)
-
 	// Use explicit transaction for COPY for atomicity
 	var tx *sql.Tx
 	if err := conn.Raw(func(driverConn any) error { return nil }); err != nil {
@@ -430,9 +422,44 @@ func (p *PostgreSQLClient) copyThreatBatch(threats []ThreatRecord) error {
 	if err != nil {
 		return err
 	}
-	stmt, err := tx.Prepare(copyInStmt)
+
+	// COPY cannot handle conflicting rows, so rows are copied into a session-local
+	// staging table and merged with threatEventsUpsert. ON COMMIT DELETE ROWS
+	// empties it after every batch so the pooled connection can reuse it.
+	if _, err := tx.Exec(`CREATE TEMP TABLE IF NOT EXISTS threat_events_copy
+		(LIKE "ThreatEvents" INCLUDING DEFAULTS) ON COMMIT DELETE ROWS`); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("create COPY staging table failed: %w", err)
+	}
+
+	if err := copyThreatRows(tx, "threat_events_copy", threats); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	columns := `"` + strings.Join(threatEventColumns, `","`) + `"`
+	// An upsert cannot touch the same row twice, so a record repeated in the batch is merged once
+	res, err := tx.Exec(fmt.Sprintf(`INSERT INTO "ThreatEvents" (%[1]s)
+		SELECT DISTINCT ON ("Id", "Timestamp") %[1]s FROM threat_events_copy ORDER BY "Id", "Timestamp"
+		%[2]s`, columns, threatEventsUpsert))
 	if err != nil {
 		tx.Rollback()
+		return fmt.Errorf("COPY merge failed: %w", err)
+	}
+	if merged, err := res.RowsAffected(); err == nil && merged < int64(len(threats)) {
+		log.Printf("COPY merge left %d already migrated records unchanged", int64(len(threats))-merged)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("COPY commit failed: %w", err)
+	}
+	return nil
+}
+
+// copyThreatRows streams threats into table with COPY, in threatEventColumns order
+func copyThreatRows(tx *sql.Tx, table string, threats []ThreatRecord) error {
+	stmt, err := tx.Prepare(pq.CopyIn(table, threatEventColumns...))
+	if err != nil {
 		return fmt.Errorf("prepare COPY failed: %w", err)
 	}
 
@@ -442,26 +469,21 @@ func (p *PostgreSQLClient) copyThreatBatch(threats []ThreatRecord) error {
 			s := t.DestinationAddress.String()
 			destAddr = &s
 		}
-		var srcCountry, dstCountry, proto, mal interface{}
+		var srcCountry, dstCountry, proto, app, mal interface{}
 		if t.SourceCountryID != nil {
 			srcCountry = *t.SourceCountryID
-		} else {
-			srcCountry = nil
 		}
 		if t.DestinationCountryID != nil {
 			dstCountry = *t.DestinationCountryID
-		} else {
-			dstCountry = nil
 		}
 		if t.ProtocolID != nil {
 			proto = *t.ProtocolID
-		} else {
-			proto = nil
+		}
+		if t.ApplicationProtocolID != nil {
+			app = *t.ApplicationProtocolID
 		}
 		if t.MalwareFamilyID != nil {
 			mal = *t.MalwareFamilyID
-		} else {
-			mal = nil
 		}
 		if _, err := stmt.Exec(
 			&t.ID,
@@ -478,27 +500,41 @@ func (p *PostgreSQLClient) copyThreatBatch(threats []ThreatRecord) error {
 			mal,
 			&t.CreatedAt,
 			&t.UpdatedAt,
+			app,
 		); err != nil {
 			stmt.Close()
-			tx.Rollback()
 			return fmt.Errorf("COPY exec failed: %w", err)
 		}
 	}
 	if _, err := stmt.Exec(); err != nil {
 		stmt.Close()
-		tx.Rollback()
 		return fmt.Errorf("COPY finalize failed: %w", err)
 	}
 	if err := stmt.Close(); err != nil {
-		tx.Rollback()
 		return fmt.Errorf("COPY close failed: %w", err)
 	}
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("COPY commit failed: %w", err)
-	}
 	return nil
 }
 
+// DeleteThreatEvents removes ThreatEvents rows by ID, across all hypertable chunks
+func (p *PostgreSQLClient) DeleteThreatEvents(ctx context.Context, ids []uuid.UUID) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	idStrings := make([]string, len(ids))
+	for i, id := range ids {
+		idStrings[i] = id.String()
+	}
+
+	res, err := p.db.ExecContext(ctx, `DELETE FROM "ThreatEvents" WHERE "Id" = ANY($1::uuid[])`, pq.Array(idStrings))
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete threat events: %w", err)
+	}
+	deleted, _ := res.RowsAffected()
+	return deleted, nil
+}
+
 // parseAndValidateIPAddress parses and validates an IP address string
 func (p *PostgreSQLClient) parseAndValidateIPAddress(ipStr string) (net.IP, error) {
 	if ipStr == "" {
@@ -543,57 +579,26 @@ func (p *PostgreSQLClient) parseAndValidatePort(portStr string) (int, error) {
 	return port, nil
 }
 
-// normalizeASN normalizes ASN data by removing common prefixes and cleaning format
+// normalizeASN normalizes an ASN to its asplain display form, e.g. "ASN13335" and "AS0.13335"
+// to "AS13335". Values that are not an AS number are kept as they are, cut to the column size.
 func (p *PostgreSQLClient) normalizeASN(asn string) string {
-	if asn == "" {
-		return ""
-	}
-
-	// Trim whitespace first
-	normalized := strings.TrimSpace(asn)
-	if normalized == "" {
-		return ""
-	}
-
-	// Convert to uppercase for consistent processing
-	normalized = strings.ToUpper(normalized)
-
-	// Remove common prefixes like "AS" or "ASN"
-	if strings.HasPrefix(normalized, "AS") {
-		normalized = normalized[2:]
-	} else if strings.HasPrefix(normalized, "ASN") {
-		normalized = normalized[3:]
-	}
+	normalized, _, _ := p.parseASN(asn)
+	return normalized
+}
 
-	// Remove any remaining non-numeric characters except for valid ASN formats
-	normalized = strings.TrimSpace(normalized)
-	if normalized == "" {
-		return asn // Return original if we can't normalize
-	}
-
-	// Validate that we have a numeric ASN
-	var asnNumber int
-	if _, err := fmt.Sscanf(normalized, "%d", &asnNumber); err != nil {
-		// If not a simple number, try to extract the first number
-		for i, char := range normalized {
-			if char < '0' || char > '9' {
-				if i > 0 {
-					normalized = normalized[:i]
-					break
-				} else {
-					return asn // Return original if no valid number found
-				}
-			}
-		}
+// parseASN returns the display form, the AS number (0 if it is not an AS number) and the
+// description written after the number of an ASN
+func (p *PostgreSQLClient) parseASN(asn string) (string, ASN, string) {
+	number, description, err := ParseASN(asn)
+	if err == nil {
+		return number.String(), number, description
 	}
 
-	// Validate ASN range (1-4294967295 for 32-bit ASNs)
-	if asnNumber < 1 || asnNumber > 4294967295 {
-		return asn // Return original if out of valid range
+	normalized := strings.TrimSpace(asn)
+	if len(normalized) > 20 {
+		normalized = normalized[:20]
 	}
-
-	// Add AS prefix for consistency
-	return fmt.Sprintf("AS%s", normalized)
+	return normalized, 0, ""
 }
 
 // normalizeASNInfo normalizes ASN description information
@@ -631,8 +636,13 @@ func (p *PostgreSQLClient) normalizeASNInfo(asnInfo string) string {
 
 // normalizeCategory normalizes threat category data
 func (p *PostgreSQLClient) normalizeCategory(category string) string {
+	return p.matchCategory(category).Value
+}
+
+// matchCategory normalizes a category and reports which rule produced the value
+func (p *PostgreSQLClient) matchCategory(category string) RuleMatch {
 	if category == "" {
-		return ""
+		return RuleMatch{}
 	}
 
 	// Sanitize string first
@@ -641,7 +651,7 @@ func (p *PostgreSQLClient) normalizeCategory(category string) string {
 	// Trim whitespace and convert to lowercase for consistency
 	normalized := strings.TrimSpace(strings.ToLower(category))
 	if normalized == "" {
-		return ""
+		return RuleMatch{}
 	}
 
 	// Remove common unwanted characters
@@ -654,35 +664,10 @@ func (p *PostgreSQLClient) normalizeCategory(category string) string {
 		normalized = strings.ReplaceAll(normalized, "  ", " ")
 	}
 
-	// Map common category variations to standard names
-	categoryMap := map[string]string{
-		"malware":     "malware",
-		"botnet":      "botnet",
-		"phishing":    "phishing",
-		"spam":        "spam",
-		"c&c":         "c2",
-		"c2":          "c2",
-		"command":     "c2",
-		"control":     "c2",
-		"exploit":     "exploit",
-		"bruteforce":  "brute_force",
-		"brute force": "brute_force",
-		"ddos":        "ddos",
-		"dos":         "dos",
-		"scanner":     "scanner",
-		"scan":        "scanner",
-	}
-
-	// Check for exact matches first
-	if standardName, exists := categoryMap[normalized]; exists {
-		return standardName
-	}
-
-	// Check for partial matches
-	for key, value := range categoryMap {
-		if strings.Contains(normalized, key) {
-			return value
-		}
+	// Map category variations to standard names with the active rules
+	rules := p.rules.Rules().Category
+	if match, ok := rules.match(normalized); ok {
+		return match
 	}
 
 	// Limit length to match database constraint
@@ -690,244 +675,140 @@ func (p *PostgreSQLClient) normalizeCategory(category string) string {
 		normalized = normalized[:50]
 	}
 
-	return normalized
+	return rules.fallback(normalized)
 }
 
 // normalizeCountryCode normalizes country code to ISO 3166-1 alpha-2 format
 func (p *PostgreSQLClient) normalizeCountryCode(country string) string {
+	return p.matchCountry(country).Value
+}
+
+// matchCountry normalizes a country code and reports which rule produced the value
+func (p *PostgreSQLClient) matchCountry(country string) RuleMatch {
 	if country == "" {
-		return ""
+		return RuleMatch{}
 	}
 
 	// Trim whitespace and convert to uppercase
 	normalized := strings.TrimSpace(strings.ToUpper(country))
 	if normalized == "" {
-		return ""
-	}
-
-	// Handle common country name to code mappings
-	countryMap := map[string]string{
-		"UNITED STATES":      "US",
-		"USA":                "US",
-		"AMERICA":            "US",
-		"UNITED KINGDOM":     "GB",
-		"UK":                 "GB",
-		"GREAT BRITAIN":      "GB",
-		"CHINA":              "CN",
-		"RUSSIA":             "RU",
-		"RUSSIAN FEDERATION": "RU",
-		"GERMANY":            "DE",
-		"FRANCE":             "FR",
-		"JAPAN":              "JP",
-		"CANADA":             "CA",
-		"AUSTRALIA":          "AU",
-		"BRAZIL":             "BR",
-		"INDIA":              "IN",
-		"SOUTH KOREA":        "KR",
-		"KOREA":              "KR",
-		"NETHERLANDS":        "NL",
-		"HOLLAND":            "NL",
-		"SPAIN":              "ES",
-		"ITALY":              "IT",
-		"SWEDEN":             "SE",
-		"NORWAY":             "NO",
-		"DENMARK":            "DK",
-		"FINLAND":            "FI",
-		"POLAND":             "PL",
-		"UKRAINE":            "UA",
-		"TURKEY":             "TR",
-		"ISRAEL":             "IL",
-		"SOUTH AFRICA":       "ZA",
-		"MEXICO":             "MX",
-		"ARGENTINA":          "AR",
-		"CHILE":              "CL",
-		"COLOMBIA":           "CO",
-		"VENEZUELA":          "VE",
-		"PERU":               "PE",
-		"ECUADOR":            "EC",
-		"BOLIVIA":            "BO",
-		"URUGUAY":            "UY",
-		"PARAGUAY":           "PY",
-		"THAILAND":           "TH",
-		"VIETNAM":            "VN",
-		"SINGAPORE":          "SG",
-		"MALAYSIA":           "MY",
-		"INDONESIA":          "ID",
-		"PHILIPPINES":        "PH",
-		"TAIWAN":             "TW",
-		"HONG KONG":          "HK",
-		"NEW ZEALAND":        "NZ",
-		"SWITZERLAND":        "CH",
-		"AUSTRIA":            "AT",
-		"BELGIUM":            "BE",
-		"PORTUGAL":           "PT",
-		"GREECE":             "GR",
-		"CZECH REPUBLIC":     "CZ",
-		"HUNGARY":            "HU",
-		"ROMANIA":            "RO",
-		"BULGARIA":           "BG",
-		"CROATIA":            "HR",
-		"SERBIA":             "RS",
-		"SLOVENIA":           "SI",
-		"SLOVAKIA":           "SK",
-		"ESTONIA":            "EE",
-		"LATVIA":             "LV",
-		"LITHUANIA":          "LT",
-		"IRELAND":            "IE",
-		"ICELAND":            "IS",
-		"LUXEMBOURG":         "LU",
-		"MALTA":              "MT",
-		"CYPRUS":             "CY",
-	}
-
-	// Check if it's a full country name that can be mapped
-	if code, exists := countryMap[normalized]; exists {
-		return code
-	}
-
-	// If it's already a 2-character code, validate and return
-	if len(normalized) == 2 {
-		// Validate it looks like a country code (2 letters)
-		for _, char := range normalized {
-			if char < 'A' || char > 'Z' {
-				return "" // Invalid country code format
-			}
-		}
-		return normalized
+		return RuleMatch{}
 	}
 
-	// If it's longer than 2 characters, try to extract a valid 2-char code from the beginning
-	if len(normalized) > 2 {
-		candidate := normalized[:2]
-		// Validate the candidate
-		for _, char := range candidate {
-			if char < 'A' || char > 'Z' {
-				return "" // Invalid country code format
-			}
-		}
-		return candidate
+	// Map country names to codes with the active rules; a fuzzy match only counts once the
+	// ISO 3166-1 dataset has no exact match either
+	rules := p.rules.Rules().Country
+	match, matched := rules.match(normalized)
+	if matched && match.Kind != MatchFuzzy {
+		return match
+	}
+
+	// Resolve ISO 3166-1 alpha-2, alpha-3 and numeric codes, former codes and country names
+	if resolved, ok := LookupCountry(normalized); ok {
+		return RuleMatch{Value: resolved.Alpha2, Kind: MatchAlias, Rule: normalized, Confidence: 1}
+	}
+	if matched {
+		return match
 	}
 
-	return ""
+	// Unresolvable values are rejected rather than guessed from their first letters
+	return rules.fallback("")
 }
 
-// normalizeProtocol normalizes protocol names to standard format
-func (p *PostgreSQLClient) normalizeProtocol(protocol string) string {
-	if protocol == "" {
-		return ""
+// resolveCountry returns the code and ISO 3166-1 name of a matched country, or empty strings
+// if the value could not be resolved
+func resolveCountry(match RuleMatch) (code, name string) {
+	country, ok := CountryByCode(match.Value)
+	if !ok {
+		return "", ""
 	}
+	return country.Alpha2, country.Name
+}
+
+// normalizeProtocol normalizes protocol names and numbers to IANA protocol keywords
+func (p *PostgreSQLClient) normalizeProtocol(protocol string) string {
+	return p.matchProtocol(protocol).Value
+}
 
+// cleanProtocol sanitizes a raw protocol value and uppercases it
+func cleanProtocol(protocol string) string {
 	// Sanitize string first
 	protocol = sanitizeUTF8String(protocol)
 
 	// Trim whitespace and convert to uppercase for consistency
 	normalized := strings.TrimSpace(strings.ToUpper(protocol))
-	if normalized == "" {
-		return ""
-	}
 
 	// Remove common unwanted characters
 	normalized = strings.ReplaceAll(normalized, "\n", "")
 	normalized = strings.ReplaceAll(normalized, "\r", "")
 	normalized = strings.ReplaceAll(normalized, "\t", "")
+	return normalized
+}
 
-	// Map common protocol variations to standard names
-	protocolMap := map[string]string{
-		"TCP":      "TCP",
-		"UDP":      "UDP",
-		"ICMP":     "ICMP",
-		"HTTP":     "HTTP",
-		"HTTPS":    "HTTPS",
-		"FTP":      "FTP",
-		"SSH":      "SSH",
-		"DNS":      "DNS",
-		"SMTP":     "SMTP",
-		"POP3":     "POP3",
-		"IMAP":     "IMAP",
-		"TELNET":   "TELNET",
-		"SNMP":     "SNMP",
-		"DHCP":     "DHCP",
-		"TFTP":     "TFTP",
-		"NTP":      "NTP",
-		"LDAP":     "LDAP",
-		"SIP":      "SIP",
-		"RTP":      "RTP",
-		"RTCP":     "RTCP",
-		"H323":     "H323",
-		"MGCP":     "MGCP",
-		"SCTP":     "SCTP",
-		"GRE":      "GRE",
-		"ESP":      "ESP",
-		"AH":       "AH",
-		"OSPF":     "OSPF",
-		"BGP":      "BGP",
-		"RIP":      "RIP",
-		"EIGRP":    "EIGRP",
-		"ISIS":     "ISIS",
-		"VRRP":     "VRRP",
-		"HSRP":     "HSRP",
-		"GLBP":     "GLBP",
-		"LACP":     "LACP",
-		"STP":      "STP",
-		"RSTP":     "RSTP",
-		"MSTP":     "MSTP",
-		"LLDP":     "LLDP",
-		"CDP":      "CDP",
-		"VTP":      "VTP",
-		"DTP":      "DTP",
-		"PAGP":     "PAGP",
-		"UDLD":     "UDLD",
-		"BPDU":     "BPDU",
-		"ARP":      "ARP",
-		"RARP":     "RARP",
-		"BOOTP":    "BOOTP",
-		"RADIUS":   "RADIUS",
-		"TACACS":   "TACACS",
-		"TACACS+":  "TACACS+",
-		"KERBEROS": "KERBEROS",
-		"IPV6":     "IPV6",
-		"ICMPV6":   "ICMPV6",
-		"MLDV2":    "MLDV2",
-		"IGMP":     "IGMP",
-		"PIM":      "PIM",
-		"DVMRP":    "DVMRP",
-		"MOSPF":    "MOSPF",
-	}
-
-	// Check for exact matches first
-	if standardName, exists := protocolMap[normalized]; exists {
-		return standardName
-	}
-
-	// Check for partial matches or common variations
-	for key, value := range protocolMap {
-		if strings.Contains(normalized, key) {
-			return value
-		}
+// matchProtocol resolves the transport protocol of a value and reports which rule produced it.
+// Values that are not a transport protocol, such as application protocols, give an empty value.
+func (p *PostgreSQLClient) matchProtocol(protocol string) RuleMatch {
+	normalized := cleanProtocol(protocol)
+	if normalized == "" {
+		return RuleMatch{}
 	}
 
-	// Handle numeric protocol numbers (convert to string representation)
-	var protocolNum int
-	if _, err := fmt.Sscanf(normalized, "%d", &protocolNum); err == nil {
-		// Map common protocol numbers to names
-		protocolNumMap := map[int]string{
-			1:   "ICMP",
-			6:   "TCP",
-			17:  "UDP",
-			47:  "GRE",
-			50:  "ESP",
-			51:  "AH",
-			89:  "OSPF",
-			132: "SCTP",
+	// Protocol numbers resolve through the IANA registry; numbers without a keyword keep PROTO_<number>
+	if isDigits(normalized) {
+		resolved, ok := LookupIPProtocol(normalized)
+		if !ok {
+			return RuleMatch{}
 		}
-		if protocolName, exists := protocolNumMap[protocolNum]; exists {
-			return protocolName
+		return RuleMatch{Value: resolved.CanonicalName(), Kind: MatchAlias, Rule: normalized, Confidence: 1}
+	}
+
+	// Map protocol spellings and composite values such as "tcp/443" with the active rules
+	rules := p.rules.Rules()
+	if match, ok := rules.Protocol.match(normalized); ok && isIPProtocolName(match.Value) {
+		return match
+	}
+
+	// Any other IANA keyword, unless the application rules claim the name: IANA numbers a few
+	// long-gone protocols whose names are now application protocols, such as RDP and STP
+	if resolved, ok := LookupIPProtocol(normalized); ok {
+		if _, isApplication := rules.ApplicationProtocol.match(normalized); !isApplication {
+			return RuleMatch{Value: resolved.CanonicalName(), Kind: MatchAlias, Rule: normalized, Confidence: 1}
 		}
-		// For unknown protocol numbers, return as PROTO_<number>
-		return fmt.Sprintf("PROTO_%d", protocolNum)
 	}
 
-	// For unknown protocols, clean and return uppercase version limited to 20 chars
+	return rules.Protocol.fallback("")
+}
+
+// normalizeApplicationProtocol normalizes application protocol names
+func (p *PostgreSQLClient) normalizeApplicationProtocol(protocol string) string {
+	return p.matchApplicationProtocol(protocol).Value
+}
+
+// matchApplicationProtocol resolves the application protocol of a value and reports which rule
+// produced it. Plain transport protocols give an empty value.
+func (p *PostgreSQLClient) matchApplicationProtocol(protocol string) RuleMatch {
+	normalized := cleanProtocol(protocol)
+	if normalized == "" {
+		return RuleMatch{}
+	}
+
+	// Map application protocol names with the active rules
+	rules := p.rules.Rules().ApplicationProtocol
+	if match, ok := rules.match(normalized); ok {
+		return match
+	}
+
+	// Registered service names are application protocols as they are
+	if p.services.Known(normalized) {
+		return RuleMatch{Value: normalized, Kind: MatchAlias, Rule: normalized, Confidence: 1}
+	}
+
+	// Protocol numbers and values that resolved to a transport protocol carry no application protocol
+	if isDigits(normalized) || p.matchProtocol(normalized).Value != "" {
+		return RuleMatch{}
+	}
+
+	// For unknown protocols, clean and return uppercase version limited to 50 chars
 	// Remove any non-alphanumeric characters except underscores and hyphens
 	var cleanedProtocol strings.Builder
 	for _, char := range normalized {
@@ -937,22 +818,63 @@ func (p *PostgreSQLClient) normalizeProtocol(protocol string) string {
 	}
 
 	result := cleanedProtocol.String()
-	if len(result) > 20 {
-		result = result[:20]
+	if len(result) > 50 {
+		result = result[:50]
 	}
 
 	// If result is empty after cleaning, return "UNKNOWN"
 	if result == "" {
-		return "UNKNOWN"
+		result = "UNKNOWN"
 	}
 
-	return result
+	return rules.fallback(result)
+}
+
+// inferApplicationProtocol infers the application protocol from the ports of a threat through
+// the service-name registry: the destination port first, then a well-known source port, which
+// is the service side of replies
+func (p *PostgreSQLClient) inferApplicationProtocol(threat *NormalizedThreat) RuleMatch {
+	if threat.Protocol != "" {
+		if _, hasPorts := portTransports[threat.Protocol]; !hasPorts {
+			return RuleMatch{}
+		}
+	}
+
+	var ports []int
+	if threat.DestinationPort != nil {
+		ports = append(ports, *threat.DestinationPort)
+	}
+	if threat.SourcePort != nil && *threat.SourcePort < 1024 {
+		ports = append(ports, *threat.SourcePort)
+	}
+
+	for _, port := range ports {
+		service, ok := p.services.Service(threat.Protocol, port)
+		if !ok {
+			continue
+		}
+		// Give registry names such as "domain" their usual names through the application rules
+		name := strings.ToUpper(service)
+		if match, ok := p.rules.Rules().ApplicationProtocol.match(name); ok && match.Kind == MatchAlias {
+			name = match.Value
+		}
+		if len(name) > 50 {
+			name = name[:50]
+		}
+		return RuleMatch{Value: name, Kind: MatchPort, Rule: fmt.Sprintf("%s/%d", service, port), Confidence: 0.5}
+	}
+	return RuleMatch{}
 }
 
 // normalizeMalwareFamily normalizes malware family names
 func (p *PostgreSQLClient) normalizeMalwareFamily(family string) string {
+	return p.matchMalwareFamily(family).Value
+}
+
+// matchMalwareFamily normalizes a malware family and reports which rule produced the value
+func (p *PostgreSQLClient) matchMalwareFamily(family string) RuleMatch {
 	if family == "" {
-		return ""
+		return RuleMatch{}
 	}
 
 	// Sanitize string first
@@ -961,7 +883,7 @@ func (p *PostgreSQLClient) normalizeMalwareFamily(family string) string {
 	// Trim whitespace
 	normalized := strings.TrimSpace(family)
 	if normalized == "" {
-		return ""
+		return RuleMatch{}
 	}
 
 	// Remove common unwanted characters and clean up
@@ -977,68 +899,10 @@ func (p *PostgreSQLClient) normalizeMalwareFamily(family string) string {
 	// Convert to lowercase for consistency
 	normalized = strings.ToLower(normalized)
 
-	// Map common malware family variations to standard names
-	malwareFamilyMap := map[string]string{
-		"trojan":               "trojan",
-		"backdoor":             "backdoor",
-		"rootkit":              "rootkit",
-		"worm":                 "worm",
-		"virus":                "virus",
-		"ransomware":           "ransomware",
-		"spyware":              "spyware",
-		"adware":               "adware",
-		"keylogger":            "keylogger",
-		"botnet":               "botnet",
-		"rat":                  "rat",
-		"remote access":        "rat",
-		"banking":              "banking_trojan",
-		"banker":               "banking_trojan",
-		"infostealer":          "infostealer",
-		"info stealer":         "infostealer",
-		"stealer":              "infostealer",
-		"downloader":           "downloader",
-		"dropper":              "dropper",
-		"loader":               "loader",
-		"cryptominer":          "cryptominer",
-		"miner":                "cryptominer",
-		"coinminer":            "cryptominer",
-		"fileless":             "fileless",
-		"apt":                  "apt",
-		"advanced persistent":  "apt",
-		"exploit kit":          "exploit_kit",
-		"exploit":              "exploit",
-		"zero day":             "zero_day",
-		"0day":                 "zero_day",
-		"polymorphic":          "polymorphic",
-		"metamorphic":          "metamorphic",
-		"packed":               "packed",
-		"obfuscated":           "obfuscated",
-		"webshell":             "webshell",
-		"web shell":            "webshell",
-		"shell":                "webshell",
-		"phishing":             "phishing",
-		"scareware":            "scareware",
-		"fake av":              "fake_antivirus",
-		"fake antivirus":       "fake_antivirus",
-		"rogue":                "rogue",
-		"pup":                  "pup",
-		"potentially unwanted": "pup",
-		"greyware":             "greyware",
-		"suspicious":           "suspicious",
-		"generic":              "generic",
-		"heuristic":            "heuristic",
-	}
-
-	// Check for exact matches first
-	if standardName, exists := malwareFamilyMap[normalized]; exists {
-		return standardName
-	}
-
-	// Check for partial matches
-	for key, value := range malwareFamilyMap {
-		if strings.Contains(normalized, key) {
-			return value
-		}
+	// Map malware family variations to standard names with the active rules
+	rules := p.rules.Rules().MalwareFamily
+	if match, ok := rules.match(normalized); ok {
+		return match
 	}
 
 	// Clean the family name by removing special characters except alphanumeric, spaces, hyphens, and underscores
@@ -1061,20 +925,45 @@ func (p *PostgreSQLClient) normalizeMalwareFamily(family string) string {
 
 	// If result is empty after cleaning, return "unknown"
 	if result == "" {
-		return "unknown"
+		result = "unknown"
 	}
 
-	return result
+	return rules.fallback(result)
 }
 
-// TransformDocument transforms a MongoDB document to a PostgreSQL record
-func (p *PostgreSQLClient) TransformDocument(doc ThreatDocument) (*ThreatRecord, error) {
-	id := uuid.New()
-
-	// Debug: Log the raw document data BEFORE sanitization
-	// log.Printf("DEBUG: Raw document %s - DestAddr: '%s', DestCountry: '%s'",
-	// 	doc.ID.Hex(), doc.OptionalInformation.DestinationAddress, doc.OptionalInformation.DestinationCountry)
+// NormalizedThreat holds the normalized values of a document before lookup IDs are resolved
+type NormalizedThreat struct {
+	ID                     uuid.UUID
+	Timestamp              time.Time
+	SourceAddress          net.IP
+	ASN                    string // asplain display form, e.g. "AS13335"
+	ASNumber               ASN    // 0 if the ASN is not an AS number
+	ASNInfo                string
+	Category               string
+	SourceCountry          string // ISO alpha-2 code, empty if absent
+	SourceCountryName      string
+	DestinationAddress     *net.IP
+	DestinationCountry     string // ISO alpha-2 code, empty if absent
+	DestinationCountryName string
+	SourcePort             *int
+	DestinationPort        *int
+	Protocol               string // IANA transport protocol keyword, empty if absent
+	ApplicationProtocol    string // given or inferred from the ports, empty if unknown
+	MalwareFamily          string
+	CreatedAt              time.Time
+	UpdatedAt              time.Time
+
+	// How each normalized value was matched by the rules
+	CategoryMatch            RuleMatch
+	SourceCountryMatch       RuleMatch
+	DestinationCountryMatch  RuleMatch
+	ProtocolMatch            RuleMatch
+	ApplicationProtocolMatch RuleMatch
+	MalwareFamilyMatch       RuleMatch
+}
 
+// NormalizeDocument sanitizes and normalizes a MongoDB document without touching the database
+func (p *PostgreSQLClient) NormalizeDocument(doc ThreatDocument) (*NormalizedThreat, error) {
 	// Sanitize all string fields first to prevent UTF-8 encoding issues
 	doc.ASN = sanitizeUTF8String(doc.ASN)
 	doc.ASNInfo = sanitizeUTF8String(doc.ASNInfo)
@@ -1100,16 +989,10 @@ func (p *PostgreSQLClient) TransformDocument(doc ThreatDocument) (*ThreatRecord,
 		return nil, fmt.Errorf("invalid source IP address '%s': %w", doc.SourceAddress, err)
 	}
 
-	// Normalize and get ASN ID (required field)
-	normalizedASN := p.normalizeASN(doc.ASN)
-	normalizedASNInfo := p.normalizeASNInfo(doc.ASNInfo)
-	asnUUID, err := p.GetOrCreateAsnID(normalizedASN, normalizedASNInfo)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get ASN ID for '%s': %w", normalizedASN, err)
-	}
-
 	// Normalize category (required field)
-	normalizedCategory := p.normalizeCategory(doc.Category)
+	categoryMatch := p.matchCategory(doc.Category)
+	p.rules.Observe("category", categoryMatch)
+	normalizedCategory := categoryMatch.Value
 	if normalizedCategory == "" {
 		return nil, fmt.Errorf("category cannot be empty after normalization")
 	}
@@ -1125,62 +1008,59 @@ func (p *PostgreSQLClient) TransformDocument(doc ThreatDocument) (*ThreatRecord,
 		updatedAt = time.Now()
 	}
 
-	record := &ThreatRecord{
-		ID:            id,
+	threat := &NormalizedThreat{
+		// Derive the ID from the source ObjectID so re-migrating a document hits the same row
+		ID:            ThreatEventID(doc.ID),
 		Timestamp:     doc.Timestamp,
-		AsnRegistryID: asnUUID,
 		SourceAddress: sourceIP,
+		ASNInfo:       p.normalizeASNInfo(doc.ASNInfo),
 		Category:      normalizedCategory,
 		CreatedAt:     createdAt,
 		UpdatedAt:     updatedAt,
+		CategoryMatch: categoryMatch,
+	}
+
+	// Parse the ASN; a description written after the number stands in for a missing ASN info
+	var asnDescription string
+	threat.ASN, threat.ASNumber, asnDescription = p.parseASN(doc.ASN)
+	if threat.ASNumber == 0 && threat.ASN != "" {
+		log.Printf("Warning: ASN '%s' for document %s is not an AS number", doc.ASN, doc.SourceIDString())
+	}
+	if asnDescription != "" && strings.TrimSpace(doc.ASNInfo) == "" {
+		threat.ASNInfo = p.normalizeASNInfo(asnDescription)
 	}
 
 	// Handle optional source country
 	if doc.SourceCountry != "" {
-		normalizedCountryCode := p.normalizeCountryCode(doc.SourceCountry)
-		if normalizedCountryCode != "" {
-			countryID, err := p.GetOrCreateCountryID(normalizedCountryCode, doc.SourceCountry)
-			if err != nil {
-				return nil, fmt.Errorf("failed to get source country ID for '%s': %w", normalizedCountryCode, err)
-			}
-			record.SourceCountryID = &countryID
+		threat.SourceCountryMatch = p.matchCountry(doc.SourceCountry)
+		p.rules.Observe("country", threat.SourceCountryMatch)
+		threat.SourceCountry, threat.SourceCountryName = resolveCountry(threat.SourceCountryMatch)
+		if threat.SourceCountry == "" {
+			log.Printf("Warning: unresolvable source country '%s' for document %s", doc.SourceCountry, doc.SourceIDString())
 		}
 	}
 
 	// Handle optional destination address with validation
 	if doc.OptionalInformation.DestinationAddress != "" {
-		// log.Printf("DEBUG: Processing destination address: '%s' for document %s",
-		// doc.OptionalInformation.DestinationAddress, doc.ID.Hex())
 		destIP, err := p.parseAndValidateIPAddress(doc.OptionalInformation.DestinationAddress)
 		if err != nil {
 			// Log warning but don't fail the entire record
 			log.Printf("Warning: invalid destination IP address '%s' for document %s: %v",
-				doc.OptionalInformation.DestinationAddress, doc.ID.Hex(), err)
+				doc.OptionalInformation.DestinationAddress, doc.SourceIDString(), err)
 		} else {
-			record.DestinationAddress = &destIP
-			// log.Printf("DEBUG: Successfully set destination address: %s", destIP.String())
+			threat.DestinationAddress = &destIP
 		}
-	} else {
-		// log.Printf("DEBUG: No destination address found for document %s", doc.ID.Hex())
 	}
 
 	// Handle optional destination country
 	if doc.OptionalInformation.DestinationCountry != "" {
-		// log.Printf("DEBUG: Processing destination country: '%s' for document %s",
-		// 	doc.OptionalInformation.DestinationCountry, doc.ID.Hex())
-		normalizedCountryCode := p.normalizeCountryCode(doc.OptionalInformation.DestinationCountry)
-		if normalizedCountryCode != "" {
-			countryID, err := p.GetOrCreateCountryID(normalizedCountryCode, doc.OptionalInformation.DestinationCountry)
-			if err != nil {
-				return nil, fmt.Errorf("failed to get destination country ID for '%s': %w", normalizedCountryCode, err)
-			}
-			record.DestinationCountryID = &countryID
-			// log.Printf("DEBUG: Successfully set destination country ID: %d", countryID)
-		} else {
-			// log.Printf("DEBUG: Country normalization returned empty for: '%s'", doc.OptionalInformation.DestinationCountry)
+		threat.DestinationCountryMatch = p.matchCountry(doc.OptionalInformation.DestinationCountry)
+		p.rules.Observe("country", threat.DestinationCountryMatch)
+		threat.DestinationCountry, threat.DestinationCountryName = resolveCountry(threat.DestinationCountryMatch)
+		if threat.DestinationCountry == "" {
+			log.Printf("Warning: unresolvable destination country '%s' for document %s",
+				doc.OptionalInformation.DestinationCountry, doc.SourceIDString())
 		}
-	} else {
-		// log.Printf("DEBUG: No destination country found for document %s", doc.ID.Hex())
 	}
 
 	// Handle optional source port with validation
@@ -1188,9 +1068,9 @@ func (p *PostgreSQLClient) TransformDocument(doc ThreatDocument) (*ThreatRecord,
 		port, err := p.parseAndValidatePort(doc.OptionalInformation.SourcePort)
 		if err != nil {
 			log.Printf("Warning: invalid source port '%s' for document %s: %v",
-				doc.OptionalInformation.SourcePort, doc.ID.Hex(), err)
+				doc.OptionalInformation.SourcePort, doc.SourceIDString(), err)
 		} else {
-			record.SourcePort = &port
+			threat.SourcePort = &port
 		}
 	}
 
@@ -1199,37 +1079,46 @@ func (p *PostgreSQLClient) TransformDocument(doc ThreatDocument) (*ThreatRecord,
 		port, err := p.parseAndValidatePort(doc.OptionalInformation.DestinationPort)
 		if err != nil {
 			log.Printf("Warning: invalid destination port '%s' for document %s: %v",
-				doc.OptionalInformation.DestinationPort, doc.ID.Hex(), err)
+				doc.OptionalInformation.DestinationPort, doc.SourceIDString(), err)
 		} else {
-			record.DestinationPort = &port
+			threat.DestinationPort = &port
 		}
 	}
 
-	// Handle optional protocol with normalization
+	// Handle optional protocol with normalization: the value names a transport protocol, an
+	// application protocol, or both ("tcp/http")
 	if doc.OptionalInformation.Protocol != "" {
-		normalizedProtocol := p.normalizeProtocol(doc.OptionalInformation.Protocol)
-		if normalizedProtocol != "" {
-			protocolID, err := p.GetOrCreateProtocolID(normalizedProtocol)
-			if err != nil {
-				return nil, fmt.Errorf("failed to get protocol ID for '%s': %w", normalizedProtocol, err)
-			}
-			record.ProtocolID = &protocolID
-		}
+		threat.ProtocolMatch = p.matchProtocol(doc.OptionalInformation.Protocol)
+		p.rules.Observe("protocol", threat.ProtocolMatch)
+		threat.Protocol = threat.ProtocolMatch.Value
+
+		threat.ApplicationProtocolMatch = p.matchApplicationProtocol(doc.OptionalInformation.Protocol)
+		threat.ApplicationProtocol = threat.ApplicationProtocolMatch.Value
+	}
+
+	// Infer the service from the ports when the document does not name one
+	if threat.ApplicationProtocol == "" {
+		threat.ApplicationProtocolMatch = p.inferApplicationProtocol(threat)
+		threat.ApplicationProtocol = threat.ApplicationProtocolMatch.Value
+	}
+	if threat.ApplicationProtocol != "" {
+		p.rules.Observe("application_protocol", threat.ApplicationProtocolMatch)
 	}
 
 	// Handle optional malware family with normalization
 	if doc.OptionalInformation.Family != "" {
-		normalizedFamily := p.normalizeMalwareFamily(doc.OptionalInformation.Family)
-		if normalizedFamily != "" {
-			familyID, err := p.GetOrCreateMalwareFamilyID(normalizedFamily)
-			if err != nil {
-				return nil, fmt.Errorf("failed to get malware family ID for '%s': %w", normalizedFamily, err)
-			}
-			record.MalwareFamilyID = &familyID
-		}
+		threat.MalwareFamilyMatch = p.matchMalwareFamily(doc.OptionalInformation.Family)
+		p.rules.Observe("malware_family", threat.MalwareFamilyMatch)
+		threat.MalwareFamily = threat.MalwareFamilyMatch.Value
 	}
 
-	return record, nil
+	return threat, nil
+}
+
+// TransformDocument transforms a MongoDB document to a PostgreSQL record
+func (p *PostgreSQLClient) TransformDocument(doc ThreatDocument) (*ThreatRecord, error) {
+	records, errs := p.TransformDocuments(context.Background(), []ThreatDocument{doc})
+	return records[0], errs[0]
 }
 
 // sanitizeUTF8String removes null bytes and other problematic characters that cause PostgreSQL UTF-8 errors
@@ -1265,75 +1154,6 @@ func sanitizeUTF8String(s string) string {
 	return result
 }
 
-// getOrCreateUUID is a generic helper used for dynamic lookup table population (Approach A)
-func (p *PostgreSQLClient) getOrCreateUUID(table, keyColumn, value string, extra map[string]string) (uuid.UUID, error) {
-	value = strings.TrimSpace(value)
-	if value == "" {
-		return uuid.Nil, fmt.Errorf("%s value cannot be empty", keyColumn)
-	}
-
-	// Try select first
-	selectSQL := fmt.Sprintf(`SELECT "Id" FROM "%s" WHERE "%s" = $1`, table, keyColumn)
-	var existing uuid.UUID
-	err := p.db.QueryRow(selectSQL, value).Scan(&existing)
-	if err == nil {
-		return existing, nil
-	}
-	if err != nil && err != sql.ErrNoRows { // retain check
-		return uuid.Nil, fmt.Errorf("lookup %s.%s failed: %w", table, keyColumn, err)
-	}
-
-	// Build insert (ensure CreatedAt present due to NOT NULL constraint in EF model)
-	newID := uuid.New()
-	columns := []string{`"Id"`, fmt.Sprintf(`"%s"`, keyColumn), `"CreatedAt"`}
-	createdAt := time.Now().UTC()
-	args := []any{newID, value, createdAt}
-
-	if extra == nil {
-		extra = map[string]string{}
-	}
-	// Prevent caller from overriding CreatedAt accidentally
-	delete(extra, "CreatedAt")
-
-	if len(extra) > 0 {
-		keys := make([]string, 0, len(extra))
-		for k := range extra {
-			keys = append(keys, k)
-		}
-		sort.Strings(keys)
-		for _, k := range keys {
-			columns = append(columns, fmt.Sprintf(`"%s"`, k))
-			args = append(args, extra[k])
-		}
-	}
-
-	placeholders := make([]string, len(columns))
-	for i := range placeholders {
-		placeholders[i] = fmt.Sprintf("$%d", i+1)
-	}
-
-	insertSQL := fmt.Sprintf(`INSERT INTO "%s" (%s) VALUES (%s) ON CONFLICT ("%s") DO NOTHING RETURNING "Id"`,
-		table,
-		strings.Join(columns, ","),
-		strings.Join(placeholders, ","),
-		keyColumn,
-	)
-
-	// Try insert (with RETURNING). If DO NOTHING triggered, we must re-select.
-	err = p.db.QueryRow(insertSQL, args...).Scan(&existing)
-	if err == sql.ErrNoRows {
-		// Conflict path, reselect
-		if e2 := p.db.QueryRow(selectSQL, value).Scan(&existing); e2 != nil {
-			return uuid.Nil, fmt.Errorf("post-conflict select %s.%s failed: %w", table, keyColumn, e2)
-		}
-		return existing, nil
-	}
-	if err != nil {
-		return uuid.Nil, fmt.Errorf("insert %s.%s failed: %w", table, keyColumn, err)
-	}
-	return existing, nil
-}
-
 func min(a, b int) int {
 	if a < b {
 		return a
@@ -1346,3 +1166,9 @@ func max(a, b int) int {
 	}
 	return b
 }
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
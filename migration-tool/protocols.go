@@ -0,0 +1,304 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Transport protocols come from the IANA protocol-numbers registry; application protocols
+// (the services running over them) from the IANA service-name and port-number registry.
+
+//go:embed data/protocol-numbers.csv
+var protocolNumbersCSV string
+
+//go:embed data/service-names.csv
+var serviceNamesCSV string
+
+// IPProtocol is an entry of the IANA protocol-numbers registry
+type IPProtocol struct {
+	Number  int
+	Keyword string // uppercased, empty for unassigned numbers
+	Name    string
+}
+
+// CanonicalName is the name stored in Protocols: the keyword, or PROTO_<number> for numbers
+// without one
+func (p IPProtocol) CanonicalName() string {
+	if p.Keyword == "" {
+		return fmt.Sprintf("PROTO_%d", p.Number)
+	}
+	return p.Keyword
+}
+
+// ipProtocolRegistry indexes the protocol-numbers registry by number and keyword
+type ipProtocolRegistry struct {
+	byNumber  [256]*IPProtocol
+	byKeyword map[string]*IPProtocol
+}
+
+// readCSVColumns reads a CSV file with a header row and returns each record as a map keyed by
+// the given column names. Other columns are ignored, so the full IANA files can be used as is.
+func readCSVColumns(r io.Reader, columns ...string) ([]map[string]string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+
+	positions := make(map[string]int, len(columns))
+	for i, name := range header {
+		positions[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+	}
+	for _, column := range columns {
+		if _, ok := positions[column]; !ok {
+			return nil, fmt.Errorf("CSV has no %q column", column)
+		}
+	}
+
+	var records []map[string]string
+	for {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		record := make(map[string]string, len(columns))
+		for _, column := range columns {
+			if i := positions[column]; i < len(fields) {
+				record[column] = strings.TrimSpace(fields[i])
+			}
+		}
+		records = append(records, record)
+	}
+}
+
+// parseRange parses a number or an inclusive "from-to" range
+func parseRange(value string) (from, to int, err error) {
+	low, high, isRange := strings.Cut(value, "-")
+	if from, err = strconv.Atoi(low); err != nil {
+		return 0, 0, err
+	}
+	to = from
+	if isRange {
+		if to, err = strconv.Atoi(high); err != nil {
+			return 0, 0, err
+		}
+	}
+	if to < from {
+		return 0, 0, fmt.Errorf("invalid range %q", value)
+	}
+	return from, to, nil
+}
+
+// parseProtocolNumbers parses the IANA protocol-numbers CSV
+func parseProtocolNumbers(data string) (*ipProtocolRegistry, error) {
+	records, err := readCSVColumns(strings.NewReader(data), "Decimal", "Keyword", "Protocol")
+	if err != nil {
+		return nil, err
+	}
+
+	registry := &ipProtocolRegistry{byKeyword: make(map[string]*IPProtocol)}
+	for _, record := range records {
+		from, to, err := parseRange(record["Decimal"])
+		if err != nil || to > 255 {
+			return nil, fmt.Errorf("invalid protocol number %q", record["Decimal"])
+		}
+		keyword := strings.ToUpper(strings.TrimSpace(strings.TrimSuffix(record["Keyword"], "(deprecated)")))
+		for number := from; number <= to; number++ {
+			protocol := &IPProtocol{Number: number, Keyword: keyword, Name: record["Protocol"]}
+			registry.byNumber[number] = protocol
+			if keyword != "" {
+				if _, ok := registry.byKeyword[keyword]; !ok {
+					registry.byKeyword[keyword] = protocol
+				}
+			}
+		}
+	}
+	for number, protocol := range registry.byNumber {
+		if protocol == nil {
+			registry.byNumber[number] = &IPProtocol{Number: number}
+		}
+	}
+	return registry, nil
+}
+
+var (
+	ipProtocolsOnce sync.Once
+	ipProtocols     *ipProtocolRegistry
+)
+
+// ipProtocolData returns the embedded protocol-numbers registry
+func ipProtocolData() *ipProtocolRegistry {
+	ipProtocolsOnce.Do(func() {
+		registry, err := parseProtocolNumbers(protocolNumbersCSV)
+		if err != nil {
+			panic(fmt.Sprintf("embedded IANA protocol-numbers registry is invalid: %v", err))
+		}
+		ipProtocols = registry
+	})
+	return ipProtocols
+}
+
+// LookupIPProtocol resolves a protocol number (0-255) or an IANA keyword, case-insensitively
+func LookupIPProtocol(value string) (IPProtocol, bool) {
+	value = strings.TrimSpace(value)
+	registry := ipProtocolData()
+	if isDigits(value) {
+		number, err := strconv.Atoi(value)
+		if err != nil || number > 255 {
+			return IPProtocol{}, false
+		}
+		return *registry.byNumber[number], true
+	}
+	if protocol, ok := registry.byKeyword[strings.ToUpper(value)]; ok {
+		return *protocol, true
+	}
+	return IPProtocol{}, false
+}
+
+// isIPProtocolName reports whether name is the canonical name of a protocol number
+func isIPProtocolName(name string) bool {
+	if protocol, ok := LookupIPProtocol(name); ok && !isDigits(name) {
+		return protocol.Keyword == name
+	}
+	if number, ok := strings.CutPrefix(name, "PROTO_"); ok && isDigits(number) {
+		protocol, ok := LookupIPProtocol(number)
+		return ok && protocol.Keyword == ""
+	}
+	return false
+}
+
+// portTransports are the transport protocols with ports, as named in the service registry
+var portTransports = map[string]string{"TCP": "tcp", "UDP": "udp", "SCTP": "sctp", "DCCP": "dccp"}
+
+// servicePort is a port of one transport protocol
+type servicePort struct {
+	transport string
+	port      int
+}
+
+// ServiceRegistry maps ports to the service names registered for them
+type ServiceRegistry struct {
+	Source string
+	ports  map[servicePort]string
+	names  map[string]bool
+}
+
+// ParseServiceNames parses a service-name registry in the IANA service-names-port-numbers CSV
+// format. The first service listed for a port is the one inferred for it.
+func ParseServiceNames(r io.Reader, source string) (*ServiceRegistry, error) {
+	records, err := readCSVColumns(r, "Service Name", "Port Number", "Transport Protocol")
+	if err != nil {
+		return nil, fmt.Errorf("invalid service-name registry %s: %w", source, err)
+	}
+
+	registry := &ServiceRegistry{Source: source, ports: make(map[servicePort]string), names: make(map[string]bool)}
+	for _, record := range records {
+		name := strings.ToLower(record["Service Name"])
+		transport := strings.ToLower(record["Transport Protocol"])
+		if name == "" || record["Port Number"] == "" || transport == "" {
+			continue // Reserved and unassigned ports
+		}
+		from, to, err := parseRange(record["Port Number"])
+		if err != nil || to > 65535 {
+			return nil, fmt.Errorf("invalid service-name registry %s: service %s has invalid port %q", source, name, record["Port Number"])
+		}
+		registry.names[name] = true
+		for port := from; port <= to; port++ {
+			key := servicePort{transport, port}
+			if _, ok := registry.ports[key]; !ok {
+				registry.ports[key] = name
+			}
+		}
+	}
+	if len(registry.ports) == 0 {
+		return nil, fmt.Errorf("service-name registry %s has no services", source)
+	}
+	return registry, nil
+}
+
+// LoadServiceNames reads a service-name registry CSV, such as the full
+// service-names-port-numbers.csv published by IANA
+func LoadServiceNames(path string) (*ServiceRegistry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open service-name registry: %w", err)
+	}
+	defer file.Close()
+	return ParseServiceNames(file, path)
+}
+
+var (
+	defaultServicesOnce sync.Once
+	defaultServices     *ServiceRegistry
+)
+
+// DefaultServiceNames returns the embedded service-name registry, the IANA services in
+// common use
+func DefaultServiceNames() *ServiceRegistry {
+	defaultServicesOnce.Do(func() {
+		registry, err := ParseServiceNames(strings.NewReader(serviceNamesCSV), "built-in")
+		if err != nil {
+			panic(fmt.Sprintf("embedded service-name registry is invalid: %v", err))
+		}
+		defaultServices = registry
+	})
+	return defaultServices
+}
+
+// loadServiceRegistry loads the service-name registry at path, or returns the embedded one if
+// path is empty
+func loadServiceRegistry(path string) (*ServiceRegistry, error) {
+	if path == "" {
+		return DefaultServiceNames(), nil
+	}
+	registry, err := LoadServiceNames(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load service names: %w", err)
+	}
+	log.Printf("Using service-name registry %s (%d ports)", registry.Source, len(registry.ports))
+	return registry, nil
+}
+
+// registry returns s, or the embedded registry if s is nil
+func (s *ServiceRegistry) registry() *ServiceRegistry {
+	if s == nil {
+		return DefaultServiceNames()
+	}
+	return s
+}
+
+// Known reports whether name is a registered service name
+func (s *ServiceRegistry) Known(name string) bool {
+	return s.registry().names[strings.ToLower(name)]
+}
+
+// Service returns the service registered for port over transport (a Protocols name such as
+// TCP). Without a transport, TCP and then UDP are tried.
+func (s *ServiceRegistry) Service(transport string, port int) (string, bool) {
+	registry := s.registry()
+	if transport == "" {
+		for _, candidate := range []string{"tcp", "udp"} {
+			if name, ok := registry.ports[servicePort{candidate, port}]; ok {
+				return name, true
+			}
+		}
+		return "", false
+	}
+	candidate, ok := portTransports[transport]
+	if !ok {
+		return "", false
+	}
+	name, ok := registry.ports[servicePort{candidate, port}]
+	return name, ok
+}
@@ -4,15 +4,18 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"strings"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-// All migration progress tracking is now based on counting existing records in PostgreSQL
+// Migration progress is tracked by the source position just after the last document handed to
+// the pipeline (the _id of that document for MongoDB). Since sources are read in a stable order,
+// resuming after that position picks up exactly where the previous run stopped.
 
-// GetLastProcessedObjectID converts the last processed ID string to ObjectID (kept for compatibility)
+// GetLastProcessedObjectID converts the last processed ID string to ObjectID
 func GetLastProcessedObjectID(lastProcessedID string) (primitive.ObjectID, error) {
 	if lastProcessedID == "" {
 		return primitive.NilObjectID, nil
@@ -26,116 +29,116 @@ func GetLastProcessedObjectID(lastProcessedID string) (primitive.ObjectID, error
 	return objectID, nil
 }
 
-// ReadDocumentsBatchWithSkip reads documents starting from a specific skip count
-func (m *MongoDBClient) ReadDocumentsBatchWithSkip(ctx context.Context, batchSize int, skip int64) ([]ThreatDocument, error) {
-	filter := bson.M{}
-
-	options := options.Find().
-		SetLimit(int64(batchSize)).
-		SetSkip(skip).
-		SetSort(bson.D{{Key: "_id", Value: 1}}) // Sort by _id for consistent ordering
-
-	cursor, err := m.collection.Find(ctx, filter, options)
+// mongoPosition is the MongoDB position after the document with the given _id: the hex
+// ObjectID, or for _id values of other types (kept by lenient decoding) the _id as a canonical
+// extended JSON document, so its type survives the checkpoint
+func mongoPosition(id bson.RawValue) string {
+	switch id.Type {
+	case 0:
+		return ""
+	case bsontype.ObjectID:
+		return id.ObjectID().Hex()
+	}
+	data, err := bson.MarshalExtJSON(bson.D{{Key: "_id", Value: id}}, true, false)
 	if err != nil {
-		return nil, fmt.Errorf("failed to find documents: %w", err)
+		return id.String()
 	}
-	defer cursor.Close(ctx)
-
-	var documents []ThreatDocument
-	for cursor.Next(ctx) {
-		var doc ThreatDocument
-		if err := cursor.Decode(&doc); err != nil {
-			log.Printf("Warning: failed to decode document: %v", err)
-			continue // Skip malformed documents
+	return string(data)
+}
+
+// parseMongoPosition returns the _id in a position written by mongoPosition; an empty position
+// gives the zero value
+func parseMongoPosition(position string) (bson.RawValue, error) {
+	if !strings.HasPrefix(position, "{") {
+		objectID, err := GetLastProcessedObjectID(position)
+		if err != nil || objectID.IsZero() {
+			return bson.RawValue{}, err
 		}
-		documents = append(documents, doc)
+		return bson.RawValue{Type: bsontype.ObjectID, Value: objectID[:]}, nil
 	}
 
-	if err := cursor.Err(); err != nil {
-		return nil, fmt.Errorf("cursor error: %w", err)
+	var doc bson.Raw
+	if err := bson.UnmarshalExtJSON([]byte(position), true, &doc); err != nil {
+		return bson.RawValue{}, fmt.Errorf("invalid _id position %q: %w", position, err)
 	}
-
-	return documents, nil
-}
-
-// GetExistingRecordCount returns the count of existing records in PostgreSQL
-func (p *PostgreSQLClient) GetExistingRecordCount() (int64, error) {
-	var count int64
-	// Fixed table name to match PascalCase schema
-	err := p.db.QueryRow(`SELECT COUNT(*) FROM "ThreatEvents"`).Scan(&count)
+	id, err := doc.LookupErr("_id")
 	if err != nil {
-		return 0, fmt.Errorf("failed to count existing records: %w", err)
+		return bson.RawValue{}, fmt.Errorf("invalid _id position %q: no _id", position)
 	}
-	return count, nil
+	return id, nil
 }
 
-// ReadAllDocumentsWithResume reads all documents with simple count-based resume
-func (m *MongoDBClient) ReadAllDocumentsWithResume(ctx context.Context, batchSize int, documentChan chan<- []ThreatDocument, migrationName string, postgresClient *PostgreSQLClient, progressTracker *ProgressTracker) error {
+// ReadAllDocumentsWithResume reads all documents of source, starting after the checkpoint's position.
+// batchSize is consulted before every read so the batch size can be tuned while reading, and
+// ready blocks while the pipeline is paused; it returns false once ctx is cancelled.
+func ReadAllDocumentsWithResume(ctx context.Context, source Source, batchSize func() int, ready func(context.Context) bool, documentChan chan<- SourceBatch, checkpoint *CheckpointTracker, progressTracker *ProgressTracker) error {
 	defer close(documentChan)
 
-	log.Println("Checking existing records in PostgreSQL...")
-	// Get existing record count from PostgreSQL first (this is fast)
-	existingCount, err := postgresClient.GetExistingRecordCount()
-	if err != nil {
-		return fmt.Errorf("failed to get existing record count: %w", err)
-	}
-	log.Printf("Found %d existing records in PostgreSQL", existingCount)
+	migrationName := checkpoint.Name()
+	position := checkpoint.LastProcessedID()
 
 	// Use estimated count for total (much faster than exact count)
-	log.Println("Getting estimated total document count from MongoDB...")
-	totalCount, err := m.collection.EstimatedDocumentCount(ctx)
+	log.Printf("Getting estimated total document count from %s...", source.Name())
+	totalCount, err := source.EstimatedCount(ctx)
 	if err != nil {
-		log.Printf("Estimated count failed, using fallback: %v", err)
-		totalCount = 25121993 // Use known total as fallback
+		log.Printf("Estimated count failed, progress is reported without a total: %v", err)
+		totalCount = 0
 	}
 	log.Printf("Total documents to process: %d", totalCount)
+	checkpoint.SetTotal(totalCount)
 
-	// Update progress tracker total
+	readCount := checkpoint.ProcessedCount()
+
+	// Progress for this run only covers what is left after the checkpoint
 	if progressTracker != nil {
-		progressTracker.SetTotal(totalCount)
+		progressTracker.SetTotal(max64(totalCount-readCount, 0))
 	}
 
-	if existingCount > 0 {
-		log.Printf("🔄 RESUMING migration from count: %d/%d (%.2f%%) already processed",
-			existingCount, totalCount, float64(existingCount)/float64(totalCount)*100)
+	if position != "" {
+		log.Printf("🔄 RESUMING migration %s after %s (%d/%d documents already committed)",
+			migrationName, position, readCount, totalCount)
 	} else {
-		log.Printf("🚀 STARTING new migration of %d documents", totalCount)
+		log.Printf("🚀 STARTING new migration %s of %d documents", migrationName, totalCount)
 	}
 
-	currentSkip := existingCount // Start from where we left off
-
-	for currentSkip < totalCount {
-		select {
-		case <-ctx.Done():
+	for {
+		if !ready(ctx) {
 			return ctx.Err()
-		default:
 		}
 
-		batch, err := m.ReadDocumentsBatchWithSkip(ctx, batchSize, currentSkip)
+		batch, next, err := source.ReadBatch(ctx, position, batchSize())
 		if err != nil {
-			return fmt.Errorf("failed to read batch at skip %d: %w", currentSkip, err)
+			return fmt.Errorf("failed to read batch after %q: %w", position, err)
 		}
 
 		if len(batch) == 0 {
-			log.Printf("No more documents found at skip %d", currentSkip)
+			log.Printf("No more documents found after %q", position)
 			break
 		}
 
+		// Advance the position and register the batch before handing it off,
+		// so the checkpoint knows about it before any worker can complete it
+		position = next
+		checkpoint.Register(position, len(batch))
+
 		select {
-		case documentChan <- batch:
+		case documentChan <- SourceBatch{Documents: batch, Position: position}:
 		case <-ctx.Done():
 			return ctx.Err()
 		}
 
-		// Update progress tracking
-		currentSkip += int64(len(batch))
+		readCount += int64(len(batch))
 
 		// Log progress every batch
-		progress := float64(currentSkip) / float64(totalCount) * 100
-		log.Printf("📖 Read progress: %.2f%% (%d/%d documents), Skip: %d",
-			progress, currentSkip, totalCount, currentSkip)
+		if totalCount > 0 {
+			progress := float64(readCount) / float64(totalCount) * 100
+			log.Printf("📖 Read progress: %.2f%% (%d/%d documents), Last position: %s",
+				progress, readCount, totalCount, position)
+		} else {
+			log.Printf("📖 Read progress: %d documents, Last position: %s", readCount, position)
+		}
 	}
 
-	log.Printf("✅ Migration reading completed: %d documents processed", currentSkip)
+	log.Printf("✅ Migration reading completed: %d documents processed", readCount)
 	return nil
 }
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/lib/pq"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrorClass groups errors by how they should be retried
+type ErrorClass int
+
+const (
+	ErrorClassUnknown   ErrorClass = iota // not recognised
+	ErrorClassPermanent                   // the database refused the data or statement, retrying cannot help
+	ErrorClassTransient                   // serialization failures, deadlocks, lock and resource contention
+	ErrorClassNetwork                     // connection exceptions, server shutdown, network errors and timeouts
+	ErrorClassCancelled                   // the run is stopping; neither retried nor blamed on the records
+)
+
+func (c ErrorClass) String() string {
+	switch c {
+	case ErrorClassPermanent:
+		return "permanent"
+	case ErrorClassTransient:
+		return "transient"
+	case ErrorClassNetwork:
+		return "network"
+	case ErrorClassCancelled:
+		return "cancelled"
+	default:
+		return "unknown"
+	}
+}
+
+// ErrorType returns the migration error type reported for errors of the class
+func (c ErrorClass) ErrorType() ErrorType {
+	switch c {
+	case ErrorClassPermanent, ErrorClassTransient:
+		return DatabaseError
+	case ErrorClassNetwork:
+		return NetworkError
+	default:
+		return UnknownError
+	}
+}
+
+// recordSpecific reports whether errors of the class may be caused by individual records
+func (c ErrorClass) recordSpecific() bool {
+	return c == ErrorClassPermanent || c == ErrorClassUnknown
+}
+
+// classifyError determines the class of err from PostgreSQL SQLSTATE codes, MongoDB driver
+// error labels and network errors anywhere in its chain
+func classifyError(err error) ErrorClass {
+	if err == nil {
+		return ErrorClassUnknown
+	}
+	if errors.Is(err, context.Canceled) {
+		return ErrorClassCancelled
+	}
+	if errors.Is(err, errWritesPaused) {
+		return ErrorClassNetwork
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return classifySQLState(pqErr.Code)
+	}
+
+	if mongo.IsNetworkError(err) || mongo.IsTimeout(err) {
+		return ErrorClassNetwork
+	}
+	var labeled mongo.LabeledError
+	if errors.As(err, &labeled) {
+		switch {
+		case labeled.HasErrorLabel("NetworkError"):
+			return ErrorClassNetwork
+		case labeled.HasErrorLabel("TransientTransactionError"), labeled.HasErrorLabel("RetryableWriteError"):
+			return ErrorClassTransient
+		}
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrorClassPermanent
+	}
+
+	// lib/pq reports a lost connection as driver.ErrBadConn or an unexpected EOF
+	var netErr net.Error
+	switch {
+	case errors.As(err, &netErr),
+		errors.Is(err, driver.ErrBadConn),
+		errors.Is(err, io.EOF),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.EPIPE),
+		errors.Is(err, context.DeadlineExceeded):
+		return ErrorClassNetwork
+	}
+	return ErrorClassUnknown
+}
+
+// classifySQLState classifies a PostgreSQL error by its SQLSTATE code
+// (https://www.postgresql.org/docs/current/errcodes-appendix.html)
+func classifySQLState(code pq.ErrorCode) ErrorClass {
+	switch code {
+	case "40001", // serialization_failure
+		"40P01", // deadlock_detected
+		"55P03", // lock_not_available
+		"57014": // query_canceled (statement_timeout)
+		return ErrorClassTransient
+	case "57P01", // admin_shutdown
+		"57P02", // crash_shutdown
+		"57P03": // cannot_connect_now
+		return ErrorClassNetwork
+	}
+
+	switch code.Class() {
+	case "08": // connection_exception
+		return ErrorClassNetwork
+	case "53": // insufficient_resources (too_many_connections, out_of_memory, disk_full)
+		return ErrorClassTransient
+	case "58", "XX": // system_error, internal_error
+		return ErrorClassUnknown
+	default:
+		// Data exceptions, integrity violations, syntax and access errors
+		return ErrorClassPermanent
+	}
+}
+
+// RetryPolicy is the retry behaviour for one error class. Delays grow exponentially from
+// BaseDelayMs up to MaxDelayMs, and Jitter randomizes that share of each delay.
+type RetryPolicy struct {
+	MaxAttempts int     `yaml:"max_attempts" toml:"max_attempts"`   // retries after the first attempt (0 disables retrying)
+	BaseDelayMs int     `yaml:"base_delay_ms" toml:"base_delay_ms"` // delay before the first retry
+	MaxDelayMs  int     `yaml:"max_delay_ms" toml:"max_delay_ms"`   // upper bound for any delay
+	Jitter      float64 `yaml:"jitter" toml:"jitter"`               // share of each delay that is randomized, 0..1
+}
+
+// Delay returns the wait before retry number attempt (counting from 0)
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	return backoff(time.Duration(p.BaseDelayMs)*time.Millisecond, time.Duration(p.MaxDelayMs)*time.Millisecond, attempt, p.Jitter)
+}
+
+// backoff doubles base for every attempt, caps it at maxDelay and randomizes the jitter share of it
+func backoff(base, maxDelay time.Duration, attempt int, jitter float64) time.Duration {
+	delay := base
+	for i := 0; i < attempt && (maxDelay <= 0 || delay < maxDelay); i++ {
+		delay *= 2
+	}
+	if maxDelay > 0 && delay > maxDelay {
+		delay = maxDelay
+	}
+	if jitter > 1 {
+		jitter = 1
+	}
+	if jitter > 0 && delay > 0 {
+		spread := time.Duration(float64(delay) * jitter)
+		delay = delay - spread + time.Duration(rand.Int64N(int64(spread)+1))
+	}
+	return delay
+}
+
+// retryPolicy returns the class of err and the retry policy configured for it.
+// Permanent errors and cancellations are never retried.
+func (m *MigrationTool) retryPolicy(err error) (ErrorClass, RetryPolicy) {
+	class := classifyError(err)
+	switch class {
+	case ErrorClassTransient:
+		return class, m.config.Migration.RetryTransient
+	case ErrorClassNetwork:
+		return class, m.config.Migration.RetryNetwork
+	case ErrorClassUnknown:
+		return class, m.config.Migration.RetryUnknown
+	default:
+		return class, RetryPolicy{}
+	}
+}
+
+// isRetryableError determines if an error is retryable
+func (m *MigrationTool) isRetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+	_, policy := m.retryPolicy(err)
+	return policy.MaxAttempts > 0
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestClassifySQLState(t *testing.T) {
+	tests := []struct {
+		code pq.ErrorCode
+		want ErrorClass
+	}{
+		{"40001", ErrorClassTransient}, // serialization_failure
+		{"40P01", ErrorClassTransient}, // deadlock_detected
+		{"55P03", ErrorClassTransient}, // lock_not_available
+		{"57014", ErrorClassTransient}, // query_canceled
+		{"53100", ErrorClassTransient}, // disk_full
+		{"53300", ErrorClassTransient}, // too_many_connections
+		{"57P01", ErrorClassNetwork},   // admin_shutdown
+		{"57P02", ErrorClassNetwork},   // crash_shutdown
+		{"57P03", ErrorClassNetwork},   // cannot_connect_now
+		{"08006", ErrorClassNetwork},   // connection_failure
+		{"08P01", ErrorClassNetwork},   // protocol_violation
+		{"58030", ErrorClassUnknown},   // io_error
+		{"XX000", ErrorClassUnknown},   // internal_error
+		{"22001", ErrorClassPermanent}, // string_data_right_truncation
+		{"23505", ErrorClassPermanent}, // unique_violation
+		{"23514", ErrorClassPermanent}, // check_violation
+		{"42P01", ErrorClassPermanent}, // undefined_table
+		{"57000", ErrorClassPermanent}, // operator_intervention, not one of its listed codes
+	}
+	for _, tt := range tests {
+		if got := classifySQLState(tt.code); got != tt.want {
+			t.Errorf("classifySQLState(%s) = %s, want %s", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorClass
+	}{
+		{"nil", nil, ErrorClassUnknown},
+		{"cancelled", context.Canceled, ErrorClassCancelled},
+		{"wrapped cancellation", fmt.Errorf("copy failed: %w", context.Canceled), ErrorClassCancelled},
+		{"deadline", context.DeadlineExceeded, ErrorClassNetwork},
+		{"writes paused", errWritesPaused, ErrorClassNetwork},
+		{"wrapped SQLSTATE", fmt.Errorf("copy failed: %w", &pq.Error{Code: "40P01"}), ErrorClassTransient},
+		{"refused connection", &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, ErrorClassNetwork},
+		{"reset connection", fmt.Errorf("read: %w", syscall.ECONNRESET), ErrorClassNetwork},
+		{"unexpected EOF", io.ErrUnexpectedEOF, ErrorClassNetwork},
+		{"unrecognised", errors.New("validation failed"), ErrorClassUnknown},
+	}
+	for _, tt := range tests {
+		if got := classifyError(tt.err); got != tt.want {
+			t.Errorf("classifyError(%s) = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestErrorClassRecordSpecific(t *testing.T) {
+	tests := []struct {
+		class ErrorClass
+		want  bool
+	}{
+		{ErrorClassUnknown, true},
+		{ErrorClassPermanent, true},
+		{ErrorClassTransient, false},
+		{ErrorClassNetwork, false},
+		{ErrorClassCancelled, false}, // a shutdown must not dead-letter good records
+	}
+	for _, tt := range tests {
+		if got := tt.class.recordSpecific(); got != tt.want {
+			t.Errorf("%s.recordSpecific() = %v, want %v", tt.class, got, tt.want)
+		}
+	}
+}
+
+func TestRetryPolicyNeverRetriesCancellation(t *testing.T) {
+	config := DefaultConfig()
+	config.Migration.RetryUnknown.MaxAttempts = 3
+	m := &MigrationTool{config: config}
+	if class, policy := m.retryPolicy(fmt.Errorf("insert: %w", context.Canceled)); class != ErrorClassCancelled || policy.MaxAttempts != 0 {
+		t.Errorf("retryPolicy(cancelled) = %s, %+v, want no retries", class, policy)
+	}
+}
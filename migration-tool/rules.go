@@ -0,0 +1,480 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultRulesYAML is the built-in rule set, used when no rule file is configured
+//
+//go:embed rules/default.yaml
+var defaultRulesYAML []byte
+
+// RuleFile is the on-disk form of a normalization rule set (YAML or JSON)
+type RuleFile struct {
+	Version             string    `yaml:"version" json:"version"`
+	Category            RuleTable `yaml:"category" json:"category"`
+	Country             RuleTable `yaml:"country" json:"country"`
+	Protocol            RuleTable `yaml:"protocol" json:"protocol"`
+	ApplicationProtocol RuleTable `yaml:"application_protocol" json:"application_protocol"`
+	MalwareFamily       RuleTable `yaml:"malware_family" json:"malware_family"`
+}
+
+// RuleTable maps the raw values of one field to canonical values. Aliases are tried first, then
+// patterns in order, then terms by precedence, then the fuzzy fallback.
+type RuleTable struct {
+	Aliases  map[string]string `yaml:"aliases" json:"aliases"`   // exact matches, case-insensitive
+	Patterns []PatternRule     `yaml:"patterns" json:"patterns"` // regular expressions tried in order after the aliases
+	Terms    map[string]string `yaml:"terms" json:"terms"`       // words or phrases matched on word boundaries, most words and longest first
+	Fuzzy    float64           `yaml:"fuzzy" json:"fuzzy"`       // minimum similarity of a fuzzy match to an alias or term (0 disables fuzzy matching)
+	Default  string            `yaml:"default" json:"default"`   // value for unmatched input (empty keeps the built-in fallback)
+}
+
+// PatternRule maps values matching a case-insensitive regular expression to Value, which may
+// refer to capture groups as $1
+type PatternRule struct {
+	Match string `yaml:"match" json:"match"`
+	Value string `yaml:"value" json:"value"`
+}
+
+// ruleFieldLimits caps the canonical values of each field to its database column
+var ruleFieldLimits = map[string]int{"category": 50, "country": 2, "protocol": 20, "application_protocol": 50, "malware_family": 100}
+
+// ruleMemoSize bounds the number of results memoized per field; raw values repeat a lot
+const ruleMemoSize = 10000
+
+// RuleSet is a validated, compiled rule file. It is immutable: a reload builds a new one.
+type RuleSet struct {
+	Version string
+	Source  string // file the rules were loaded from, or "built-in"
+
+	Category            *ruleTable
+	Country             *ruleTable
+	Protocol            *ruleTable
+	ApplicationProtocol *ruleTable
+	MalwareFamily       *ruleTable
+}
+
+// ruleTable is a compiled RuleTable
+type ruleTable struct {
+	aliases    map[string]string // keyed by lowercased alias
+	patterns   []compiledPattern
+	terms      []termRule // in precedence order
+	candidates []fuzzyCandidate
+	fuzzy      float64
+	def        string
+
+	memo     sync.Map
+	memoSize atomic.Int64
+}
+
+type compiledPattern struct {
+	re    *regexp.Regexp
+	match string
+	value string
+}
+
+// match returns the canonical value for value and how it was found; ok is false if nothing matched
+func (t *ruleTable) match(value string) (RuleMatch, bool) {
+	if cached, ok := t.memo.Load(value); ok {
+		match := cached.(RuleMatch)
+		return match, match.Kind != ""
+	}
+
+	match := t.resolve(value)
+	if t.memoSize.Load() < ruleMemoSize {
+		if _, loaded := t.memo.LoadOrStore(value, match); !loaded {
+			t.memoSize.Add(1)
+		}
+	}
+	return match, match.Kind != ""
+}
+
+// resolve runs the aliases, patterns, terms and fuzzy fallback in order
+func (t *ruleTable) resolve(value string) RuleMatch {
+	if canonical, ok := t.aliases[strings.ToLower(value)]; ok {
+		return RuleMatch{Value: canonical, Kind: MatchAlias, Rule: value, Confidence: 1}
+	}
+
+	tokens := tokenize(value)
+	total := tokenChars(tokens)
+	coverage := func(chars int) float64 {
+		if total == 0 {
+			return 1
+		}
+		return math.Min(1, float64(chars)/float64(total))
+	}
+
+	for _, pattern := range t.patterns {
+		if groups := pattern.re.FindStringSubmatchIndex(value); groups != nil {
+			return RuleMatch{
+				Value:      string(pattern.re.ExpandString(nil, pattern.value, value, groups)),
+				Kind:       MatchPattern,
+				Rule:       pattern.match,
+				Confidence: coverage(tokenChars(tokenize(value[groups[0]:groups[1]]))),
+			}
+		}
+	}
+
+	if term, ok := matchTerms(t.terms, tokens); ok {
+		return RuleMatch{Value: term.value, Kind: MatchTerm, Rule: term.term, Confidence: coverage(term.chars)}
+	}
+
+	if candidate, score, ok := matchFuzzy(t.candidates, tokens, t.fuzzy); ok {
+		return RuleMatch{Value: candidate.value, Kind: MatchFuzzy, Rule: candidate.key, Confidence: score}
+	}
+	return RuleMatch{}
+}
+
+// fallback is the match for a value nothing matched: the default if the field has one,
+// otherwise the built-in fallback value
+func (t *ruleTable) fallback(builtin string) RuleMatch {
+	if t.def != "" {
+		return RuleMatch{Value: t.def, Kind: MatchDefault}
+	}
+	return RuleMatch{Value: builtin, Kind: MatchNone}
+}
+
+// ParseRules decodes and validates a rule file; format is "yaml" or "json"
+func ParseRules(data []byte, format, source string) (*RuleSet, error) {
+	var file RuleFile
+	switch format {
+	case "yaml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&file); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("failed to parse rule file %s: %w", source, err)
+		}
+	case "json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&file); err != nil {
+			return nil, fmt.Errorf("failed to parse rule file %s: %w", source, err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported rule file format %q", format)
+	}
+
+	if strings.TrimSpace(file.Version) == "" {
+		return nil, fmt.Errorf("rule file %s has no version", source)
+	}
+
+	rules := &RuleSet{Version: strings.TrimSpace(file.Version), Source: source}
+	for _, field := range []struct {
+		name  string
+		table RuleTable
+		dest  **ruleTable
+	}{
+		{"category", file.Category, &rules.Category},
+		{"country", file.Country, &rules.Country},
+		{"protocol", file.Protocol, &rules.Protocol},
+		{"application_protocol", file.ApplicationProtocol, &rules.ApplicationProtocol},
+		{"malware_family", file.MalwareFamily, &rules.MalwareFamily},
+	} {
+		compiled, err := compileRuleTable(field.name, field.table)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule file %s: %w", source, err)
+		}
+		*field.dest = compiled
+	}
+	return rules, nil
+}
+
+// compileRuleTable validates the aliases, patterns and default of a field and compiles the patterns
+func compileRuleTable(field string, table RuleTable) (*ruleTable, error) {
+	compiled := &ruleTable{aliases: make(map[string]string, len(table.Aliases)), def: table.Default}
+
+	checkValue := func(what, value string) error {
+		if value == "" {
+			return fmt.Errorf("%s: %s has an empty value", field, what)
+		}
+		if limit := ruleFieldLimits[field]; len(value) > limit {
+			return fmt.Errorf("%s: %s value %q is longer than %d characters", field, what, value, limit)
+		}
+		if _, ok := CountryByCode(value); field == "country" && !ok {
+			return fmt.Errorf("%s: %s value %q is not an ISO 3166-1 alpha-2 country code", field, what, value)
+		}
+		if field == "protocol" && !isIPProtocolName(value) {
+			return fmt.Errorf("%s: %s value %q is not an uppercase IANA protocol keyword or PROTO_<number>", field, what, value)
+		}
+		return nil
+	}
+
+	for alias, value := range table.Aliases {
+		key := strings.ToLower(strings.TrimSpace(alias))
+		if key == "" {
+			return nil, fmt.Errorf("%s: empty alias", field)
+		}
+		if _, exists := compiled.aliases[key]; exists {
+			return nil, fmt.Errorf("%s: alias %q is listed twice", field, alias)
+		}
+		if err := checkValue(fmt.Sprintf("alias %q", alias), value); err != nil {
+			return nil, err
+		}
+		compiled.aliases[key] = value
+	}
+
+	for i, pattern := range table.Patterns {
+		re, err := regexp.Compile("(?i)" + pattern.Match)
+		if err != nil {
+			return nil, fmt.Errorf("%s: pattern %d %q: %w", field, i+1, pattern.Match, err)
+		}
+		// Values with capture groups are only known once expanded, so check the literal ones
+		if !strings.Contains(pattern.Value, "$") {
+			if err := checkValue(fmt.Sprintf("pattern %d", i+1), pattern.Value); err != nil {
+				return nil, err
+			}
+		} else if pattern.Value == "" {
+			return nil, fmt.Errorf("%s: pattern %d has an empty value", field, i+1)
+		}
+		compiled.patterns = append(compiled.patterns, compiledPattern{re: re, match: pattern.Match, value: pattern.Value})
+	}
+
+	seenTerms := make(map[string]bool, len(table.Terms))
+	for term, value := range table.Terms {
+		var words []string
+		for _, t := range tokenize(term) {
+			words = append(words, t.text)
+		}
+		if len(words) == 0 {
+			return nil, fmt.Errorf("%s: term %q has no words", field, term)
+		}
+		key := strings.Join(words, " ")
+		if seenTerms[key] {
+			return nil, fmt.Errorf("%s: term %q is listed twice", field, term)
+		}
+		seenTerms[key] = true
+		if err := checkValue(fmt.Sprintf("term %q", term), value); err != nil {
+			return nil, err
+		}
+		compiled.terms = append(compiled.terms, termRule{term: key, words: words, chars: len([]rune(strings.Join(words, ""))), value: value})
+	}
+	sortTerms(compiled.terms)
+
+	if table.Fuzzy < 0 || table.Fuzzy > 1 {
+		return nil, fmt.Errorf("%s: fuzzy must be between 0 and 1, got %g", field, table.Fuzzy)
+	}
+	compiled.fuzzy = table.Fuzzy
+	if compiled.fuzzy > 0 {
+		// Terms in precedence order, then aliases alphabetically, so ties resolve the same way every run
+		for _, term := range compiled.terms {
+			compiled.candidates = append(compiled.candidates, fuzzyCandidate{key: term.term, value: term.value})
+		}
+		aliases := make([]string, 0, len(compiled.aliases))
+		for alias := range compiled.aliases {
+			aliases = append(aliases, alias)
+		}
+		sort.Strings(aliases)
+		for _, alias := range aliases {
+			compiled.candidates = append(compiled.candidates, fuzzyCandidate{key: alias, value: compiled.aliases[alias]})
+		}
+	}
+
+	if table.Default != "" {
+		if err := checkValue("default", table.Default); err != nil {
+			return nil, err
+		}
+	}
+	return compiled, nil
+}
+
+// LoadRulesFile reads and validates the rule file at path, choosing the format by extension
+func LoadRulesFile(path string) (*RuleSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rule file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return ParseRules(data, "yaml", path)
+	case ".json":
+		return ParseRules(data, "json", path)
+	default:
+		return nil, fmt.Errorf("unsupported rule file format %q (use .yaml, .yml or .json)", filepath.Ext(path))
+	}
+}
+
+var (
+	defaultRulesOnce sync.Once
+	defaultRules     *RuleSet
+)
+
+// DefaultRules returns the built-in rule set
+func DefaultRules() *RuleSet {
+	defaultRulesOnce.Do(func() {
+		rules, err := ParseRules(defaultRulesYAML, "yaml", "built-in")
+		if err != nil {
+			panic(fmt.Sprintf("built-in normalization rules are invalid: %v", err))
+		}
+		defaultRules = rules
+	})
+	return defaultRules
+}
+
+// RuleStore holds the active rule set and swaps in a new one when the rule file changes.
+// A nil store serves the built-in rules.
+type RuleStore struct {
+	path   string
+	active atomic.Pointer[RuleSet]
+
+	reloads    *prometheus.CounterVec
+	info       *prometheus.GaugeVec
+	matches    *prometheus.CounterVec
+	confidence *prometheus.HistogramVec
+}
+
+// NewRuleStore loads the rule file at path, or the built-in rules if path is empty
+func NewRuleStore(path string) (*RuleStore, error) {
+	store := &RuleStore{
+		path: path,
+		reloads: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "migration_rules_reloads_total",
+			Help: "Rule file reloads by result (loaded or rejected).",
+		}, []string{"result"}),
+		info: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "migration_rules_info",
+			Help: "Version of the active normalization rule set (always 1).",
+		}, []string{"version"}),
+		matches: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "migration_normalization_matches_total",
+			Help: "Normalized values by field and match kind (alias, pattern, term, fuzzy, default or none).",
+		}, []string{"field", "kind"}),
+		confidence: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "migration_normalization_confidence",
+			Help:    "Confidence of normalization matches by field.",
+			Buckets: []float64{0.1, 0.25, 0.5, 0.6, 0.7, 0.8, 0.9, 0.95, 1},
+		}, []string{"field"}),
+	}
+
+	rules := DefaultRules()
+	if path != "" {
+		var err error
+		if rules, err = LoadRulesFile(path); err != nil {
+			return nil, err
+		}
+	}
+	store.activate(rules)
+	log.Printf("Using normalization rules %s (%s)", rules.Version, rules.Source)
+	return store, nil
+}
+
+// activate makes rules the active rule set
+func (s *RuleStore) activate(rules *RuleSet) {
+	s.active.Store(rules)
+	s.info.Reset()
+	s.info.WithLabelValues(rules.Version).Set(1)
+}
+
+// Rules returns the active rule set
+func (s *RuleStore) Rules() *RuleSet {
+	if s == nil {
+		return DefaultRules()
+	}
+	return s.active.Load()
+}
+
+// Version returns the version of the active rule set
+func (s *RuleStore) Version() string {
+	return s.Rules().Version
+}
+
+// Reload re-reads the rule file. An invalid file is rejected and the active rules are kept.
+func (s *RuleStore) Reload() error {
+	rules, err := LoadRulesFile(s.path)
+	if err != nil {
+		s.reloads.WithLabelValues("rejected").Inc()
+		return err
+	}
+	previous := s.Rules()
+	s.activate(rules)
+	s.reloads.WithLabelValues("loaded").Inc()
+	log.Printf("🔄 Reloaded normalization rules from %s: version %s -> %s", s.path, previous.Version, rules.Version)
+	return nil
+}
+
+// rulesReloadDelay lets editors finish writing the file before it is reloaded
+const rulesReloadDelay = 500 * time.Millisecond
+
+// Watch reloads the rule file whenever it changes, until ctx is cancelled. It watches the file's
+// directory so files replaced by renaming (as editors and config management do) are picked up.
+func (s *RuleStore) Watch(ctx context.Context) error {
+	if s == nil || s.path == "" {
+		return nil
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to watch rule file: %w", err)
+	}
+	if err := watcher.Add(filepath.Dir(s.path)); err != nil {
+		watcher.Close()
+		return fmt.Errorf("failed to watch rule file %s: %w", s.path, err)
+	}
+
+	go func() {
+		defer watcher.Close()
+		name := filepath.Clean(s.path)
+		var pending <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) == name && event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
+					pending = time.After(rulesReloadDelay)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Printf("Warning: rule file watcher: %v", err)
+			case <-pending:
+				pending = nil
+				if err := s.Reload(); err != nil {
+					log.Printf("⚠️  Rejected rule file change, keeping version %s: %v", s.Version(), err)
+				}
+			}
+		}
+	}()
+	log.Printf("Watching %s for rule changes", s.path)
+	return nil
+}
+
+// Observe records how a value of field was normalized
+func (s *RuleStore) Observe(field string, match RuleMatch) {
+	if s == nil || match.Kind == "" {
+		return
+	}
+	s.matches.WithLabelValues(field, match.Kind).Inc()
+	s.confidence.WithLabelValues(field).Observe(match.Confidence)
+}
+
+// Collectors returns the rule store's Prometheus collectors
+func (s *RuleStore) Collectors() []prometheus.Collector {
+	if s == nil {
+		return nil
+	}
+	return []prometheus.Collector{s.reloads, s.info, s.matches, s.confidence}
+}
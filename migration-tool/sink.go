@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// Sink types selectable with SINK_TYPES
+const (
+	SinkPostgres = "postgres" // ThreatEvents, through the pipeline's retrying, spooling write path
+	SinkNDJSON   = "ndjson"   // one JSON record per line, appended to a file
+	SinkParquet  = "parquet"  // Parquet part files in a directory
+)
+
+// Sink stores the normalized records of every committed batch. The PostgreSQL sink is built into
+// the pipeline; the file sinks receive the records PostgreSQL accepted, or every record of the
+// batch when PostgreSQL is not one of the sinks.
+type Sink interface {
+	// Name describes the sink in logs
+	Name() string
+	// Write stores records; it may be called from several workers at once
+	Write(ctx context.Context, records []ThreatRecord) error
+	// Close flushes and releases the sink
+	Close() error
+}
+
+// NewSinks opens the file sinks selected by config, or returns nil if PostgreSQL is the only sink.
+// Several sinks are written in turn by a single tee sink.
+func NewSinks(config SinkConfig) (Sink, error) {
+	var sinks []Sink
+	closeAll := func() {
+		for _, sink := range sinks {
+			sink.Close()
+		}
+	}
+
+	for _, sinkType := range config.Types {
+		switch sinkType {
+		case SinkPostgres:
+			continue
+		case SinkNDJSON:
+			sink, err := NewNDJSONSink(config.NDJSONPath)
+			if err != nil {
+				closeAll()
+				return nil, err
+			}
+			sinks = append(sinks, sink)
+		case SinkParquet:
+			sink, err := NewParquetSink(config.ParquetDir, config.ParquetFileRows)
+			if err != nil {
+				closeAll()
+				return nil, err
+			}
+			sinks = append(sinks, sink)
+		default:
+			closeAll()
+			return nil, fmt.Errorf("unknown sink type %q", sinkType)
+		}
+		log.Printf("Writing records to %s", sinks[len(sinks)-1].Name())
+	}
+
+	switch len(sinks) {
+	case 0:
+		return nil, nil
+	case 1:
+		return sinks[0], nil
+	default:
+		return teeSink(sinks), nil
+	}
+}
+
+// HasSink reports whether sinkType is one of the configured sinks
+func (c SinkConfig) HasSink(sinkType string) bool {
+	for _, t := range c.Types {
+		if t == sinkType {
+			return true
+		}
+	}
+	return false
+}
+
+// teeSink writes every batch to several sinks
+type teeSink []Sink
+
+func (t teeSink) Name() string {
+	name := t[0].Name()
+	for _, sink := range t[1:] {
+		name += ", " + sink.Name()
+	}
+	return name
+}
+
+func (t teeSink) Write(ctx context.Context, records []ThreatRecord) error {
+	var errs []error
+	for _, sink := range t {
+		if err := sink.Write(ctx, records); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", sink.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (t teeSink) Close() error {
+	var errs []error
+	for _, sink := range t {
+		if err := sink.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ndjsonRecord is the JSON form of a ThreatRecord, keyed by the ThreatEvents column names
+type ndjsonRecord struct {
+	ID                    string    `json:"Id"`
+	Timestamp             time.Time `json:"Timestamp"`
+	AsnRegistryID         string    `json:"AsnRegistryId"`
+	SourceAddress         string    `json:"SourceAddress"`
+	SourceCountryID       *string   `json:"SourceCountryId"`
+	DestinationAddress    *string   `json:"DestinationAddress"`
+	DestinationCountryID  *string   `json:"DestinationCountryId"`
+	SourcePort            *int      `json:"SourcePort"`
+	DestinationPort       *int      `json:"DestinationPort"`
+	ProtocolID            *string   `json:"ProtocolId"`
+	Category              string    `json:"Category"`
+	MalwareFamilyID       *string   `json:"MalwareFamilyId"`
+	CreatedAt             time.Time `json:"CreatedAt"`
+	UpdatedAt             time.Time `json:"UpdatedAt"`
+	ApplicationProtocolID *string   `json:"ApplicationProtocolId"`
+}
+
+// NDJSONSink appends one JSON line per record to a file
+type NDJSONSink struct {
+	path string
+	file *os.File
+	mu   sync.Mutex
+}
+
+// NewNDJSONSink opens (or creates) the file at path for appending
+func NewNDJSONSink(path string) (*NDJSONSink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ndjson sink %s: %w", path, err)
+	}
+	return &NDJSONSink{path: path, file: file}, nil
+}
+
+// Name returns the file path
+func (s *NDJSONSink) Name() string {
+	return "ndjson " + s.path
+}
+
+// Write appends the records and syncs the file, so a committed batch survives a crash
+func (s *NDJSONSink) Write(ctx context.Context, records []ThreatRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buffered := bufio.NewWriter(s.file)
+	encoder := json.NewEncoder(buffered)
+	for _, record := range records {
+		row := ndjsonRecord{
+			ID:                    record.ID.String(),
+			Timestamp:             record.Timestamp,
+			AsnRegistryID:         record.AsnRegistryID.String(),
+			SourceAddress:         record.SourceAddress.String(),
+			SourceCountryID:       uuidString(record.SourceCountryID),
+			DestinationAddress:    ipString(record.DestinationAddress),
+			DestinationCountryID:  uuidString(record.DestinationCountryID),
+			SourcePort:            record.SourcePort,
+			DestinationPort:       record.DestinationPort,
+			ProtocolID:            uuidString(record.ProtocolID),
+			Category:              record.Category,
+			MalwareFamilyID:       uuidString(record.MalwareFamilyID),
+			CreatedAt:             record.CreatedAt,
+			UpdatedAt:             record.UpdatedAt,
+			ApplicationProtocolID: uuidString(record.ApplicationProtocolID),
+		}
+		if err := encoder.Encode(row); err != nil {
+			return fmt.Errorf("failed to encode record %s: %w", record.ID, err)
+		}
+	}
+	if err := buffered.Flush(); err != nil {
+		return fmt.Errorf("failed to write ndjson sink: %w", err)
+	}
+	return s.file.Sync()
+}
+
+// Close closes the file
+func (s *NDJSONSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// parquetRecord is the Parquet row of a ThreatRecord, with the ThreatEvents column names.
+// IDs and addresses are strings, times are UTC microseconds.
+type parquetRecord struct {
+	ID                    string  `parquet:"name=Id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Timestamp             int64   `parquet:"name=Timestamp, type=INT64, convertedtype=TIMESTAMP_MICROS"`
+	AsnRegistryID         string  `parquet:"name=AsnRegistryId, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	SourceAddress         string  `parquet:"name=SourceAddress, type=BYTE_ARRAY, convertedtype=UTF8"`
+	SourceCountryID       *string `parquet:"name=SourceCountryId, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY, repetitiontype=OPTIONAL"`
+	DestinationAddress    *string `parquet:"name=DestinationAddress, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+	DestinationCountryID  *string `parquet:"name=DestinationCountryId, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY, repetitiontype=OPTIONAL"`
+	SourcePort            *int32  `parquet:"name=SourcePort, type=INT32, repetitiontype=OPTIONAL"`
+	DestinationPort       *int32  `parquet:"name=DestinationPort, type=INT32, repetitiontype=OPTIONAL"`
+	ProtocolID            *string `parquet:"name=ProtocolId, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY, repetitiontype=OPTIONAL"`
+	Category              string  `parquet:"name=Category, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	MalwareFamilyID       *string `parquet:"name=MalwareFamilyId, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY, repetitiontype=OPTIONAL"`
+	CreatedAt             int64   `parquet:"name=CreatedAt, type=INT64, convertedtype=TIMESTAMP_MICROS"`
+	UpdatedAt             int64   `parquet:"name=UpdatedAt, type=INT64, convertedtype=TIMESTAMP_MICROS"`
+	ApplicationProtocolID *string `parquet:"name=ApplicationProtocolId, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY, repetitiontype=OPTIONAL"`
+}
+
+// parquetRowGroupSize is the buffered size at which a row group is written out
+const parquetRowGroupSize = 64 * 1024 * 1024
+
+// ParquetSink writes records to snappy-compressed Parquet part files in a directory, starting a
+// new file every fileRows records. A part file is written as <name>.parquet.tmp and renamed once
+// its footer is written, so readers only see complete files.
+type ParquetSink struct {
+	dir      string
+	fileRows int
+	run      string // timestamp shared by the part files of this run
+
+	mu      sync.Mutex
+	seq     int
+	file    *os.File
+	writer  *writer.ParquetWriter
+	rows    int
+	tmpPath string
+}
+
+// NewParquetSink creates dir if needed; part files are opened on the first write
+func NewParquetSink(dir string, fileRows int) (*ParquetSink, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create parquet sink directory %s: %w", dir, err)
+	}
+	return &ParquetSink{dir: dir, fileRows: fileRows, run: time.Now().UTC().Format("20060102T150405")}, nil
+}
+
+// Name returns the directory
+func (s *ParquetSink) Name() string {
+	return "parquet " + s.dir
+}
+
+// Write appends the records to the current part file, rolling over to a new one when it is full
+func (s *ParquetSink) Write(ctx context.Context, records []ThreatRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, record := range records {
+		if s.writer == nil {
+			if err := s.openPart(); err != nil {
+				return err
+			}
+		}
+		row := parquetRecord{
+			ID:                    record.ID.String(),
+			Timestamp:             record.Timestamp.UnixMicro(),
+			AsnRegistryID:         record.AsnRegistryID.String(),
+			SourceAddress:         record.SourceAddress.String(),
+			SourceCountryID:       uuidString(record.SourceCountryID),
+			DestinationAddress:    ipString(record.DestinationAddress),
+			DestinationCountryID:  uuidString(record.DestinationCountryID),
+			SourcePort:            int32Ptr(record.SourcePort),
+			DestinationPort:       int32Ptr(record.DestinationPort),
+			ProtocolID:            uuidString(record.ProtocolID),
+			Category:              record.Category,
+			MalwareFamilyID:       uuidString(record.MalwareFamilyID),
+			CreatedAt:             record.CreatedAt.UnixMicro(),
+			UpdatedAt:             record.UpdatedAt.UnixMicro(),
+			ApplicationProtocolID: uuidString(record.ApplicationProtocolID),
+		}
+		if err := s.writer.Write(row); err != nil {
+			return fmt.Errorf("failed to write record %s to %s: %w", record.ID, s.tmpPath, err)
+		}
+		s.rows++
+		if s.fileRows > 0 && s.rows >= s.fileRows {
+			if err := s.closePart(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// openPart starts the next part file
+func (s *ParquetSink) openPart() error {
+	s.seq++
+	s.tmpPath = filepath.Join(s.dir, fmt.Sprintf("threats-%s-%05d.parquet.tmp", s.run, s.seq))
+	file, err := os.Create(s.tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create parquet part %s: %w", s.tmpPath, err)
+	}
+	pw, err := writer.NewParquetWriterFromWriter(file, new(parquetRecord), 4)
+	if err != nil {
+		file.Close()
+		os.Remove(s.tmpPath)
+		return fmt.Errorf("failed to create parquet writer: %w", err)
+	}
+	pw.RowGroupSize = parquetRowGroupSize
+	pw.CompressionType = parquet.CompressionCodec_SNAPPY
+	s.file, s.writer, s.rows = file, pw, 0
+	return nil
+}
+
+// closePart writes the footer of the current part file and gives it its final name
+func (s *ParquetSink) closePart() error {
+	pw, file := s.writer, s.file
+	s.writer, s.file = nil, nil
+
+	if err := pw.WriteStop(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to finish parquet part %s: %w", s.tmpPath, err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to sync parquet part %s: %w", s.tmpPath, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close parquet part %s: %w", s.tmpPath, err)
+	}
+	finalPath := s.tmpPath[:len(s.tmpPath)-len(".tmp")]
+	if err := os.Rename(s.tmpPath, finalPath); err != nil {
+		return fmt.Errorf("failed to rename parquet part %s: %w", s.tmpPath, err)
+	}
+	log.Printf("Wrote %d records to %s", s.rows, finalPath)
+	return nil
+}
+
+// Close finishes the current part file
+func (s *ParquetSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.writer == nil {
+		return nil
+	}
+	return s.closePart()
+}
+
+// uuidString returns the text form of an optional UUID
+func uuidString(id *uuid.UUID) *string {
+	if id == nil {
+		return nil
+	}
+	text := id.String()
+	return &text
+}
+
+// ipString returns the text form of an optional address
+func ipString(ip *net.IP) *string {
+	if ip == nil {
+		return nil
+	}
+	text := ip.String()
+	return &text
+}
+
+// int32Ptr narrows an optional port
+func int32Ptr(value *int) *int32 {
+	if value == nil {
+		return nil
+	}
+	narrowed := int32(*value)
+	return &narrowed
+}
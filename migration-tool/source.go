@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// Source types selectable with SOURCE_TYPE
+const (
+	SourceMongoDB = "mongodb" // the MongoDB collection
+	SourceNDJSON  = "ndjson"  // mongoexport output: one extended JSON document per line, or a JSON array
+	SourceBSON    = "bson"    // mongodump collection files: concatenated BSON documents
+)
+
+// Source reads threat documents in batches, in a stable order, from a resumable position.
+// Positions are opaque strings recorded in the checkpoint; an empty position is the start.
+type Source interface {
+	// Name describes the source in logs
+	Name() string
+	// EstimatedCount returns the approximate number of documents in the source (0 if unknown)
+	EstimatedCount(ctx context.Context) (int64, error)
+	// ReadBatch returns up to batchSize documents following position and the position after
+	// the last of them. An empty batch means the source is exhausted.
+	ReadBatch(ctx context.Context, position string, batchSize int) ([]ThreatDocument, string, error)
+	// CountUpTo returns the number of documents up to and including position
+	CountUpTo(ctx context.Context, position string) (int64, error)
+	// Close releases the source
+	Close() error
+}
+
+// SourceBatch is a batch of documents handed to the workers, with the source position just
+// after it (empty for batches that do not come from the source, such as sync changes)
+type SourceBatch struct {
+	Documents []ThreatDocument
+	Position  string
+}
+
+// NewSource opens the source selected by config. The MongoDB source reads through mongoClient.
+func NewSource(config SourceConfig, mongoClient *MongoDBClient) (Source, error) {
+	switch config.Type {
+	case SourceMongoDB:
+		return &MongoSource{client: mongoClient}, nil
+	case SourceNDJSON, SourceBSON:
+		source, err := OpenFileSource(config.Type, config.Path)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Reading %s export files: %s", config.Type, config.Path)
+		return source, nil
+	default:
+		return nil, fmt.Errorf("unknown source type %q", config.Type)
+	}
+}
+
+// MongoSource reads the MongoDB collection in _id order. Positions are hex ObjectIDs, or
+// extended JSON for other _id types.
+type MongoSource struct {
+	client *MongoDBClient
+}
+
+// Name describes the collection
+func (s *MongoSource) Name() string {
+	return fmt.Sprintf("MongoDB %s/%s", s.client.config.Database, s.client.config.Collection)
+}
+
+// EstimatedCount returns the collection's estimated document count (much faster than an exact count)
+func (s *MongoSource) EstimatedCount(ctx context.Context) (int64, error) {
+	count, err := s.client.collection.EstimatedDocumentCount(ctx)
+	if err != nil {
+		log.Printf("Estimated count failed, using fallback: %v", err)
+		return 25121993, nil // Use known total as fallback
+	}
+	return count, nil
+}
+
+// ReadBatch reads the next batch after the _id in position
+func (s *MongoSource) ReadBatch(ctx context.Context, position string, batchSize int) ([]ThreatDocument, string, error) {
+	lastID, err := parseMongoPosition(position)
+	if err != nil {
+		return nil, position, err
+	}
+	batch, err := s.client.ReadDocumentsBatch(ctx, batchSize, lastID)
+	if err != nil {
+		return nil, position, fmt.Errorf("failed to read batch after _id %s: %w", position, err)
+	}
+	if len(batch) == 0 {
+		return nil, position, nil
+	}
+	return batch, mongoPosition(batch[len(batch)-1].SourceIDValue()), nil
+}
+
+// CountUpTo counts the documents with _id up to the one in position
+func (s *MongoSource) CountUpTo(ctx context.Context, position string) (int64, error) {
+	lastID, err := parseMongoPosition(position)
+	if err != nil {
+		return 0, err
+	}
+	return s.client.CountDocumentsUpTo(ctx, lastID)
+}
+
+// Close does nothing: the client is shared with the rest of the tool, which closes it
+func (s *MongoSource) Close() error {
+	return nil
+}
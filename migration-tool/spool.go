@@ -0,0 +1,494 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Spool: while PostgreSQL is unreachable or failing, transformed batches are appended to local
+// segment files instead, so reading from MongoDB can carry on. A drainer replays the segments
+// into PostgreSQL in order once it recovers. While anything is spooled, new batches are spooled
+// too, so writes always reach PostgreSQL in the order they were produced.
+//
+// A segment is a sequence of frames: a 4-byte big-endian payload length, the CRC-32C of the
+// payload, and the JSON-encoded SpoolEntry. Every frame is fsynced before the batch counts as
+// committed. A segment is deleted once all its entries are replayed; a crash in between replays
+// the whole segment again, which is safe because every write is idempotent.
+
+const spoolSegmentExt = ".seg"
+
+var spoolChecksumTable = crc32.MakeTable(crc32.Castagnoli)
+
+// errWritesPaused is returned instead of waiting when the circuit breaker is open and the
+// batch can be spooled
+var errWritesPaused = errors.New("PostgreSQL writes are paused")
+
+// SpoolEntry is one spooled write: ThreatEvents rows to delete, then records to insert. Sources
+// holds the BSON of the source document of each record, so records refused on replay can be
+// dead-lettered: the checkpoint has moved past them when they were spooled.
+type SpoolEntry struct {
+	Deletes []uuid.UUID    `json:"deletes,omitempty"`
+	Records []ThreatRecord `json:"records,omitempty"`
+	Sources [][]byte       `json:"sources,omitempty"`
+}
+
+// sourceDocuments decodes the source documents of the records, nil for entries without them
+func (e SpoolEntry) sourceDocuments() []ThreatDocument {
+	if len(e.Sources) != len(e.Records) {
+		return nil
+	}
+	docs := make([]ThreatDocument, len(e.Sources))
+	for i, raw := range e.Sources {
+		// Decoding is lenient and only fails for BSON that is not a document; the dead letter
+		// then still holds the raw bytes
+		_ = bson.Unmarshal(raw, &docs[i])
+		docs[i].Raw = bson.Raw(raw)
+	}
+	return docs
+}
+
+// Spool is an append-only queue of SpoolEntry batches in segment files under a directory
+type Spool struct {
+	dir          string
+	segmentBytes int64
+	maxBytes     int64 // 0 for no limit
+
+	mu           sync.Mutex
+	cond         *sync.Cond
+	sealed       []uint64 // complete segments awaiting replay, oldest first
+	segmentSizes map[uint64]int64
+	active       *os.File // segment being appended to (nil until the next append)
+	activeSeq    uint64
+	activeSize   int64
+	nextSeq      uint64
+	totalBytes   int64
+
+	spooled  prometheus.Counter
+	replayed prometheus.Counter
+}
+
+// OpenSpool opens the spool in dir, picking up segments left by an earlier run
+func OpenSpool(dir string, segmentBytes, maxBytes int64) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+
+	s := &Spool{
+		dir:          dir,
+		segmentBytes: segmentBytes,
+		maxBytes:     maxBytes,
+		segmentSizes: make(map[uint64]int64),
+		nextSeq:      1,
+		spooled: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "migration_spool_batches_written_total",
+			Help: "Batches appended to the local spool.",
+		}),
+		replayed: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "migration_spool_batches_replayed_total",
+			Help: "Spooled batches replayed into PostgreSQL.",
+		}),
+	}
+	s.cond = sync.NewCond(&s.mu)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spool directory: %w", err)
+	}
+	for _, entry := range entries {
+		seq, err := strconv.ParseUint(strings.TrimSuffix(entry.Name(), spoolSegmentExt), 10, 64)
+		if err != nil || !strings.HasSuffix(entry.Name(), spoolSegmentExt) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat spool segment %s: %w", entry.Name(), err)
+		}
+		s.sealed = append(s.sealed, seq)
+		s.segmentSizes[seq] = info.Size()
+		s.totalBytes += info.Size()
+		if seq >= s.nextSeq {
+			s.nextSeq = seq + 1
+		}
+	}
+	sort.Slice(s.sealed, func(i, j int) bool { return s.sealed[i] < s.sealed[j] })
+
+	if len(s.sealed) > 0 {
+		log.Printf("📦 Spool %s holds %d segments (%d bytes) from an earlier run, they will be replayed first",
+			dir, len(s.sealed), s.totalBytes)
+	}
+	return s, nil
+}
+
+// segmentPath returns the file name of segment seq
+func (s *Spool) segmentPath(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", seq, spoolSegmentExt))
+}
+
+// Pending reports whether the spool holds entries that are not replayed yet
+func (s *Spool) Pending() bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sealed) > 0 || s.activeSize > 0
+}
+
+// Append durably appends entry, blocking while the spool is full. It returns once the entry is
+// fsynced, or with an error if ctx is cancelled first.
+func (s *Spool) Append(ctx context.Context, entry SpoolEntry) error {
+	payload, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode spool entry: %w", err)
+	}
+	frame := make([]byte, 8+len(payload))
+	binary.BigEndian.PutUint32(frame[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(frame[4:8], crc32.Checksum(payload, spoolChecksumTable))
+	copy(frame[8:], payload)
+
+	stop := context.AfterFunc(ctx, func() {
+		s.mu.Lock()
+		s.cond.Broadcast()
+		s.mu.Unlock()
+	})
+	defer stop()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.maxBytes > 0 && s.totalBytes+int64(len(frame)) > s.maxBytes && s.totalBytes > 0 {
+		if ctx.Err() != nil {
+			return fmt.Errorf("spool full: %w", ctx.Err())
+		}
+		s.cond.Wait()
+	}
+
+	if s.active == nil {
+		s.activeSeq = s.nextSeq
+		s.nextSeq++
+		s.active, err = os.OpenFile(s.segmentPath(s.activeSeq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			s.active = nil
+			return fmt.Errorf("failed to create spool segment: %w", err)
+		}
+		s.activeSize = 0
+	}
+	// A failed write may leave a torn frame behind; later frames go to a new segment so that
+	// the torn frame stays the last one of its segment
+	if _, err := s.active.Write(frame); err != nil {
+		s.seal()
+		return fmt.Errorf("failed to write spool segment: %w", err)
+	}
+	if err := s.active.Sync(); err != nil {
+		s.seal()
+		return fmt.Errorf("failed to sync spool segment: %w", err)
+	}
+	s.activeSize += int64(len(frame))
+	s.totalBytes += int64(len(frame))
+	s.spooled.Inc()
+
+	if s.activeSize >= s.segmentBytes {
+		s.seal()
+	}
+	s.cond.Broadcast()
+	return nil
+}
+
+// seal closes the active segment and queues it for replay; called with s.mu held
+func (s *Spool) seal() {
+	if s.active == nil {
+		return
+	}
+	_ = s.active.Close()
+	s.active = nil
+	s.sealed = append(s.sealed, s.activeSeq)
+	s.segmentSizes[s.activeSeq] = s.activeSize
+	s.activeSize = 0
+}
+
+// next blocks until a segment is ready for replay and returns it, sealing the active segment
+// if nothing else is pending
+func (s *Spool) next(ctx context.Context) (uint64, error) {
+	stop := context.AfterFunc(ctx, func() {
+		s.mu.Lock()
+		s.cond.Broadcast()
+		s.mu.Unlock()
+	})
+	defer stop()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.sealed) == 0 {
+		if s.activeSize > 0 {
+			s.seal()
+			break
+		}
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+		s.cond.Wait()
+	}
+	return s.sealed[0], nil
+}
+
+// readSegment returns the entries of segment seq. A torn or corrupt frame ends the segment:
+// it can only be the last frame of a write that was never acknowledged.
+func (s *Spool) readSegment(seq uint64) ([]SpoolEntry, error) {
+	f, err := os.Open(s.segmentPath(seq))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open spool segment: %w", err)
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	var entries []SpoolEntry
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if err != io.EOF {
+				log.Printf("Warning: spool segment %d ends with a torn frame header, ignoring it", seq)
+			}
+			return entries, nil
+		}
+		payload := make([]byte, binary.BigEndian.Uint32(header[0:4]))
+		if _, err := io.ReadFull(reader, payload); err != nil {
+			log.Printf("Warning: spool segment %d ends with a torn frame, ignoring it", seq)
+			return entries, nil
+		}
+		if crc32.Checksum(payload, spoolChecksumTable) != binary.BigEndian.Uint32(header[4:8]) {
+			log.Printf("Warning: spool segment %d has a frame with a bad checksum after %d entries, ignoring the rest", seq, len(entries))
+			return entries, nil
+		}
+		var entry SpoolEntry
+		if err := json.Unmarshal(payload, &entry); err != nil {
+			return nil, fmt.Errorf("failed to decode spool segment %d: %w", seq, err)
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// remove deletes segment seq once it has been replayed
+func (s *Spool) remove(seq uint64) error {
+	if err := os.Remove(s.segmentPath(seq)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove spool segment: %w", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.sealed) > 0 && s.sealed[0] == seq {
+		s.sealed = s.sealed[1:]
+	}
+	s.totalBytes -= s.segmentSizes[seq]
+	delete(s.segmentSizes, seq)
+	s.cond.Broadcast()
+	return nil
+}
+
+// WaitEmpty blocks until every spooled entry is replayed. It returns false if ctx is cancelled first.
+func (s *Spool) WaitEmpty(ctx context.Context) bool {
+	if s == nil {
+		return ctx.Err() == nil
+	}
+	stop := context.AfterFunc(ctx, func() {
+		s.mu.Lock()
+		s.cond.Broadcast()
+		s.mu.Unlock()
+	})
+	defer stop()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.sealed) > 0 || s.activeSize > 0 {
+		if ctx.Err() != nil {
+			return false
+		}
+		s.cond.Wait()
+	}
+	return ctx.Err() == nil
+}
+
+// Close closes the active segment; its entries are replayed by the next run
+func (s *Spool) Close() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active == nil {
+		return nil
+	}
+	err := s.active.Close()
+	s.active = nil
+	return err
+}
+
+// Collectors returns the Prometheus collectors exporting the spool state
+func (s *Spool) Collectors() []prometheus.Collector {
+	if s == nil {
+		return nil
+	}
+	gauge := func(name, help string, value func() float64) prometheus.Collector {
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: name, Help: help}, func() float64 {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			return value()
+		})
+	}
+	return []prometheus.Collector{
+		s.spooled,
+		s.replayed,
+		gauge("migration_spool_bytes", "Bytes of spooled batches awaiting replay.",
+			func() float64 { return float64(s.totalBytes) }),
+		gauge("migration_spool_segments", "Spool segments awaiting replay, including the one being written.",
+			func() float64 {
+				if s.activeSize > 0 {
+					return float64(len(s.sealed) + 1)
+				}
+				return float64(len(s.sealed))
+			}),
+	}
+}
+
+// spoolWrites reports whether writes go to the spool instead of PostgreSQL: while the spool
+// holds earlier entries, to keep them in order, and while the circuit breaker is open
+func (m *MigrationTool) spoolWrites() bool {
+	return m.spool != nil && (m.spool.Pending() || m.breaker.State() == CircuitOpen)
+}
+
+// writesReady blocks while writes can go neither to PostgreSQL nor to the spool.
+// It returns false if ctx is cancelled first.
+func (m *MigrationTool) writesReady(ctx context.Context) bool {
+	if m.spool != nil {
+		return ctx.Err() == nil // The spool takes the writes, Append applies back-pressure once it is full
+	}
+	return m.breaker.Wait(ctx)
+}
+
+// startSpoolDrainer replays spooled entries in the background until the returned stop function is called
+func (m *MigrationTool) startSpoolDrainer(ctx context.Context) (stop func()) {
+	if m.spool == nil {
+		return func() {}
+	}
+	drainCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.drainSpool(drainCtx)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// drainSpool replays spool segments in order until ctx is cancelled
+func (m *MigrationTool) drainSpool(ctx context.Context) {
+	for {
+		seq, err := m.spool.next(ctx)
+		if err != nil {
+			return
+		}
+		entries, err := m.spool.readSegment(seq)
+		if err != nil {
+			// Keep the file for inspection, but do not block everything behind it
+			log.Printf("❌ Skipping unreadable spool segment %d: %v", seq, err)
+			_ = os.Rename(m.spool.segmentPath(seq), m.spool.segmentPath(seq)+".corrupt")
+			_ = m.spool.remove(seq)
+			continue
+		}
+
+		start := time.Now()
+		for i, entry := range entries {
+			for attempt := 0; ; attempt++ {
+				err := m.replaySpoolEntry(ctx, entry)
+				if err == nil {
+					break
+				}
+				if ctx.Err() != nil {
+					return // The segment is replayed again from the start
+				}
+				_, policy := m.retryPolicy(err)
+				delay := policy.Delay(attempt)
+				log.Printf("Replaying spool segment %d entry %d/%d failed, retrying in %v: %v",
+					seq, i+1, len(entries), delay.Round(time.Millisecond), err)
+				select {
+				case <-time.After(delay):
+				case <-ctx.Done():
+					return
+				}
+			}
+			m.spool.replayed.Inc()
+		}
+
+		if err := m.spool.remove(seq); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+		log.Printf("📦 Replayed spool segment %d (%d batches) in %v", seq, len(entries), time.Since(start).Round(time.Millisecond))
+	}
+}
+
+// replaySpoolEntry applies one spooled entry. Records the database refuses are dead-lettered like
+// on the direct path; only errors worth retrying the entry for are returned.
+func (m *MigrationTool) replaySpoolEntry(ctx context.Context, entry SpoolEntry) error {
+	if !m.breaker.Wait(ctx) {
+		return ctx.Err()
+	}
+	if _, err := m.events.DeleteThreatEvents(ctx, entry.Deletes); err != nil {
+		return err
+	}
+	if len(entry.Records) == 0 {
+		return nil
+	}
+
+	err := m.insertBatchWithRetry(ctx, entry.Records, true)
+	var rejection *RowRejectionError
+	if err != nil && !errors.As(err, &rejection) && classifyError(err).recordSpecific() && ctx.Err() == nil {
+		if len(entry.Records) == 1 {
+			err = &RowRejectionError{Rejected: []RejectedRow{{ID: entry.Records[0].ID, Reason: err.Error()}}}
+		} else if committed, rejected, bisectErr := m.bisectInsert(ctx, entry.Records, err); bisectErr == nil {
+			err = &RowRejectionError{Rejected: rejected}
+		} else if classifyError(bisectErr).recordSpecific() {
+			// Too much of the entry is refused to isolate the bad records; retrying would block
+			// the spool forever, so reject the records not committed while bisecting
+			uncommitted, _ := uncommittedRecords(entry.Records, nil, committed)
+			log.Printf("❌ Rejecting %d of %d records of spooled batch: %v", len(uncommitted), len(entry.Records), bisectErr)
+			all := make([]RejectedRow, len(uncommitted))
+			for i, record := range uncommitted {
+				all[i] = RejectedRow{ID: record.ID, Reason: bisectErr.Error()}
+			}
+			err = &RowRejectionError{Rejected: all}
+		} else {
+			err = bisectErr
+		}
+	}
+	if errors.As(err, &rejection) {
+		// Retrying the entry rejects the same records again, so a failed dead-letter write is
+		// retried with it
+		var result MigrationResult
+		if !m.rejectRecords(ctx, rejection.Rejected, entry.Records, entry.sourceDocuments(), &result) {
+			return errors.Join(result.Errors...)
+		}
+		m.metrics.DocumentsInserted(len(entry.Records) - len(rejection.Rejected))
+		return nil
+	}
+	if err == nil {
+		m.metrics.DocumentsInserted(len(entry.Records))
+	}
+	return err
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// refusingWriter stands in for PostgreSQL: a batch holding a refused record fails as a whole
+// with a check violation, like a COPY or a multi-row insert does
+type refusingWriter struct {
+	mu       sync.Mutex
+	refused  map[uuid.UUID]bool
+	inserted []uuid.UUID
+	deleted  []uuid.UUID
+	ops      []string // "insert <id>" and "delete <id>" in the order they were written
+}
+
+func (w *refusingWriter) InsertThreatBatch(threats []ThreatRecord) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, threat := range threats {
+		if w.refused[threat.ID] {
+			return &pq.Error{Code: "23514", Message: "new row violates check constraint"}
+		}
+	}
+	for _, threat := range threats {
+		w.inserted = append(w.inserted, threat.ID)
+		w.ops = append(w.ops, "insert "+threat.ID.String())
+	}
+	return nil
+}
+
+func (w *refusingWriter) DeleteThreatEvents(ctx context.Context, ids []uuid.UUID) (int64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.deleted = append(w.deleted, ids...)
+	for _, id := range ids {
+		w.ops = append(w.ops, "delete "+id.String())
+	}
+	return int64(len(ids)), nil
+}
+
+// spoolFixture returns n records with the BSON source documents they were transformed from
+func spoolFixture(t *testing.T, n int) ([]ThreatRecord, []ThreatDocument) {
+	t.Helper()
+	records := make([]ThreatRecord, n)
+	docs := make([]ThreatDocument, n)
+	for i := range records {
+		data, err := bson.Marshal(bson.D{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "timestamp", Value: primitive.NewDateTimeFromTime(time.Now())},
+			{Key: "source_address", Value: "203.0.113.7"},
+			{Key: "category", Value: "bot"},
+		})
+		if err != nil {
+			t.Fatalf("failed to marshal fixture: %v", err)
+		}
+		if err := bson.Unmarshal(data, &docs[i]); err != nil {
+			t.Fatalf("failed to unmarshal fixture: %v", err)
+		}
+		docs[i].Raw = data
+		records[i] = ThreatRecord{ID: uuid.New(), Timestamp: docs[i].Timestamp, Category: "bot"}
+	}
+	return records, docs
+}
+
+// storedDeadLetters reads back every dead letter of a file store
+func storedDeadLetters(t *testing.T, store DeadLetterStore) []DeadLetter {
+	t.Helper()
+	var letters []DeadLetter
+	err := store.Replay(context.Background(), 100, func(batch []DeadLetter) error {
+		letters = append(letters, batch...)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to read dead letters: %v", err)
+	}
+	return letters
+}
+
+func TestReplaySpoolDeadLettersRefusedRecords(t *testing.T) {
+	spool, err := OpenSpool(t.TempDir(), 1<<20, 0)
+	if err != nil {
+		t.Fatalf("OpenSpool: %v", err)
+	}
+	defer spool.Close()
+	deadLetters, err := NewFileDeadLetterStore(filepath.Join(t.TempDir(), "dead-letters.jsonl"))
+	if err != nil {
+		t.Fatalf("NewFileDeadLetterStore: %v", err)
+	}
+	defer deadLetters.Close()
+
+	records, docs := spoolFixture(t, 3)
+	writer := &refusingWriter{refused: map[uuid.UUID]bool{records[1].ID: true}}
+	m := &MigrationTool{
+		config:      &Config{},
+		events:      writer,
+		spool:       spool,
+		deadLetters: deadLetters,
+		errorLogger: NewErrorLogger(),
+	}
+
+	var result MigrationResult
+	m.spoolBatch(context.Background(), records, docs, &result)
+	if !result.Committed || result.ProcessedCount != 3 {
+		t.Fatalf("spoolBatch = %+v, want 3 records committed to the spool", result)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stop := m.startSpoolDrainer(ctx)
+	drained := spool.WaitEmpty(ctx)
+	stop()
+	if !drained {
+		t.Fatal("spool was not drained")
+	}
+
+	want := []uuid.UUID{records[0].ID, records[2].ID}
+	if len(writer.inserted) != 2 || writer.inserted[0] != want[0] || writer.inserted[1] != want[1] {
+		t.Errorf("inserted %v, want %v", writer.inserted, want)
+	}
+	letters := storedDeadLetters(t, deadLetters)
+	if len(letters) != 1 {
+		t.Fatalf("stored %d dead letters, want 1", len(letters))
+	}
+	if letters[0].DocumentID != docs[1].SourceIDString() || letters[0].ErrorType != DatabaseError.String() {
+		t.Errorf("dead letter %s (%s), want %s (%s)", letters[0].DocumentID, letters[0].ErrorType, docs[1].SourceIDString(), DatabaseError)
+	}
+	if !bytes.Equal(letters[0].RawDocument, docs[1].Raw) {
+		t.Error("dead letter does not hold the source document")
+	}
+}
+
+func TestSpoolEntrySourceDocuments(t *testing.T) {
+	records, docs := spoolFixture(t, 2)
+	entry := SpoolEntry{Records: records, Sources: [][]byte{docs[0].Raw, docs[1].Raw}}
+	decoded := entry.sourceDocuments()
+	if len(decoded) != 2 || decoded[0].ID != docs[0].ID || decoded[1].ID != docs[1].ID || !bytes.Equal(decoded[1].Raw, docs[1].Raw) {
+		t.Errorf("sourceDocuments() = %+v, want the spooled documents", decoded)
+	}
+
+	// Entries spooled without their documents are still replayed, their refused records only logged
+	if decoded := (SpoolEntry{Records: records}).sourceDocuments(); decoded != nil {
+		t.Errorf("sourceDocuments() of an entry without sources = %+v, want nil", decoded)
+	}
+}
+
+func TestSpoolFrameEncoding(t *testing.T) {
+	spool, err := OpenSpool(t.TempDir(), 1<<20, 0)
+	if err != nil {
+		t.Fatalf("OpenSpool: %v", err)
+	}
+	entry := SpoolEntry{Deletes: []uuid.UUID{uuid.New()}}
+	if err := spool.Append(context.Background(), entry); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	spool.Close()
+
+	data, err := os.ReadFile(spool.segmentPath(1))
+	if err != nil {
+		t.Fatalf("failed to read segment: %v", err)
+	}
+	payload, _ := json.Marshal(entry)
+	if len(data) != 8+len(payload) {
+		t.Fatalf("frame is %d bytes, want 8 + %d", len(data), len(payload))
+	}
+	if got := binary.BigEndian.Uint32(data[0:4]); got != uint32(len(payload)) {
+		t.Errorf("frame length = %d, want %d", got, len(payload))
+	}
+	if got := binary.BigEndian.Uint32(data[4:8]); got != crc32.Checksum(payload, spoolChecksumTable) {
+		t.Errorf("frame checksum = %08x, want the CRC-32C of the payload", got)
+	}
+	if !bytes.Equal(data[8:], payload) {
+		t.Errorf("frame payload = %s, want %s", data[8:], payload)
+	}
+}
+
+func TestSpoolReadSegmentTornTail(t *testing.T) {
+	entries := []SpoolEntry{
+		{Deletes: []uuid.UUID{uuid.New()}},
+		{Deletes: []uuid.UUID{uuid.New(), uuid.New()}},
+		{Deletes: []uuid.UUID{uuid.New()}},
+	}
+	frameSize := func(entry SpoolEntry) int {
+		payload, _ := json.Marshal(entry)
+		return 8 + len(payload)
+	}
+	lastFrame := len(entries) - 1
+
+	tests := []struct {
+		name string
+		tear func(data []byte) []byte
+		want int // entries read back
+	}{
+		{"intact", func(data []byte) []byte { return data }, 3},
+		{"torn header", func(data []byte) []byte { return append(data, 0, 0, 1) }, 3},
+		{"header only", func(data []byte) []byte { return append(data, 0, 0, 0, 9, 0, 0, 0, 0) }, 3},
+		{"torn payload", func(data []byte) []byte { return data[:len(data)-5] }, 2},
+		{"lost payload", func(data []byte) []byte { return data[:len(data)-frameSize(entries[lastFrame])+8] }, 2},
+		{"bad checksum", func(data []byte) []byte {
+			data[len(data)-2] ^= 0xff
+			return data
+		}, 2},
+		{"bad checksum before the tail", func(data []byte) []byte {
+			data[frameSize(entries[0])+10] ^= 0xff
+			return data
+		}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spool, err := OpenSpool(t.TempDir(), 1<<20, 0)
+			if err != nil {
+				t.Fatalf("OpenSpool: %v", err)
+			}
+			for _, entry := range entries {
+				if err := spool.Append(context.Background(), entry); err != nil {
+					t.Fatalf("Append: %v", err)
+				}
+			}
+			spool.Close()
+
+			path := spool.segmentPath(1)
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("failed to read segment: %v", err)
+			}
+			if err := os.WriteFile(path, tt.tear(data), 0o644); err != nil {
+				t.Fatalf("failed to write segment: %v", err)
+			}
+
+			got, err := spool.readSegment(1)
+			if err != nil {
+				t.Fatalf("readSegment: %v", err)
+			}
+			if len(got) != tt.want {
+				t.Fatalf("readSegment returned %d entries, want %d", len(got), tt.want)
+			}
+			for i := range got {
+				if !slices.Equal(got[i].Deletes, entries[i].Deletes) {
+					t.Errorf("entry %d = %v, want %v", i, got[i].Deletes, entries[i].Deletes)
+				}
+			}
+		})
+	}
+}
+
+func TestSpoolDrainsInOrder(t *testing.T) {
+	dir := t.TempDir()
+	records, _ := spoolFixture(t, 3)
+	stale := []uuid.UUID{uuid.New(), uuid.New()}
+	entries := []SpoolEntry{
+		{Records: records[:1]},
+		{Deletes: stale[:1], Records: records[1:2]},
+		{Deletes: stale[1:]},
+		{Records: records[2:]},
+	}
+
+	// One entry per segment: the first two are left by an earlier run
+	earlier, err := OpenSpool(dir, 1, 0)
+	if err != nil {
+		t.Fatalf("OpenSpool: %v", err)
+	}
+	for _, entry := range entries[:2] {
+		if err := earlier.Append(context.Background(), entry); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+	earlier.Close()
+
+	spool, err := OpenSpool(dir, 1, 0)
+	if err != nil {
+		t.Fatalf("OpenSpool: %v", err)
+	}
+	defer spool.Close()
+	for _, entry := range entries[2:] {
+		if err := spool.Append(context.Background(), entry); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+
+	writer := &refusingWriter{}
+	m := &MigrationTool{config: &Config{}, events: writer, spool: spool, errorLogger: NewErrorLogger()}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stop := m.startSpoolDrainer(ctx)
+	drained := spool.WaitEmpty(ctx)
+	stop()
+	if !drained {
+		t.Fatal("spool was not drained")
+	}
+
+	want := []string{
+		"insert " + records[0].ID.String(),
+		"delete " + stale[0].String(),
+		"insert " + records[1].ID.String(),
+		"delete " + stale[1].String(),
+		"insert " + records[2].ID.String(),
+	}
+	if !slices.Equal(writer.ops, want) {
+		t.Errorf("replayed %v, want %v", writer.ops, want)
+	}
+	if segments, _ := filepath.Glob(filepath.Join(dir, "*"+spoolSegmentExt)); len(segments) != 0 {
+		t.Errorf("replayed segments %v were not removed", segments)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// RejectedRow is a record the database refused while the rest of its batch was stored
+type RejectedRow struct {
+	ID     uuid.UUID
+	Reason string
+}
+
+// RowRejectionError reports records rejected individually. The other records of the batch
+// were committed, so the batch must not be retried as a whole.
+type RowRejectionError struct {
+	Rejected []RejectedRow
+}
+
+func (e *RowRejectionError) Error() string {
+	return fmt.Sprintf("%d records rejected by the database", len(e.Rejected))
+}
+
+// stagingColumnTypes are the column types of the COPY staging table. Category is unbounded
+// text so an over-long value is rejected per row in the merge instead of failing the COPY.
+var stagingColumnTypes = map[string]string{
+	"Id":                    "uuid",
+	"Timestamp":             "timestamptz",
+	"AsnRegistryId":         "uuid",
+	"SourceAddress":         "inet",
+	"SourceCountryId":       "uuid",
+	"DestinationAddress":    "inet",
+	"DestinationCountryId":  "uuid",
+	"SourcePort":            "integer",
+	"DestinationPort":       "integer",
+	"ProtocolId":            "uuid",
+	"Category":              "text",
+	"MalwareFamilyId":       "uuid",
+	"CreatedAt":             "timestamptz",
+	"UpdatedAt":             "timestamptz",
+	"ApplicationProtocolId": "uuid",
+}
+
+// ensureStagingTable creates the UNLOGGED COPY staging table named by MIGRATION_COPY_TEMP_TABLE.
+// It has no constraints, so COPY into it only fails on malformed data, never on a single
+// row that ThreatEvents would refuse.
+func (p *PostgreSQLClient) ensureStagingTable() error {
+	columns := make([]string, len(threatEventColumns))
+	for i, column := range threatEventColumns {
+		columns[i] = quoteIdentifier(column) + " " + stagingColumnTypes[column]
+	}
+	if _, err := p.db.Exec(fmt.Sprintf(`CREATE UNLOGGED TABLE IF NOT EXISTS %s (%s)`,
+		quoteIdentifier(p.copyTempTable), strings.Join(columns, ", "))); err != nil {
+		return fmt.Errorf("failed to create COPY staging table %s: %w", p.copyTempTable, err)
+	}
+	// Staging tables created by earlier versions lack the newer columns
+	for _, column := range threatEventColumns {
+		if _, err := p.db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s`,
+			quoteIdentifier(p.copyTempTable), quoteIdentifier(column), stagingColumnTypes[column])); err != nil {
+			return fmt.Errorf("failed to add column %s to COPY staging table %s: %w", column, p.copyTempTable, err)
+		}
+	}
+	return nil
+}
+
+// stageThreatBatch COPYs threats into the staging table and merges them into ThreatEvents with a
+// single INSERT ... SELECT ... threatEventsUpsert. Rows that ThreatEvents would refuse (over-long
+// category, unknown lookup IDs, out-of-range ports) are left out of the merge and returned.
+//
+// Rows are copied, merged and deleted in one transaction, so concurrent workers sharing the
+// staging table never see each other's rows.
+func (p *PostgreSQLClient) stageThreatBatch(threats []ThreatRecord) ([]RejectedRow, error) {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := copyThreatRows(tx, p.copyTempTable, threats); err != nil {
+		return nil, err
+	}
+
+	staging := quoteIdentifier(p.copyTempTable)
+	columns := `"` + strings.Join(threatEventColumns, `","`) + `"`
+
+	// The first row returned carries the merged row count, the rest are the rejected rows
+	rows, err := tx.Query(fmt.Sprintf(`
+		WITH checked AS (
+			SELECT s.*, CASE
+				WHEN length(s."Category") > 50 THEN 'Category longer than 50 characters'
+				WHEN NOT EXISTS (SELECT 1 FROM "AsnRegistries" x WHERE x."Id" = s."AsnRegistryId") THEN 'unknown AsnRegistryId'
+				WHEN s."SourceCountryId" IS NOT NULL AND NOT EXISTS (SELECT 1 FROM "Countries" x WHERE x."Id" = s."SourceCountryId") THEN 'unknown SourceCountryId'
+				WHEN s."DestinationCountryId" IS NOT NULL AND NOT EXISTS (SELECT 1 FROM "Countries" x WHERE x."Id" = s."DestinationCountryId") THEN 'unknown DestinationCountryId'
+				WHEN s."ProtocolId" IS NOT NULL AND NOT EXISTS (SELECT 1 FROM "Protocols" x WHERE x."Id" = s."ProtocolId") THEN 'unknown ProtocolId'
+				WHEN s."ApplicationProtocolId" IS NOT NULL AND NOT EXISTS (SELECT 1 FROM "ApplicationProtocols" x WHERE x."Id" = s."ApplicationProtocolId") THEN 'unknown ApplicationProtocolId'
+				WHEN s."MalwareFamilyId" IS NOT NULL AND NOT EXISTS (SELECT 1 FROM "MalwareFamilies" x WHERE x."Id" = s."MalwareFamilyId") THEN 'unknown MalwareFamilyId'
+				WHEN s."SourcePort" NOT BETWEEN 0 AND 65535 OR s."DestinationPort" NOT BETWEEN 0 AND 65535 THEN 'port out of range'
+			END AS rejection
+			FROM %[1]s s
+		), merged AS (
+			INSERT INTO "ThreatEvents" (%[2]s)
+			SELECT DISTINCT ON ("Id", "Timestamp") %[2]s FROM checked WHERE rejection IS NULL
+			ORDER BY "Id", "Timestamp"
+			%[3]s
+			RETURNING 1
+		)
+		SELECT NULL::uuid, NULL::text, (SELECT count(*) FROM merged)
+		UNION ALL
+		SELECT "Id", rejection, 0 FROM checked WHERE rejection IS NOT NULL`,
+		staging, columns, threatEventsUpsert))
+	if err != nil {
+		return nil, fmt.Errorf("staging merge failed: %w", err)
+	}
+
+	var merged int64
+	var rejected []RejectedRow
+	for rows.Next() {
+		var id uuid.NullUUID
+		var reason sql.NullString
+		var count int64
+		if err := rows.Scan(&id, &reason, &count); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to read staging merge result: %w", err)
+		}
+		if !id.Valid {
+			merged = count
+			continue
+		}
+		rejected = append(rejected, RejectedRow{ID: id.UUID, Reason: reason.String})
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return nil, fmt.Errorf("staging merge failed: %w", err)
+	}
+	rows.Close()
+
+	if _, err := tx.Exec(fmt.Sprintf(`DELETE FROM %s`, staging)); err != nil {
+		return nil, fmt.Errorf("failed to clear staging table: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("staging commit failed: %w", err)
+	}
+
+	if unchanged := int64(len(threats)-len(rejected)) - merged; unchanged > 0 {
+		log.Printf("Staging merge left %d already migrated records unchanged", unchanged)
+	}
+	if len(rejected) > 0 {
+		log.Printf("Staging merge rejected %d of %d records", len(rejected), len(threats))
+	}
+	return rejected, nil
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// changeEvent is the subset of a MongoDB change stream event used by sync mode
+type changeEvent struct {
+	ResumeToken   bson.Raw        `bson:"_id"`
+	OperationType string          `bson:"operationType"`
+	FullDocument  *ThreatDocument `bson:"fullDocument"`
+	DocumentKey   struct {
+		ID bson.RawValue `bson:"_id"`
+	} `bson:"documentKey"`
+}
+
+// WatchChanges opens a change stream on the threat collection, optionally resuming after resumeToken.
+// Change streams require MongoDB to run as a replica set (a single-node replica set is enough).
+func (m *MongoDBClient) WatchChanges(ctx context.Context, resumeToken bson.Raw) (*mongo.ChangeStream, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{
+			{Key: "operationType", Value: bson.D{{Key: "$in", Value: bson.A{"insert", "update", "replace", "delete", "invalidate"}}}},
+		}}},
+	}
+
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	if resumeToken != nil {
+		opts.SetResumeAfter(resumeToken)
+	}
+
+	stream, err := m.collection.Watch(ctx, pipeline, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open change stream: %w", err)
+	}
+	return stream, nil
+}
+
+// CurrentResumeToken returns a resume token for the current position of the change stream
+func (m *MongoDBClient) CurrentResumeToken(ctx context.Context) (bson.Raw, error) {
+	stream, err := m.WatchChanges(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close(ctx)
+
+	token := stream.ResumeToken()
+	if token == nil {
+		// Servers without post-batch resume tokens only return one after the first getMore
+		stream.TryNext(ctx)
+		token = stream.ResumeToken()
+	}
+	if token == nil {
+		return nil, fmt.Errorf("change stream did not return a resume token")
+	}
+	return token, nil
+}
+
+// encodeResumeToken renders a resume token as extended JSON for the checkpoint store
+func encodeResumeToken(token bson.Raw) (string, error) {
+	data, err := bson.MarshalExtJSON(token, true, false)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode resume token: %w", err)
+	}
+	return string(data), nil
+}
+
+// decodeResumeToken parses a resume token stored by encodeResumeToken
+func decodeResumeToken(s string) (bson.Raw, error) {
+	var token bson.Raw
+	if err := bson.UnmarshalExtJSON([]byte(s), true, &token); err != nil {
+		return nil, fmt.Errorf("failed to decode resume token: %w", err)
+	}
+	return token, nil
+}
+
+// Sync runs the initial load and then keeps PostgreSQL in step with the MongoDB collection by
+// tailing its change stream. It runs until ctx is cancelled. The resume token is saved after
+// every applied batch under "<migration name>_sync", so a restarted sync continues where it stopped.
+func (m *MigrationTool) Sync(ctx context.Context) error {
+	if m.mongoClient == nil {
+		return fmt.Errorf("sync tails the MongoDB change stream and needs the %s source, not %s", SourceMongoDB, m.config.Source.Type)
+	}
+	syncName := m.config.Migration.MigrationName + "_sync"
+	state := MigrationProgress{MigrationName: syncName, StartTime: time.Now().UTC()}
+
+	if m.checkpointStore != nil {
+		saved, err := m.checkpointStore.Load(ctx, syncName)
+		if err != nil {
+			return fmt.Errorf("failed to load sync state: %w", err)
+		}
+		if saved != nil {
+			state = *saved
+		}
+	}
+
+	var resumeToken bson.Raw
+	if state.ResumeToken != "" {
+		token, err := decodeResumeToken(state.ResumeToken)
+		if err != nil {
+			return err
+		}
+		resumeToken = token
+		log.Printf("Resuming change stream %s (last _id %s, %d changes applied so far)",
+			syncName, state.LastProcessedID, state.ProcessedCount)
+	} else {
+		// Capture the stream position before the initial load so nothing written during it is missed
+		token, err := m.mongoClient.CurrentResumeToken(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get initial resume token (is MongoDB running as a replica set?): %w", err)
+		}
+		resumeToken = token
+		if err := m.saveSyncState(ctx, &state, token); err != nil {
+			return err
+		}
+		log.Printf("Recorded change stream start position for %s", syncName)
+	}
+
+	// The initial load resumes from its own checkpoint and reads nothing if it already finished
+	if err := m.Migrate(ctx); err != nil {
+		return fmt.Errorf("initial load failed: %w", err)
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	return m.tailChanges(ctx, resumeToken, &state)
+}
+
+// tailChanges applies change stream events in batches until ctx is cancelled
+func (m *MigrationTool) tailChanges(ctx context.Context, resumeToken bson.Raw, state *MigrationProgress) error {
+	stream, err := m.mongoClient.WatchChanges(ctx, resumeToken)
+	if err != nil {
+		return err
+	}
+	defer stream.Close(context.Background())
+
+	// A single worker keeps changes to the same document applied in stream order
+	documentChan := make(chan SourceBatch, 1)
+	resultChan := make(chan MigrationResult, 1)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go m.worker(ctx, documentChan, resultChan, &wg)
+	defer func() {
+		close(documentChan)
+		wg.Wait()
+	}()
+
+	stopDrainer := m.startSpoolDrainer(ctx)
+	defer stopDrainer()
+
+	log.Println("Tailing MongoDB change stream...")
+
+	var pending []changeEvent
+	for {
+		// Drain whatever is immediately available into one batch
+		if stream.TryNext(ctx) {
+			var event changeEvent
+			if err := stream.Decode(&event); err != nil {
+				return fmt.Errorf("failed to decode change event: %w", err)
+			}
+			if event.OperationType == "invalidate" {
+				return fmt.Errorf("change stream invalidated (collection dropped or renamed)")
+			}
+			pending = append(pending, event)
+			if len(pending) >= m.config.Migration.BatchSize {
+				if err := m.applyChanges(ctx, pending, documentChan, resultChan, state); err != nil {
+					return err
+				}
+				pending = pending[:0]
+			}
+			continue
+		}
+		if err := stream.Err(); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("change stream error: %w", err)
+		}
+
+		if len(pending) > 0 {
+			if err := m.applyChanges(ctx, pending, documentChan, resultChan, state); err != nil {
+				return err
+			}
+			pending = pending[:0]
+			continue
+		}
+
+		// Nothing buffered, block until the next change arrives
+		if !stream.Next(ctx) {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err := stream.Err(); err != nil {
+				return fmt.Errorf("change stream error: %w", err)
+			}
+			return fmt.Errorf("change stream closed")
+		}
+		var event changeEvent
+		if err := stream.Decode(&event); err != nil {
+			return fmt.Errorf("failed to decode change event: %w", err)
+		}
+		if event.OperationType == "invalidate" {
+			return fmt.Errorf("change stream invalidated (collection dropped or renamed)")
+		}
+		pending = append(pending, event)
+	}
+}
+
+// applyChanges writes one batch of change events through the migration pipeline and saves the
+// resume token once the batch is committed. Updates and deletes first remove the existing
+// ThreatEvents row, since an update may change the Timestamp that is part of its primary key.
+func (m *MigrationTool) applyChanges(ctx context.Context, events []changeEvent, documentChan chan<- SourceBatch, resultChan <-chan MigrationResult, state *MigrationProgress) error {
+	// Only the latest change per document matters within a batch
+	latest := make(map[primitive.ObjectID]changeEvent, len(events))
+	order := make([]primitive.ObjectID, 0, len(events))
+	for _, event := range events {
+		key, _ := documentObjectID(event.DocumentKey.ID)
+		if _, seen := latest[key]; !seen {
+			order = append(order, key)
+		}
+		latest[key] = event
+	}
+
+	var staleIDs []uuid.UUID
+	var documents []ThreatDocument
+	for _, key := range order {
+		event := latest[key]
+		switch event.OperationType {
+		case "insert":
+			if event.FullDocument != nil {
+				documents = append(documents, *event.FullDocument)
+			}
+		case "update", "replace":
+			staleIDs = append(staleIDs, ThreatEventID(key))
+			if event.FullDocument != nil { // nil when the document was deleted before the lookup
+				documents = append(documents, *event.FullDocument)
+			}
+		case "delete":
+			staleIDs = append(staleIDs, ThreatEventID(key))
+		}
+	}
+
+	// Hold the changes while PostgreSQL is unreachable and there is no spool; the stream
+	// resumes from the saved token
+	if !m.writesReady(ctx) {
+		return nil
+	}
+
+	// Deletes go through the spool like inserts, so the worker's inserts stay ordered after them
+	var deleted int64
+	if len(staleIDs) > 0 && !m.config.Migration.DryRun {
+		var err error
+		spooled := m.spoolWrites()
+		if !spooled {
+			deleted, err = m.events.DeleteThreatEvents(ctx, staleIDs)
+			if err != nil && m.spool != nil && !classifyError(err).recordSpecific() {
+				log.Printf("Spooling %d deletes after failure: %v", len(staleIDs), err)
+				spooled, err = true, nil
+			}
+		}
+		if spooled {
+			if err = m.spool.Append(ctx, SpoolEntry{Deletes: staleIDs}); err != nil {
+				err = fmt.Errorf("failed to spool %d deletes: %w", len(staleIDs), err)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(documents) > 0 {
+		select {
+		case documentChan <- SourceBatch{Documents: documents}:
+		case <-ctx.Done():
+			return nil
+		}
+
+		var result MigrationResult
+		select {
+		case result = <-resultChan:
+		case <-ctx.Done():
+			return nil
+		}
+
+		for _, err := range result.Errors {
+			log.Printf("Sync error: %v", err)
+		}
+		if !result.Committed {
+			return fmt.Errorf("sync batch ending at _id %s was not committed", result.LastDocumentID.Hex())
+		}
+	}
+
+	state.LastProcessedID = mongoPosition(events[len(events)-1].DocumentKey.ID)
+	state.ProcessedCount += int64(len(events))
+	if err := m.saveSyncState(ctx, state, events[len(events)-1].ResumeToken); err != nil {
+		return err
+	}
+
+	log.Printf("Synced %d changes (%d documents written, %d rows removed), last _id %s",
+		len(events), len(documents), deleted, state.LastProcessedID)
+	return nil
+}
+
+// saveSyncState records the resume token in the checkpoint store
+func (m *MigrationTool) saveSyncState(ctx context.Context, state *MigrationProgress, token bson.Raw) error {
+	encoded, err := encodeResumeToken(token)
+	if err != nil {
+		return err
+	}
+	state.ResumeToken = encoded
+	state.LastUpdateTime = time.Now().UTC()
+	state.RulesVersion = m.rules.Version()
+
+	if m.checkpointStore == nil {
+		return nil
+	}
+	if err := m.checkpointStore.Save(ctx, *state); err != nil {
+		return fmt.Errorf("failed to save sync state: %w", err)
+	}
+	return nil
+}
@@ -2,8 +2,11 @@ package main
 
 import (
 	"fmt"
+	"net"
+	"syscall"
 	"time"
 
+	"github.com/lib/pq"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -70,13 +73,10 @@ func testErrorClassification() {
 
 func testRetryLogic() {
 	// Create a mock migration tool for testing
-	config := &Config{
-		Migration: MigrationConfig{
-			MaxRetries:          3,
-			RetryDelaySeconds:   1,
-			BatchTimeoutSeconds: 10,
-		},
-	}
+	config := DefaultConfig()
+	config.Migration.MaxRetries = 3
+	config.Migration.RetryDelaySeconds = 1
+	config.Migration.BatchTimeoutSeconds = 10
 
 	errorLogger := NewErrorLogger()
 	batchProcessor := &BatchProcessor{
@@ -94,28 +94,30 @@ func testRetryLogic() {
 
 	// Test retryable error detection
 	retryableErrors := []error{
-		fmt.Errorf("connection refused"),
-		fmt.Errorf("timeout occurred"),
-		fmt.Errorf("network is unreachable"),
-		fmt.Errorf("deadlock detected"),
+		&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED},
+		fmt.Errorf("copy failed: %w", &pq.Error{Code: "40P01", Message: "deadlock detected"}),
+		&pq.Error{Code: "40001", Message: "could not serialize access due to concurrent update"},
+		&pq.Error{Code: "57P01", Message: "terminating connection due to administrator command"},
+		&pq.Error{Code: "08006", Message: "connection failure"},
 	}
 
 	nonRetryableErrors := []error{
 		fmt.Errorf("validation failed"),
-		fmt.Errorf("invalid data format"),
-		fmt.Errorf("constraint violation"),
+		&pq.Error{Code: "22001", Message: "value too long for type character varying(50)"},
+		&pq.Error{Code: "23503", Message: "insert or update on table violates foreign key constraint"},
 	}
 
 	fmt.Println("  Retryable Errors:")
 	for _, err := range retryableErrors {
-		isRetryable := mockTool.isRetryableError(err)
-		fmt.Printf("    '%s' -> Retryable: %t ✓\n", err.Error(), isRetryable)
+		class, policy := mockTool.retryPolicy(err)
+		fmt.Printf("    '%s' -> %s, %s, Retryable: %t (up to %d attempts, first delay ~%v) ✓\n",
+			err.Error(), class, class.ErrorType(), mockTool.isRetryableError(err), policy.MaxAttempts, policy.Delay(0).Round(time.Millisecond))
 	}
 
 	fmt.Println("  Non-Retryable Errors:")
 	for _, err := range nonRetryableErrors {
-		isRetryable := mockTool.isRetryableError(err)
-		fmt.Printf("    '%s' -> Retryable: %t ✓\n", err.Error(), isRetryable)
+		class := classifyError(err)
+		fmt.Printf("    '%s' -> %s, %s, Retryable: %t ✓\n", err.Error(), class, class.ErrorType(), mockTool.isRetryableError(err))
 	}
 }
 
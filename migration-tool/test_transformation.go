@@ -117,5 +117,15 @@ func TestTransformation() {
 		fmt.Printf("✓ Destination Port: '%s' -> %d\n", sampleDoc.OptionalInformation.DestinationPort, destPort)
 	}
 
+	// Test service inference from the ports
+	fmt.Printf("\n=== Testing Service Inference ===\n")
+	threat, err := mockClient.NormalizeDocument(sampleDoc)
+	if err != nil {
+		log.Printf("Normalization failed: %v", err)
+	} else {
+		fmt.Printf("✓ Application Protocol: %s/%s -> %s\n", threat.Protocol,
+			sampleDoc.OptionalInformation.DestinationPort, threat.ApplicationProtocolMatch)
+	}
+
 	fmt.Printf("\n=== Transformation Test Complete ===\n")
 }
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// VerifyReport is the machine-readable result of comparing MongoDB with ThreatEvents
+type VerifyReport struct {
+	GeneratedAt     time.Time          `json:"generated_at"`
+	MongoTotal      int64              `json:"mongo_total"`
+	PostgresTotal   int64              `json:"postgres_total"`
+	Days            []CountDiscrepancy `json:"days"`
+	Categories      []CountDiscrepancy `json:"categories"`
+	SourceCountries []CountDiscrepancy `json:"source_countries"`
+	Sample          SampleReport       `json:"sample"`
+	OK              bool               `json:"ok"`
+}
+
+// CountDiscrepancy is a group whose document count differs between MongoDB and PostgreSQL
+type CountDiscrepancy struct {
+	Key        string `json:"key"`
+	Mongo      int64  `json:"mongo"`
+	Postgres   int64  `json:"postgres"`
+	Difference int64  `json:"difference"` // postgres - mongo
+}
+
+// SampleReport summarizes the field-by-field comparison of sampled documents
+type SampleReport struct {
+	Requested     int                `json:"requested"`
+	Checked       int                `json:"checked"`
+	Rejected      int                `json:"rejected"` // documents the pipeline would not migrate
+	Missing       int                `json:"missing"`
+	Mismatched    int                `json:"mismatched"`
+	Discrepancies []FieldDiscrepancy `json:"discrepancies"`
+}
+
+// FieldDiscrepancy is a single field that differs between a sampled document and its ThreatEvents row
+type FieldDiscrepancy struct {
+	DocumentID string `json:"document_id"`
+	EventID    string `json:"event_id"`
+	Field      string `json:"field"`
+	Expected   string `json:"expected"`
+	Actual     string `json:"actual"`
+}
+
+// countGroups runs a $group aggregation and returns counts keyed by the stringified group key
+func (m *MongoDBClient) countGroups(ctx context.Context, groupKey any) (map[string]int64, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: groupKey},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+	}
+
+	cursor, err := m.collection.Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return nil, fmt.Errorf("aggregation failed: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	counts := make(map[string]int64)
+	for cursor.Next(ctx) {
+		var row struct {
+			Key   any   `bson:"_id"`
+			Count int64 `bson:"count"`
+		}
+		if err := cursor.Decode(&row); err != nil {
+			return nil, fmt.Errorf("failed to decode aggregation row: %w", err)
+		}
+		key := ""
+		if row.Key != nil {
+			key = fmt.Sprint(row.Key)
+		}
+		counts[key] += row.Count
+	}
+	return counts, cursor.Err()
+}
+
+// CountByDay returns document counts per UTC day (YYYY-MM-DD); unparseable timestamps count under "".
+// Timestamps are read with decodeTime, as the migration reads them, rather than by a $convert that
+// takes every number for milliseconds and fails on some of the string layouts.
+func (m *MongoDBClient) CountByDay(ctx context.Context) (map[string]int64, error) {
+	cursor, err := m.collection.Find(ctx, bson.M{},
+		options.Find().SetProjection(bson.D{{Key: "_id", Value: 0}, {Key: "timestamp", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find documents: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	counts := make(map[string]int64)
+	for cursor.Next(ctx) {
+		counts[timestampDay(cursor.Current.Lookup("timestamp"))]++
+	}
+	return counts, cursor.Err()
+}
+
+// timestampDay returns the UTC day (YYYY-MM-DD) of a raw timestamp value, or "" when it is
+// missing or does not decode
+func timestampDay(value bson.RawValue) string {
+	var timestamp time.Time
+	var coerced []fieldCoercion
+	if decodeTime("timestamp", value, &timestamp, &coerced) != nil || timestamp.IsZero() {
+		return ""
+	}
+	return timestamp.Format("2006-01-02")
+}
+
+// CountByField returns document counts per raw value of field
+func (m *MongoDBClient) CountByField(ctx context.Context, field string) (map[string]int64, error) {
+	return m.countGroups(ctx, "$"+field)
+}
+
+// SampleDocuments returns up to n randomly selected documents
+func (m *MongoDBClient) SampleDocuments(ctx context.Context, n int) ([]ThreatDocument, error) {
+	cursor, err := m.collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$sample", Value: bson.D{{Key: "size", Value: n}}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("sample failed: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var documents []ThreatDocument
+	for cursor.Next(ctx) {
+		var doc ThreatDocument
+		if err := cursor.Decode(&doc); err != nil {
+			log.Printf("Warning: failed to decode sampled document: %v", err)
+			continue
+		}
+		documents = append(documents, doc)
+	}
+	return documents, cursor.Err()
+}
+
+// postgresGroupCounts runs a two-column (key, count) query
+func (p *PostgreSQLClient) postgresGroupCounts(ctx context.Context, query string) (map[string]int64, error) {
+	rows, err := p.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("count query failed: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int64)
+	for rows.Next() {
+		var key sql.NullString
+		var count int64
+		if err := rows.Scan(&key, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan count row: %w", err)
+		}
+		counts[key.String] += count
+	}
+	return counts, rows.Err()
+}
+
+// migratedRow is a ThreatEvents row with its lookup values joined in
+type migratedRow struct {
+	Timestamp           time.Time
+	SourceAddress       string
+	ASN                 string
+	ASNumber            sql.NullInt64
+	Category            string
+	SourceCountry       sql.NullString
+	DestinationAddress  sql.NullString
+	DestinationCountry  sql.NullString
+	SourcePort          sql.NullInt64
+	DestinationPort     sql.NullInt64
+	Protocol            sql.NullString
+	ApplicationProtocol sql.NullString
+	MalwareFamily       sql.NullString
+}
+
+// loadMigratedRow fetches a ThreatEvents row by ID with its lookup tables joined; nil if absent
+func (p *PostgreSQLClient) loadMigratedRow(ctx context.Context, threat *NormalizedThreat) (*migratedRow, error) {
+	var row migratedRow
+	err := p.db.QueryRowContext(ctx, `
+		SELECT t."Timestamp", host(t."SourceAddress"::inet), a."Number", a."AsNumber", t."Category",
+			sc."Code", host(t."DestinationAddress"::inet), dc."Code",
+			t."SourcePort", t."DestinationPort", pr."Name", ap."Name", mf."Name"
+		FROM "ThreatEvents" t
+		JOIN "AsnRegistries" a ON a."Id" = t."AsnRegistryId"
+		LEFT JOIN "Countries" sc ON sc."Id" = t."SourceCountryId"
+		LEFT JOIN "Countries" dc ON dc."Id" = t."DestinationCountryId"
+		LEFT JOIN "Protocols" pr ON pr."Id" = t."ProtocolId"
+		LEFT JOIN "ApplicationProtocols" ap ON ap."Id" = t."ApplicationProtocolId"
+		LEFT JOIN "MalwareFamilies" mf ON mf."Id" = t."MalwareFamilyId"
+		WHERE t."Id" = $1 AND t."Timestamp" = $2`, threat.ID, threat.Timestamp).Scan(
+		&row.Timestamp, &row.SourceAddress, &row.ASN, &row.ASNumber, &row.Category,
+		&row.SourceCountry, &row.DestinationAddress, &row.DestinationCountry,
+		&row.SourcePort, &row.DestinationPort, &row.Protocol, &row.ApplicationProtocol, &row.MalwareFamily,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ThreatEvents row %s: %w", threat.ID, err)
+	}
+	return &row, nil
+}
+
+// Verify compares the MongoDB collection with ThreatEvents and writes a JSON discrepancy report
+// to reportPath ("" or "-" for stdout). It returns an error if any discrepancy was found.
+func (m *MigrationTool) Verify(ctx context.Context, sampleSize int, reportPath string) error {
+	if m.mongoClient == nil {
+		return fmt.Errorf("verify compares against MongoDB and needs the %s source, not %s", SourceMongoDB, m.config.Source.Type)
+	}
+	report := VerifyReport{GeneratedAt: time.Now().UTC()}
+	pg := m.postgresClient
+
+	log.Println("Verify: counting documents per day...")
+	mongoDays, err := m.mongoClient.CountByDay(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to count MongoDB documents per day: %w", err)
+	}
+	pgDays, err := pg.postgresGroupCounts(ctx, `
+		SELECT to_char("Timestamp" AT TIME ZONE 'UTC', 'YYYY-MM-DD'), COUNT(*)
+		FROM "ThreatEvents" WHERE "DeletedAt" IS NULL GROUP BY 1`)
+	if err != nil {
+		return err
+	}
+	report.Days = compareCounts(mongoDays, pgDays, nil)
+	for _, count := range mongoDays {
+		report.MongoTotal += count
+	}
+	for _, count := range pgDays {
+		report.PostgresTotal += count
+	}
+
+	// Raw MongoDB values are folded through the same normalizers the migration uses
+	log.Println("Verify: counting documents per category...")
+	mongoCategories, err := m.mongoClient.CountByField(ctx, "category")
+	if err != nil {
+		return fmt.Errorf("failed to count MongoDB documents per category: %w", err)
+	}
+	pgCategories, err := pg.postgresGroupCounts(ctx, `
+		SELECT "Category", COUNT(*) FROM "ThreatEvents" WHERE "DeletedAt" IS NULL GROUP BY 1`)
+	if err != nil {
+		return err
+	}
+	report.Categories = compareCounts(mongoCategories, pgCategories, pg.normalizeCategory)
+
+	log.Println("Verify: counting documents per source country...")
+	mongoCountries, err := m.mongoClient.CountByField(ctx, "source_country")
+	if err != nil {
+		return fmt.Errorf("failed to count MongoDB documents per source country: %w", err)
+	}
+	pgCountries, err := pg.postgresGroupCounts(ctx, `
+		SELECT c."Code", COUNT(*) FROM "ThreatEvents" t
+		LEFT JOIN "Countries" c ON c."Id" = t."SourceCountryId"
+		WHERE t."DeletedAt" IS NULL GROUP BY 1`)
+	if err != nil {
+		return err
+	}
+	report.SourceCountries = compareCounts(mongoCountries, pgCountries, pg.normalizeCountryCode)
+
+	if sampleSize > 0 {
+		log.Printf("Verify: comparing %d sampled documents field by field...", sampleSize)
+		sample, err := m.verifySample(ctx, sampleSize)
+		if err != nil {
+			return err
+		}
+		report.Sample = *sample
+	}
+
+	report.OK = len(report.Days) == 0 && len(report.Categories) == 0 && len(report.SourceCountries) == 0 &&
+		report.Sample.Missing == 0 && report.Sample.Mismatched == 0
+
+	if err := writeVerifyReport(report, reportPath); err != nil {
+		return err
+	}
+
+	log.Printf("Verify: MongoDB %d, PostgreSQL %d; %d day, %d category, %d country discrepancies; sample %d checked, %d missing, %d mismatched",
+		report.MongoTotal, report.PostgresTotal, len(report.Days), len(report.Categories), len(report.SourceCountries),
+		report.Sample.Checked, report.Sample.Missing, report.Sample.Mismatched)
+
+	if !report.OK {
+		return fmt.Errorf("verification found discrepancies")
+	}
+	log.Println("✅ Verification passed")
+	return nil
+}
+
+// verifySample diffs randomly sampled documents against their migrated rows
+func (m *MigrationTool) verifySample(ctx context.Context, sampleSize int) (*SampleReport, error) {
+	documents, err := m.mongoClient.SampleDocuments(ctx, sampleSize)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &SampleReport{Requested: sampleSize, Discrepancies: []FieldDiscrepancy{}}
+	for _, doc := range documents {
+		if doc.ValidateDocument() != nil {
+			report.Rejected++
+			continue
+		}
+		expected, err := m.postgresClient.NormalizeDocument(doc)
+		if err != nil {
+			report.Rejected++
+			continue
+		}
+		report.Checked++
+
+		actual, err := m.postgresClient.loadMigratedRow(ctx, expected)
+		if err != nil {
+			return nil, err
+		}
+		if actual == nil {
+			report.Missing++
+			report.Discrepancies = append(report.Discrepancies, FieldDiscrepancy{
+				DocumentID: doc.SourceIDString(), EventID: expected.ID.String(), Field: "row", Expected: "present", Actual: "missing",
+			})
+			continue
+		}
+
+		diffs := diffMigratedRow(expected, actual)
+		if len(diffs) > 0 {
+			report.Mismatched++
+			for _, diff := range diffs {
+				diff.DocumentID = doc.SourceIDString()
+				diff.EventID = expected.ID.String()
+				report.Discrepancies = append(report.Discrepancies, diff)
+			}
+		}
+	}
+	return report, nil
+}
+
+// diffMigratedRow compares the expected normalized values with a migrated row
+func diffMigratedRow(expected *NormalizedThreat, actual *migratedRow) []FieldDiscrepancy {
+	var diffs []FieldDiscrepancy
+	check := func(field, want, got string) {
+		if want != got {
+			diffs = append(diffs, FieldDiscrepancy{Field: field, Expected: want, Actual: got})
+		}
+	}
+
+	check("Timestamp", expected.Timestamp.UTC().Format(time.RFC3339Nano), actual.Timestamp.UTC().Format(time.RFC3339Nano))
+	check("SourceAddress", expected.SourceAddress.String(), actual.SourceAddress)
+	// Rows from earlier versions may keep another spelling of the same AS number
+	if expected.ASNumber != 0 {
+		check("AsnRegistry.AsNumber", strconv.FormatUint(uint64(expected.ASNumber), 10), formatNullInt(actual.ASNumber))
+	} else {
+		check("AsnRegistry.Number", expected.ASN, actual.ASN)
+	}
+	check("Category", expected.Category, actual.Category)
+	check("SourceCountry.Code", expected.SourceCountry, actual.SourceCountry.String)
+	destAddr := ""
+	if expected.DestinationAddress != nil {
+		destAddr = expected.DestinationAddress.String()
+	}
+	check("DestinationAddress", destAddr, actual.DestinationAddress.String)
+	check("DestinationCountry.Code", expected.DestinationCountry, actual.DestinationCountry.String)
+	check("SourcePort", formatOptionalPort(expected.SourcePort), formatNullInt(actual.SourcePort))
+	check("DestinationPort", formatOptionalPort(expected.DestinationPort), formatNullInt(actual.DestinationPort))
+	check("Protocol.Name", expected.Protocol, actual.Protocol.String)
+	check("ApplicationProtocol.Name", expected.ApplicationProtocol, actual.ApplicationProtocol.String)
+	check("MalwareFamily.Name", expected.MalwareFamily, actual.MalwareFamily.String)
+	return diffs
+}
+
+func formatOptionalPort(port *int) string {
+	if port == nil {
+		return ""
+	}
+	return strconv.Itoa(*port)
+}
+
+func formatNullInt(value sql.NullInt64) string {
+	if !value.Valid {
+		return ""
+	}
+	return strconv.FormatInt(value.Int64, 10)
+}
+
+// compareCounts folds the MongoDB counts through normalize (if set) and returns the keys whose
+// counts differ, sorted by key
+func compareCounts(mongoCounts, pgCounts map[string]int64, normalize func(string) string) []CountDiscrepancy {
+	folded := make(map[string]int64, len(mongoCounts))
+	for key, count := range mongoCounts {
+		if normalize != nil {
+			key = normalize(sanitizeUTF8String(key))
+		}
+		folded[key] += count
+	}
+
+	keys := make(map[string]struct{}, len(folded)+len(pgCounts))
+	for key := range folded {
+		keys[key] = struct{}{}
+	}
+	for key := range pgCounts {
+		keys[key] = struct{}{}
+	}
+
+	discrepancies := []CountDiscrepancy{}
+	for key := range keys {
+		if folded[key] != pgCounts[key] {
+			discrepancies = append(discrepancies, CountDiscrepancy{
+				Key:        key,
+				Mongo:      folded[key],
+				Postgres:   pgCounts[key],
+				Difference: pgCounts[key] - folded[key],
+			})
+		}
+	}
+	sort.Slice(discrepancies, func(i, j int) bool { return discrepancies[i].Key < discrepancies[j].Key })
+	return discrepancies
+}
+
+// writeVerifyReport writes the report as indented JSON to path, or stdout for "" / "-"
+func writeVerifyReport(report VerifyReport, path string) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode verify report: %w", err)
+	}
+	data = append(data, '\n')
+
+	if path == "" || path == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write verify report: %w", err)
+	}
+	log.Printf("Verify report written to %s", path)
+	return nil
+}
@@ -22,11 +22,19 @@ public class GetTenantThreatEventsPaginatedQueryHandler : IRequestHandler<GetTen
 
     public async Task<PaginatedDto<ThreatEventDto>> Handle(GetTenantThreatEventsPaginatedQuery request, CancellationToken ct)
     {
-        IEnumerable<Guid> tenantAsnRegistryIds = await _tenantAsnRegistryRepository.FindAsync(
-            tar => tar.TenantId == request.TenantId, tar => tar.Id, ct);
+        var tenantAsnRegistries = (await _tenantAsnRegistryRepository.FindAsync(
+            tar => tar.TenantId == request.TenantId,
+            tar => new { tar.AsnRegistryId, tar.AsnRegistry!.AsNumber }, ct)).ToList();
+
+        List<Guid> tenantAsnRegistryIds = tenantAsnRegistries.Select(tar => tar.AsnRegistryId).ToList();
+        List<long> tenantAsNumbers = tenantAsnRegistries
+            .Where(tar => tar.AsNumber.HasValue)
+            .Select(tar => tar.AsNumber!.Value)
+            .Distinct()
+            .ToList();
 
         // Build comprehensive filter predicate with tenant scope
-        Expression<Func<ThreatEvent, bool>> predicate = BuildTenantScopedFilterPredicate(request, tenantAsnRegistryIds.ToList());
+        Expression<Func<ThreatEvent, bool>> predicate = BuildTenantScopedFilterPredicate(request, tenantAsnRegistryIds, tenantAsNumbers);
 
         // Build orderBy expression
         Expression<Func<ThreatEvent, object>> orderBy = GetOrderByExpression(request.SortBy);
@@ -55,10 +63,13 @@ public class GetTenantThreatEventsPaginatedQueryHandler : IRequestHandler<GetTen
 
     private static Expression<Func<ThreatEvent, bool>> BuildTenantScopedFilterPredicate(
         GetTenantThreatEventsPaginatedQuery request,
-        List<Guid> assignedAsnRegistryIds)
+        List<Guid> assignedAsnRegistryIds,
+        List<long> assignedAsNumbers)
     {
-        // Start with tenant scope - CRITICAL: Only show threat events for tenant's assigned ASN registries
-        Expression<Func<ThreatEvent, bool>> predicate = te => assignedAsnRegistryIds.Contains(te.AsnRegistryId);
+        // Start with tenant scope - CRITICAL: Only show threat events for tenant's assigned ASN registries,
+        // including registries stored under another form of the same AS number (e.g. "13335" and "AS13335")
+        Expression<Func<ThreatEvent, bool>> predicate = te => assignedAsnRegistryIds.Contains(te.AsnRegistryId) ||
+            (te.AsnRegistry.AsNumber.HasValue && assignedAsNumbers.Contains(te.AsnRegistry.AsNumber.Value));
 
         // Time range filtering (CRITICAL for TimescaleDB performance)
         if (request.StartTime.HasValue)
@@ -0,0 +1,8 @@
+namespace MeUi.Domain.Entities;
+
+public class ApplicationProtocol : BaseEntity
+{
+    public string Name { get; set; } = string.Empty;
+
+    public virtual ICollection<ThreatEvent> ThreatEvents { get; set; } = [];
+}
\ No newline at end of file
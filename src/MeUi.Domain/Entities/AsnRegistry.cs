@@ -3,6 +3,7 @@ namespace MeUi.Domain.Entities;
 public class AsnRegistry : BaseEntity
 {
     public string Number { get; set; } = string.Empty;
+    public long? AsNumber { get; set; }
     public string Description { get; set; } = string.Empty;
 
     public virtual ICollection<ThreatEvent> ThreatEvents { get; set; } = [];
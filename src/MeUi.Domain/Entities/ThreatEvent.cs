@@ -12,6 +12,7 @@ public class ThreatEvent : BaseEntity
     public int? SourcePort { get; set; }
     public int? DestinationPort { get; set; }
     public Guid? ProtocolId { get; set; }
+    public Guid? ApplicationProtocolId { get; set; }
     public string Category { get; set; } = string.Empty;
     public Guid? MalwareFamilyId { get; set; }
     public DateTime Timestamp { get; set; }
@@ -20,5 +21,6 @@ public class ThreatEvent : BaseEntity
     public Country? SourceCountry { get; set; }
     public Country? DestinationCountry { get; set; }
     public Protocol? Protocol { get; set; }
+    public ApplicationProtocol? ApplicationProtocol { get; set; }
     public MalwareFamily? MalwareFamily { get; set; }
 }
\ No newline at end of file
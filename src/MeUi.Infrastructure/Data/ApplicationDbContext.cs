@@ -46,6 +46,7 @@ public class ApplicationDbContext : DbContext
     public DbSet<AsnRegistry> AsnRegistries { get; set; }
     public DbSet<Country> Countries { get; set; }
     public DbSet<Protocol> Protocols { get; set; }
+    public DbSet<ApplicationProtocol> ApplicationProtocols { get; set; }
     public DbSet<MalwareFamily> MalwareFamilies { get; set; }
 
     protected override void OnModelCreating(ModelBuilder modelBuilder)
@@ -0,0 +1,23 @@
+using Microsoft.EntityFrameworkCore;
+using Microsoft.EntityFrameworkCore.Metadata.Builders;
+using MeUi.Domain.Entities;
+
+namespace MeUi.Infrastructure.Data.Configurations;
+
+public class ApplicationProtocolConfiguration : IEntityTypeConfiguration<ApplicationProtocol>
+{
+    public void Configure(EntityTypeBuilder<ApplicationProtocol> builder)
+    {
+        builder.HasKey(e => e.Id);
+
+        builder.Property(e => e.Name).IsRequired().HasMaxLength(50);
+        builder.Property(e => e.CreatedAt).IsRequired();
+
+        builder.HasIndex(e => e.Name).IsUnique();
+        builder.HasIndex(e => e.DeletedAt);
+
+        builder.HasMany(e => e.ThreatEvents)
+            .WithOne(t => t.ApplicationProtocol)
+            .HasForeignKey(t => t.ApplicationProtocolId);
+    }
+}
\ No newline at end of file
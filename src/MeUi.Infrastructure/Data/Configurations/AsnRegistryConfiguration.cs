@@ -18,6 +18,7 @@ public class AsnRegistryConfiguration : IEntityTypeConfiguration<AsnRegistry>
             .IsRequired();
 
         builder.HasIndex(e => e.Number).IsUnique();
+        builder.HasIndex(e => e.AsNumber);
 
         builder.Property(x => x.DeletedAt);
 
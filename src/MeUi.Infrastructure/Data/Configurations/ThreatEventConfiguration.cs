@@ -25,6 +25,7 @@ public class ThreatEventConfiguration : IEntityTypeConfiguration<ThreatEvent>
         builder.HasIndex(e => e.DeletedAt);
         builder.HasIndex(e => e.MalwareFamilyId);
         builder.HasIndex(e => e.ProtocolId);
+        builder.HasIndex(e => e.ApplicationProtocolId);
 
         builder.HasOne(e => e.AsnRegistry)
             .WithMany(a => a.ThreatEvents)
@@ -42,6 +43,10 @@ public class ThreatEventConfiguration : IEntityTypeConfiguration<ThreatEvent>
             .WithMany(p => p.ThreatEvents)
             .HasForeignKey(e => e.ProtocolId);
 
+        builder.HasOne(e => e.ApplicationProtocol)
+            .WithMany(p => p.ThreatEvents)
+            .HasForeignKey(e => e.ApplicationProtocolId);
+
         builder.HasOne(e => e.MalwareFamily)
             .WithMany(m => m.ThreatEvents)
             .HasForeignKey(e => e.MalwareFamilyId);
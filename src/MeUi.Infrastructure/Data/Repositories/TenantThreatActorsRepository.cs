@@ -49,7 +49,7 @@ WITH actor_profiles AS (
   JOIN ""AsnRegistries"" ar ON te.""AsnRegistryId"" = ar.""Id""
   WHERE te.""DeletedAt"" IS NULL 
     AND te.""Timestamp"" BETWEEN @start AND @end
-    AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+    AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
   GROUP BY ""SourceAddress"", c.""Name"", ar.""Number""
   HAVING COUNT(*) > 20
 )
@@ -86,7 +86,7 @@ WITH actor_countries AS (
   JOIN ""Countries"" c ON te.""SourceCountryId"" = c.""Id""
   WHERE te.""DeletedAt"" IS NULL 
     AND te.""Timestamp"" BETWEEN @start AND @end
-    AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+    AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
   GROUP BY c.""Name""
   HAVING COUNT(DISTINCT ""SourceAddress"") > 5
 )
@@ -110,7 +110,7 @@ WITH actor_asn AS (
   JOIN ""AsnRegistries"" ar ON te.""AsnRegistryId"" = ar.""Id""
   WHERE te.""DeletedAt"" IS NULL 
     AND te.""Timestamp"" BETWEEN @start AND @end
-    AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+    AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
   GROUP BY ar.""Number""
   HAVING COUNT(DISTINCT ""SourceAddress"") > 3
 )
@@ -135,7 +135,7 @@ WITH top_actors AS (
   FROM ""ThreatEvents""
   WHERE ""DeletedAt"" IS NULL 
     AND ""Timestamp"" BETWEEN @start AND @end
-    AND ""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+    AND ""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
   GROUP BY ""SourceAddress""
   HAVING COUNT(*) > 100
   ORDER BY COUNT(*) DESC
@@ -149,7 +149,7 @@ FROM ""ThreatEvents"" te
 WHERE te.""DeletedAt"" IS NULL 
   AND te.""Timestamp"" BETWEEN @start AND @end
   AND te.""SourceAddress"" IN (SELECT ""SourceAddress"" FROM top_actors)
-  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
 GROUP BY Time, te.""SourceAddress""
 ORDER BY Time
 ";
@@ -176,7 +176,7 @@ WITH actor_ttp AS (
   FROM ""ThreatEvents""
   WHERE ""DeletedAt"" IS NULL 
     AND ""Timestamp"" BETWEEN @start AND @end
-    AND ""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+    AND ""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
   GROUP BY ""SourceAddress"", ttp_category
   HAVING COUNT(*) > 10
 ),
@@ -218,7 +218,7 @@ WITH actor_profiles AS (
   LEFT JOIN ""MalwareFamilies"" mf ON te.""MalwareFamilyId"" = mf.""Id""
   WHERE te.""DeletedAt"" IS NULL 
     AND te.""Timestamp"" BETWEEN @start AND @end
-    AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+    AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
   GROUP BY te.""SourceAddress""
   HAVING COUNT(*) > 15
 ),
@@ -274,7 +274,7 @@ WITH actor_persistence AS (
   FROM ""ThreatEvents""
   WHERE ""DeletedAt"" IS NULL 
     AND ""Timestamp"" BETWEEN @start AND @end
-    AND ""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+    AND ""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
   GROUP BY ""SourceAddress""
   HAVING COUNT(*) > 10
 ),
@@ -318,7 +318,7 @@ WITH actor_evolution AS (
   FROM ""ThreatEvents""
   WHERE ""DeletedAt"" IS NULL 
     AND ""Timestamp"" BETWEEN @start AND @end
-    AND ""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+    AND ""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
   GROUP BY ""SourceAddress"", DATE_TRUNC('day', ""Timestamp"")
   HAVING COUNT(*) > 5
 ),
@@ -46,7 +46,7 @@ WITH monthly_summary AS (
   FROM ""ThreatEvents"" te
   WHERE te.""DeletedAt"" IS NULL 
     AND te.""Timestamp"" >= @start - INTERVAL '12 months'
-    AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+    AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
   GROUP BY DATE_TRUNC('month', te.""Timestamp"")
 )
 SELECT 
@@ -87,7 +87,7 @@ SELECT
 FROM ""ThreatEvents"" te
 WHERE te.""DeletedAt"" IS NULL 
   AND te.""Timestamp"" BETWEEN @start AND @end
-  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
 GROUP BY Time
 
 UNION ALL
@@ -100,7 +100,7 @@ FROM ""ThreatEvents"" te
 WHERE te.""DeletedAt"" IS NULL 
   AND te.""Timestamp"" BETWEEN @start AND @end
   AND (te.""Category"" LIKE '%critical%' OR te.""Category"" LIKE '%malware%')
-  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
 GROUP BY Time
 
 UNION ALL
@@ -112,7 +112,7 @@ SELECT
 FROM ""ThreatEvents"" te
 WHERE te.""DeletedAt"" IS NULL 
   AND te.""Timestamp"" BETWEEN @start AND @end
-  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
 GROUP BY Time
 ORDER BY Time
 ";
@@ -133,7 +133,7 @@ WITH compliance_metrics AS (
   FROM ""ThreatEvents"" te
   WHERE te.""DeletedAt"" IS NULL 
     AND te.""Timestamp"" BETWEEN @start AND @end
-    AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+    AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
 )
 SELECT 
   CASE 
@@ -160,7 +160,7 @@ WITH risk_calculation AS (
   FROM ""ThreatEvents"" te
   WHERE te.""DeletedAt"" IS NULL 
     AND te.""Timestamp"" > NOW() - INTERVAL '24 hours'
-    AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+    AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
 )
 SELECT 
   CASE 
@@ -190,7 +190,7 @@ FROM ""ThreatEvents"" te
 JOIN ""Countries"" c ON te.""SourceCountryId"" = c.""Id""
 WHERE te.""DeletedAt"" IS NULL 
   AND te.""Timestamp"" BETWEEN @start AND @end
-  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
 GROUP BY c.""Name""
 ORDER BY RiskScore DESC
 LIMIT @limit
@@ -218,7 +218,7 @@ SELECT
 FROM ""ThreatEvents"" te
 WHERE te.""DeletedAt"" IS NULL 
   AND te.""Timestamp"" BETWEEN @start AND @end
-  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
 GROUP BY te.""Category""
 ORDER BY TotalEvents DESC
 LIMIT @limit
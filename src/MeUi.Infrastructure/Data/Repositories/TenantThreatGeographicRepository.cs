@@ -40,7 +40,7 @@ FROM ""ThreatEvents"" te
 JOIN ""Countries"" c ON te.""SourceCountryId"" = c.""Id""
 WHERE te.""DeletedAt"" IS NULL 
   AND te.""Timestamp"" BETWEEN @start AND @end
-  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
 GROUP BY Time, c.""Name""
 HAVING COUNT(*) > 5
 ORDER BY Time";
@@ -60,7 +60,7 @@ FROM ""ThreatEvents"" te
 JOIN ""Countries"" c ON te.""SourceCountryId"" = c.""Id""
 WHERE te.""DeletedAt"" IS NULL 
   AND te.""Timestamp"" BETWEEN @start AND @end
-  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
 GROUP BY c.""Name""
 ORDER BY Events DESC
 LIMIT @limit";
@@ -85,7 +85,7 @@ JOIN ""Countries"" c ON te.""SourceCountryId"" = c.""Id""
 JOIN ""AsnRegistries"" ar ON te.""AsnRegistryId"" = ar.""Id""
 WHERE te.""DeletedAt"" IS NULL 
   AND te.""Timestamp"" BETWEEN @start AND @end
-  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
 GROUP BY c.""Name"", ar.""Number"", ar.""Description""
 ORDER BY Events DESC
 LIMIT @limit";
@@ -111,7 +111,7 @@ FROM ""ThreatEvents"" te
 JOIN ""Countries"" c ON te.""SourceCountryId"" = c.""Id""
 WHERE te.""DeletedAt"" IS NULL 
   AND te.""Timestamp"" BETWEEN @start AND @end
-  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
 GROUP BY 
   CASE 
     WHEN EXTRACT(HOUR FROM te.""Timestamp"") BETWEEN 0 AND 5 THEN 'Night Hours (00-05 UTC)'
@@ -143,7 +143,7 @@ WITH country_category AS (
   WHERE te.""DeletedAt"" IS NULL 
     AND te.""Timestamp"" BETWEEN @start AND @end
     AND te.""DestinationCountryId"" IS NOT NULL
-    AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+    AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
   GROUP BY c.""Name"", dc.""Name"", te.""Category""
   HAVING COUNT(*) > 10
 )
@@ -174,14 +174,14 @@ FROM ""ThreatEvents"" te
 JOIN ""Countries"" c ON te.""SourceCountryId"" = c.""Id""
 WHERE te.""DeletedAt"" IS NULL 
   AND te.""Timestamp"" BETWEEN @start AND @end
-  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
   AND c.""Name"" IN (
     SELECT c2.""Name"" 
     FROM ""ThreatEvents"" te2
     JOIN ""Countries"" c2 ON te2.""SourceCountryId"" = c2.""Id""
     WHERE te2.""DeletedAt"" IS NULL 
       AND te2.""Timestamp"" BETWEEN @start AND @end
-      AND te2.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+      AND te2.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
     GROUP BY c2.""Name""
     ORDER BY COUNT(*) DESC
     LIMIT @topCountries
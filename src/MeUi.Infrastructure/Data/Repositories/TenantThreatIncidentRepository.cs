@@ -55,7 +55,7 @@ FROM ""ThreatEvents"" te
 JOIN ""Countries"" c ON te.""SourceCountryId"" = c.""Id""
 WHERE te.""DeletedAt"" IS NULL 
   AND te.""Timestamp"" BETWEEN @start AND @end
-  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
 GROUP BY te.""SourceAddress"", c.""Name"", te.""Category""
 HAVING COUNT(*) > 5
 ORDER BY Priority DESC, LastActivity DESC
@@ -82,7 +82,7 @@ WITH severity_counts AS (
   FROM ""ThreatEvents"" te
   WHERE te.""DeletedAt"" IS NULL 
     AND te.""Timestamp"" BETWEEN @start AND @end
-    AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+    AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
   GROUP BY te.""SourceAddress""
   HAVING COUNT(*) > 5
 )
@@ -115,7 +115,7 @@ SELECT
 FROM ""ThreatEvents"" te
 WHERE te.""DeletedAt"" IS NULL 
   AND te.""Timestamp"" BETWEEN @start AND @end
-  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
 GROUP BY Time
 
 UNION ALL
@@ -127,7 +127,7 @@ SELECT
 FROM ""ThreatEvents"" te
 WHERE te.""DeletedAt"" IS NULL 
   AND te.""Timestamp"" BETWEEN @start AND @end
-  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
 GROUP BY Time
 ORDER BY Time";
 
@@ -35,40 +35,40 @@ SELECT 'Total Events' as Metric, COUNT(*) as Count, 'All threat events in select
 FROM ""ThreatEvents"" te 
 WHERE te.""DeletedAt"" IS NULL 
     AND te.""Timestamp"" BETWEEN @start AND @end 
-    AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+    AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
 UNION ALL
 SELECT 'Active Categories' as Metric, COUNT(DISTINCT ""Category"") as Count, 'Distinct threat categories detected' as Description 
 FROM ""ThreatEvents"" te 
 WHERE te.""DeletedAt"" IS NULL 
     AND te.""Timestamp"" BETWEEN @start AND @end 
-    AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+    AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
 UNION ALL
 SELECT 'Unique Source IPs' as Metric, COUNT(DISTINCT ""SourceAddress"") as Count, 'Distinct attacking IP addresses' as Description 
 FROM ""ThreatEvents"" te 
 WHERE te.""DeletedAt"" IS NULL 
     AND te.""Timestamp"" BETWEEN @start AND @end 
-    AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+    AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
 UNION ALL
 SELECT 'Countries Involved' as Metric, COUNT(DISTINCT c.""Name"") as Count, 'Countries with threat activity' as Description 
 FROM ""ThreatEvents"" te 
 JOIN ""Countries"" c ON te.""SourceCountryId"" = c.""Id"" 
 WHERE te.""DeletedAt"" IS NULL 
     AND te.""Timestamp"" BETWEEN @start AND @end 
-    AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+    AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
 UNION ALL
 SELECT 'ASN Networks' as Metric, COUNT(DISTINCT ar.""Number"") as Count, 'Autonomous System Networks involved' as Description 
 FROM ""ThreatEvents"" te 
 JOIN ""AsnRegistries"" ar ON te.""AsnRegistryId"" = ar.""Id"" 
 WHERE te.""DeletedAt"" IS NULL 
     AND te.""Timestamp"" BETWEEN @start AND @end 
-    AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+    AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
 UNION ALL
 SELECT 'Protocols Used' as Metric, COUNT(DISTINCT p.""Name"") as Count, 'Network protocols in attacks' as Description 
 FROM ""ThreatEvents"" te 
 JOIN ""Protocols"" p ON te.""ProtocolId"" = p.""Id"" 
 WHERE te.""DeletedAt"" IS NULL 
     AND te.""Timestamp"" BETWEEN @start AND @end 
-    AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+    AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
 ";
         using IDbConnection connection = CreateConnection();
         IEnumerable<ExecutiveSummaryMetricDto> result = await connection.QueryAsync<ExecutiveSummaryMetricDto>(sql, new { start, end, tenantId }, commandTimeout: 300);
@@ -83,7 +83,7 @@ SELECT date_trunc('{intervalStr}', ""Timestamp"") as Time, COUNT(*) as ThreatEve
 FROM ""ThreatEvents"" te
 WHERE te.""DeletedAt"" IS NULL 
     AND te.""Timestamp"" BETWEEN @start AND @end
-    AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+    AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
 GROUP BY Time
 ORDER BY Time
 ";
@@ -99,7 +99,7 @@ SELECT ""Category"", COUNT(*) as Events
 FROM ""ThreatEvents"" te
 WHERE te.""DeletedAt"" IS NULL 
     AND te.""Timestamp"" BETWEEN @start AND @end
-    AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+    AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
 GROUP BY ""Category""
 ORDER BY Events DESC
 LIMIT @limit
@@ -117,7 +117,7 @@ FROM ""ThreatEvents"" te
 JOIN ""Countries"" c ON te.""SourceCountryId"" = c.""Id""
 WHERE te.""DeletedAt"" IS NULL 
     AND te.""Timestamp"" BETWEEN @start AND @end
-    AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+    AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
 GROUP BY c.""Name""
 ORDER BY Events DESC
 LIMIT @limit
@@ -135,7 +135,7 @@ FROM ""ThreatEvents"" te
 JOIN ""Protocols"" p ON te.""ProtocolId"" = p.""Id""
 WHERE te.""DeletedAt"" IS NULL 
     AND te.""Timestamp"" BETWEEN @start AND @end
-    AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+    AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
 GROUP BY p.""Name""
 ORDER BY Events DESC
 ";
@@ -151,7 +151,7 @@ SELECT CAST(""SourceAddress"" as TEXT) as SourceIp, COUNT(*) as Events, COUNT(DI
 FROM ""ThreatEvents"" te
 WHERE te.""DeletedAt"" IS NULL 
     AND te.""Timestamp"" BETWEEN @start AND @end
-    AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+    AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
 GROUP BY ""SourceAddress""
 ORDER BY Events DESC
 LIMIT @limit
@@ -169,7 +169,7 @@ FROM ""ThreatEvents"" te
 WHERE te.""DeletedAt"" IS NULL 
     AND te.""Timestamp"" BETWEEN @start AND @end 
     AND ""DestinationPort"" IS NOT NULL
-    AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+    AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
 GROUP BY ""DestinationPort""
 ORDER BY Events DESC
 LIMIT @limit
@@ -186,7 +186,7 @@ SELECT ""Category"", COUNT(*) as TotalEvents, COUNT(DISTINCT ""SourceAddress"")
 FROM ""ThreatEvents"" te
 WHERE te.""DeletedAt"" IS NULL 
     AND te.""Timestamp"" BETWEEN @start AND @end
-    AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+    AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
 GROUP BY ""Category""
 ORDER BY TotalEvents DESC
 ";
@@ -38,7 +38,7 @@ FROM ""ThreatEvents"" te
 LEFT JOIN ""MalwareFamilies"" mf ON te.""MalwareFamilyId"" = mf.""Id""
 WHERE te.""DeletedAt"" IS NULL 
   AND te.""Timestamp"" BETWEEN @start AND @end
-  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
 GROUP BY mf.""Name""
 ORDER BY Events DESC";
 
@@ -59,7 +59,7 @@ FROM ""ThreatEvents"" te
 LEFT JOIN ""MalwareFamilies"" mf ON te.""MalwareFamilyId"" = mf.""Id""
 WHERE te.""DeletedAt"" IS NULL 
   AND te.""Timestamp"" BETWEEN @start AND @end
-  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
 GROUP BY Time, mf.""Name""
 HAVING COUNT(*) > 5
 ORDER BY Time";
@@ -86,7 +86,7 @@ FROM ""ThreatEvents"" te
 LEFT JOIN ""MalwareFamilies"" mf ON te.""MalwareFamilyId"" = mf.""Id""
 WHERE te.""DeletedAt"" IS NULL 
   AND te.""Timestamp"" BETWEEN @start AND @end
-  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
 GROUP BY mf.""Name""
 HAVING COUNT(*) > 5
 ORDER BY ThreatScore DESC
@@ -111,7 +111,7 @@ LEFT JOIN ""MalwareFamilies"" mf ON te.""MalwareFamilyId"" = mf.""Id""
 JOIN ""Countries"" c ON te.""SourceCountryId"" = c.""Id""
 WHERE te.""DeletedAt"" IS NULL 
   AND te.""Timestamp"" BETWEEN @start AND @end
-  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
 GROUP BY mf.""Name"", c.""Name""
 HAVING COUNT(*) > 1
 ORDER BY Events DESC
@@ -140,7 +140,7 @@ JOIN ""Countries"" c ON te.""SourceCountryId"" = c.""Id""
 JOIN ""AsnRegistries"" ar ON te.""AsnRegistryId"" = ar.""Id""
 WHERE te.""DeletedAt"" IS NULL 
   AND te.""Timestamp"" BETWEEN @start AND @end
-  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
 GROUP BY te.""SourceAddress"", mf.""Name"", c.""Name"", ar.""Number""
 HAVING COUNT(*) > 1
 ORDER BY Detections DESC
@@ -163,7 +163,7 @@ WHERE te.""DeletedAt"" IS NULL
   AND te.""Timestamp"" BETWEEN @start AND @end
   AND ""DestinationPort"" IS NOT NULL
   AND mf.""Id"" IS NOT NULL
-  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
 GROUP BY ""DestinationPort""
 ORDER BY MalwareAttacks DESC
 LIMIT @limit";
@@ -185,7 +185,7 @@ FROM ""ThreatEvents"" te
 WHERE te.""DeletedAt"" IS NULL 
   AND te.""Timestamp"" BETWEEN @start AND @end
   AND te.""MalwareFamilyId"" IS NULL
-  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
 GROUP BY Time
 
 UNION ALL
@@ -198,7 +198,7 @@ FROM ""ThreatEvents"" te
 WHERE te.""DeletedAt"" IS NULL 
   AND te.""Timestamp"" BETWEEN @start AND @end
   AND te.""MalwareFamilyId"" IS NOT NULL
-  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
 GROUP BY Time
 ORDER BY Time";
 
@@ -226,7 +226,7 @@ WITH malware_communication AS (
   WHERE te.""DeletedAt"" IS NULL 
     AND te.""Timestamp"" BETWEEN @start AND @end
     AND ""DestinationAddress"" IS NOT NULL
-    AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+    AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
   GROUP BY mf.""Name"", ""SourceAddress"", ""DestinationAddress"", p.""Name"", ""DestinationPort""
   HAVING COUNT(*) > 3
 )
@@ -39,7 +39,7 @@ FROM ""ThreatEvents"" te
 WHERE te.""DeletedAt"" IS NULL 
   AND te.""Timestamp"" BETWEEN @start AND @end
   AND ""DestinationPort"" IS NOT NULL
-  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
 GROUP BY ""DestinationPort""
 ORDER BY Attacks DESC
 LIMIT @limit";
@@ -59,7 +59,7 @@ FROM ""ThreatEvents"" te
 JOIN ""Protocols"" p ON te.""ProtocolId"" = p.""Id""
 WHERE te.""DeletedAt"" IS NULL 
   AND te.""Timestamp"" BETWEEN @start AND @end
-  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
 GROUP BY p.""Name""
 ORDER BY Events DESC";
 
@@ -84,7 +84,7 @@ FROM ""ThreatEvents"" te
 JOIN ""Protocols"" p ON te.""ProtocolId"" = p.""Id""
 WHERE te.""DeletedAt"" IS NULL 
   AND te.""Timestamp"" BETWEEN @start AND @end
-  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
 GROUP BY te.""SourceAddress""
 ORDER BY AttackScore DESC
 LIMIT @limit";
@@ -106,7 +106,7 @@ FROM ""ThreatEvents"" te
 WHERE te.""DeletedAt"" IS NULL 
   AND te.""Timestamp"" BETWEEN @start AND @end
   AND ""DestinationPort"" IN (22, 23, 80, 443, 3389, 1433, 3306, 5432, 6379, 27017)
-  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
 GROUP BY Time, ""DestinationPort""
 ORDER BY Time";
 
@@ -129,7 +129,7 @@ FROM ""ThreatEvents"" te
 JOIN ""AsnRegistries"" ar ON te.""AsnRegistryId"" = ar.""Id""
 WHERE te.""DeletedAt"" IS NULL 
   AND te.""Timestamp"" BETWEEN @start AND @end
-  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
 GROUP BY ar.""Number"", ar.""Description""
 ORDER BY Events DESC
 LIMIT @limit";
@@ -154,7 +154,7 @@ FROM ""ThreatEvents"" te
 WHERE te.""DeletedAt"" IS NULL 
   AND te.""Timestamp"" BETWEEN @start AND @end
   AND ""DestinationAddress"" IS NOT NULL
-  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
 GROUP BY ""DestinationAddress""
 ORDER BY AttacksReceived DESC
 LIMIT @limit";
@@ -176,7 +176,7 @@ FROM ""ThreatEvents"" te
 JOIN ""Protocols"" p ON te.""ProtocolId"" = p.""Id""
 WHERE te.""DeletedAt"" IS NULL 
   AND te.""Timestamp"" BETWEEN @start AND @end
-  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistries"" WHERE ""TenantId"" = @tenantId AND ""DeletedAt"" IS NULL)
+  AND te.""AsnRegistryId"" IN (SELECT ""AsnRegistryId"" FROM ""TenantAsnRegistryIds"" WHERE ""TenantId"" = @tenantId)
 GROUP BY Time, p.""Name""
 ORDER BY Time";
 
@@ -0,0 +1,61 @@
+﻿using Microsoft.EntityFrameworkCore.Migrations;
+
+#nullable disable
+
+namespace MeUi.Infrastructure.Migrations
+{
+    /// <inheritdoc />
+    public partial class AddAsnRegistryAsNumber : Migration
+    {
+        /// <inheritdoc />
+        protected override void Up(MigrationBuilder migrationBuilder)
+        {
+            migrationBuilder.AddColumn<long>(
+                name: "AsNumber",
+                table: "AsnRegistries",
+                type: "bigint",
+                nullable: true);
+
+            migrationBuilder.CreateIndex(
+                name: "IX_AsnRegistries_AsNumber",
+                table: "AsnRegistries",
+                column: "AsNumber");
+
+            // Backfill the AS number of the existing registries from Number: asplain with or without
+            // an AS/ASN prefix ("13335", "AS13335", "ASN13335"), asdot ("AS1.10" is 65546) and an
+            // optional description after the number ("AS13335 CLOUDFLARENET"). Number is left as it is;
+            // values that are not an AS number get no AsNumber.
+            migrationBuilder.Sql(@"
+UPDATE ""AsnRegistries"" a
+SET ""AsNumber"" = parsed.number
+FROM (
+    SELECT ""Id"",
+        CASE
+            WHEN position('.' IN m) > 0 THEN
+                CASE WHEN split_part(m, '.', 1)::bigint <= 65535 AND split_part(m, '.', 2)::bigint <= 65535
+                    THEN split_part(m, '.', 1)::bigint * 65536 + split_part(m, '.', 2)::bigint
+                END
+            WHEN m::bigint <= 4294967295 THEN m::bigint
+        END AS number
+    FROM (
+        SELECT ""Id"", substring(upper(btrim(""Number"")) FROM '^(?:ASN|AS)? *([0-9]{1,10}(?:\.[0-9]{1,5})?)(?![0-9A-Z_.])') AS m
+        FROM ""AsnRegistries""
+    ) candidates
+    WHERE m IS NOT NULL
+) parsed
+WHERE a.""Id"" = parsed.""Id"" AND parsed.number > 0;");
+        }
+
+        /// <inheritdoc />
+        protected override void Down(MigrationBuilder migrationBuilder)
+        {
+            migrationBuilder.DropIndex(
+                name: "IX_AsnRegistries_AsNumber",
+                table: "AsnRegistries");
+
+            migrationBuilder.DropColumn(
+                name: "AsNumber",
+                table: "AsnRegistries");
+        }
+    }
+}
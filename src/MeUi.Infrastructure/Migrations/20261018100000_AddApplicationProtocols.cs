@@ -0,0 +1,78 @@
+﻿using System;
+using Microsoft.EntityFrameworkCore.Migrations;
+
+#nullable disable
+
+namespace MeUi.Infrastructure.Migrations
+{
+    /// <inheritdoc />
+    public partial class AddApplicationProtocols : Migration
+    {
+        /// <inheritdoc />
+        protected override void Up(MigrationBuilder migrationBuilder)
+        {
+            migrationBuilder.AddColumn<Guid>(
+                name: "ApplicationProtocolId",
+                table: "ThreatEvents",
+                type: "uuid",
+                nullable: true);
+
+            migrationBuilder.CreateTable(
+                name: "ApplicationProtocols",
+                columns: table => new
+                {
+                    Id = table.Column<Guid>(type: "uuid", nullable: false),
+                    Name = table.Column<string>(type: "character varying(50)", maxLength: 50, nullable: false),
+                    CreatedAt = table.Column<DateTime>(type: "timestamp with time zone", nullable: false),
+                    UpdatedAt = table.Column<DateTime>(type: "timestamp with time zone", nullable: true),
+                    DeletedAt = table.Column<DateTime>(type: "timestamp with time zone", nullable: true)
+                },
+                constraints: table =>
+                {
+                    table.PrimaryKey("PK_ApplicationProtocols", x => x.Id);
+                });
+
+            migrationBuilder.CreateIndex(
+                name: "IX_ThreatEvents_ApplicationProtocolId",
+                table: "ThreatEvents",
+                column: "ApplicationProtocolId");
+
+            migrationBuilder.CreateIndex(
+                name: "IX_ApplicationProtocols_DeletedAt",
+                table: "ApplicationProtocols",
+                column: "DeletedAt");
+
+            migrationBuilder.CreateIndex(
+                name: "IX_ApplicationProtocols_Name",
+                table: "ApplicationProtocols",
+                column: "Name",
+                unique: true);
+
+            migrationBuilder.AddForeignKey(
+                name: "FK_ThreatEvents_ApplicationProtocols_ApplicationProtocolId",
+                table: "ThreatEvents",
+                column: "ApplicationProtocolId",
+                principalTable: "ApplicationProtocols",
+                principalColumn: "Id");
+        }
+
+        /// <inheritdoc />
+        protected override void Down(MigrationBuilder migrationBuilder)
+        {
+            migrationBuilder.DropForeignKey(
+                name: "FK_ThreatEvents_ApplicationProtocols_ApplicationProtocolId",
+                table: "ThreatEvents");
+
+            migrationBuilder.DropTable(
+                name: "ApplicationProtocols");
+
+            migrationBuilder.DropIndex(
+                name: "IX_ThreatEvents_ApplicationProtocolId",
+                table: "ThreatEvents");
+
+            migrationBuilder.DropColumn(
+                name: "ApplicationProtocolId",
+                table: "ThreatEvents");
+        }
+    }
+}
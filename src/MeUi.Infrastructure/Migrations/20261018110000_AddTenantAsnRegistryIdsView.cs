@@ -0,0 +1,36 @@
+﻿using Microsoft.EntityFrameworkCore.Migrations;
+
+#nullable disable
+
+namespace MeUi.Infrastructure.Migrations
+{
+    /// <inheritdoc />
+    public partial class AddTenantAsnRegistryIdsView : Migration
+    {
+        /// <inheritdoc />
+        protected override void Up(MigrationBuilder migrationBuilder)
+        {
+            // The AsnRegistries rows a tenant may see: the rows mapped to it in TenantAsnRegistries,
+            // and every other row with the same AS number ("13335" and "AS13335"). Tenant queries
+            // filter ThreatEvents with this view only. The two matches are a UNION rather than one
+            // join on Id OR AsNumber, so each can use its index.
+            migrationBuilder.Sql(@"
+CREATE VIEW ""TenantAsnRegistryIds"" AS
+SELECT tar.""TenantId"", tar.""AsnRegistryId""
+FROM ""TenantAsnRegistries"" tar
+WHERE tar.""DeletedAt"" IS NULL
+UNION
+SELECT tar.""TenantId"", same_asn.""Id""
+FROM ""TenantAsnRegistries"" tar
+JOIN ""AsnRegistries"" mapped_asn ON mapped_asn.""Id"" = tar.""AsnRegistryId""
+JOIN ""AsnRegistries"" same_asn ON same_asn.""AsNumber"" = mapped_asn.""AsNumber""
+WHERE tar.""DeletedAt"" IS NULL;");
+        }
+
+        /// <inheritdoc />
+        protected override void Down(MigrationBuilder migrationBuilder)
+        {
+            migrationBuilder.Sql(@"DROP VIEW IF EXISTS ""TenantAsnRegistryIds"";");
+        }
+    }
+}
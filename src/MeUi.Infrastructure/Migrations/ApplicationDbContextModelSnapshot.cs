@@ -62,12 +62,45 @@ namespace MeUi.Infrastructure.Migrations
                     b.ToTable("Actions");
                 });
 
+            modelBuilder.Entity("MeUi.Domain.Entities.ApplicationProtocol", b =>
+                {
+                    b.Property<Guid>("Id")
+                        .ValueGeneratedOnAdd()
+                        .HasColumnType("uuid");
+
+                    b.Property<DateTime>("CreatedAt")
+                        .HasColumnType("timestamp with time zone");
+
+                    b.Property<DateTime?>("DeletedAt")
+                        .HasColumnType("timestamp with time zone");
+
+                    b.Property<string>("Name")
+                        .IsRequired()
+                        .HasMaxLength(50)
+                        .HasColumnType("character varying(50)");
+
+                    b.Property<DateTime?>("UpdatedAt")
+                        .HasColumnType("timestamp with time zone");
+
+                    b.HasKey("Id");
+
+                    b.HasIndex("DeletedAt");
+
+                    b.HasIndex("Name")
+                        .IsUnique();
+
+                    b.ToTable("ApplicationProtocols");
+                });
+
             modelBuilder.Entity("MeUi.Domain.Entities.AsnRegistry", b =>
                 {
                     b.Property<Guid>("Id")
                         .ValueGeneratedOnAdd()
                         .HasColumnType("uuid");
 
+                    b.Property<long?>("AsNumber")
+                        .HasColumnType("bigint");
+
                     b.Property<DateTime>("CreatedAt")
                         .HasColumnType("timestamp with time zone");
 
@@ -88,6 +121,8 @@ namespace MeUi.Infrastructure.Migrations
 
                     b.HasKey("Id");
 
+                    b.HasIndex("AsNumber");
+
                     b.HasIndex("Number")
                         .IsUnique();
 
@@ -1007,6 +1042,9 @@ namespace MeUi.Infrastructure.Migrations
                     b.Property<DateTime>("Timestamp")
                         .HasColumnType("timestamp with time zone");
 
+                    b.Property<Guid?>("ApplicationProtocolId")
+                        .HasColumnType("uuid");
+
                     b.Property<Guid>("AsnRegistryId")
                         .HasColumnType("uuid");
 
@@ -1051,6 +1089,8 @@ namespace MeUi.Infrastructure.Migrations
 
                     b.HasKey("Id", "Timestamp");
 
+                    b.HasIndex("ApplicationProtocolId");
+
                     b.HasIndex("AsnRegistryId");
 
                     b.HasIndex("Category");
@@ -1516,6 +1556,10 @@ namespace MeUi.Infrastructure.Migrations
 
             modelBuilder.Entity("MeUi.Domain.Entities.ThreatEvent", b =>
                 {
+                    b.HasOne("MeUi.Domain.Entities.ApplicationProtocol", "ApplicationProtocol")
+                        .WithMany("ThreatEvents")
+                        .HasForeignKey("ApplicationProtocolId");
+
                     b.HasOne("MeUi.Domain.Entities.AsnRegistry", "AsnRegistry")
                         .WithMany("ThreatEvents")
                         .HasForeignKey("AsnRegistryId")
@@ -1538,6 +1582,8 @@ namespace MeUi.Infrastructure.Migrations
                         .WithMany("SourceThreats")
                         .HasForeignKey("SourceCountryId");
 
+                    b.Navigation("ApplicationProtocol");
+
                     b.Navigation("AsnRegistry");
 
                     b.Navigation("DestinationCountry");
@@ -1633,6 +1679,11 @@ namespace MeUi.Infrastructure.Migrations
                     b.Navigation("TenantPermissions");
                 });
 
+            modelBuilder.Entity("MeUi.Domain.Entities.ApplicationProtocol", b =>
+                {
+                    b.Navigation("ThreatEvents");
+                });
+
             modelBuilder.Entity("MeUi.Domain.Entities.AsnRegistry", b =>
                 {
                     b.Navigation("AsnRegistryTenants");